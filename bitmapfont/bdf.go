@@ -0,0 +1,158 @@
+package bitmapfont
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"image"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxGlyphSize limits the size of the glyphs so a broken font cannot allocate huge bitmaps
+const maxGlyphSize = 1024
+
+// ParseBDF reads a font in the Glyph Bitmap Distribution Format. The encodings of the glyphs
+// are taken as Unicode code points, which holds for ISO 10646 and ISO 8859-1 fonts.
+func ParseBDF(data []byte) (*Face, error) {
+	face := &Face{glyphs: map[rune]*glyph{}}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	next := func() []string {
+		for scanner.Scan() {
+			line++
+			if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+				return fields
+			}
+		}
+		return nil
+	}
+
+	var box [4]int
+	var fontAdvance int
+	defaultChar := rune(-1)
+	ascent, descent := -1, -1
+	for fields := next(); fields != nil; fields = next() {
+		var err error
+		switch fields[0] {
+		case "FONTBOUNDINGBOX":
+			err = atois(fields[1:], box[:])
+		case "DWIDTH":
+			fontAdvance, err = atoi(fields, 1)
+		case "FONT_ASCENT":
+			ascent, err = atoi(fields, 1)
+		case "FONT_DESCENT":
+			descent, err = atoi(fields, 1)
+		case "DEFAULT_CHAR":
+			var char int
+			char, err = atoi(fields, 1)
+			defaultChar = rune(char)
+		case "STARTCHAR":
+			var encoding rune
+			var g *glyph
+			if encoding, g, err = parseBDFChar(next, fontAdvance); err == nil && encoding >= 0 {
+				face.glyphs[encoding] = g
+			}
+		case "ENDFONT":
+			face.ascent, face.descent = ascent, descent
+			// the properties are optional, the bounding box covers every glyph
+			if face.ascent < 0 {
+				face.ascent = box[1] + box[3]
+			}
+			if face.descent < 0 {
+				face.descent = -box[3]
+			}
+			face.fallback = face.glyphs[defaultChar]
+			if len(face.glyphs) == 0 {
+				return nil, errors.New("the font has no glyphs")
+			}
+			return face, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not read font")
+	}
+
+	return nil, errors.New("missing ENDFONT")
+}
+
+// parseBDFChar reads a glyph up to its ENDCHAR, the encoding is negative for the glyphs
+// which are not in the encoding of the font.
+func parseBDFChar(next func() []string, advance int) (rune, *glyph, error) {
+	encoding := -1
+	var box [4]int
+	for fields := next(); fields != nil; fields = next() {
+		var err error
+		switch fields[0] {
+		case "ENCODING":
+			encoding, err = atoi(fields, 1)
+		case "DWIDTH":
+			advance, err = atoi(fields, 1)
+		case "BBX":
+			err = atois(fields[1:], box[:])
+		case "BITMAP":
+			width, height := box[0], box[1]
+			if width < 0 || height < 0 || width > maxGlyphSize || height > maxGlyphSize {
+				return 0, nil, errors.Errorf("invalid glyph size %dx%d", width, height)
+			}
+			rows := make([][]byte, height)
+			for y := range rows {
+				row := next()
+				if row == nil {
+					return 0, nil, errors.New("bitmap ends early")
+				}
+				if rows[y], err = hex.DecodeString(row[0]); err != nil {
+					return 0, nil, errors.Wrap(err, "invalid bitmap")
+				}
+				if len(rows[y])*8 < width {
+					return 0, nil, errors.Errorf("bitmap row %d is shorter than the glyph", y+1)
+				}
+			}
+			// the bounding box is relative to the origin with y pointing up
+			offset := image.Pt(box[2], -(box[3] + height))
+			g := newGlyph(width, height, offset, advance, func(x, y int) bool {
+				return rows[y][x/8]&(0x80>>(x%8)) != 0
+			})
+			if fields := next(); fields == nil || fields[0] != "ENDCHAR" {
+				return 0, nil, errors.New("missing ENDCHAR")
+			}
+			return rune(encoding), g, nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return 0, nil, errors.New("missing BITMAP")
+}
+
+// atoi returns the number in the i-th field
+func atoi(fields []string, i int) (int, error) {
+	if len(fields) <= i {
+		return 0, errors.Errorf("%s needs %d values", fields[0], i)
+	}
+	value, err := strconv.Atoi(fields[i])
+
+	return value, errors.Wrapf(err, "invalid %s", fields[0])
+}
+
+// atois fills values with the numbers in the fields
+func atois(fields []string, values []int) error {
+	if len(fields) < len(values) {
+		return errors.Errorf("%d values are needed", len(values))
+	}
+	for i := range values {
+		value, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return errors.Wrap(err, "invalid number")
+		}
+		values[i] = value
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package bitmapfont
+
+import (
+	"strings"
+	"testing"
+)
+
+func bdfFont(chars string) []byte {
+	return []byte("STARTFONT 2.1\nFONTBOUNDINGBOX 8 8 0 -1\nDWIDTH 8 0\n" + chars + "ENDFONT\n")
+}
+
+const bdfChar = "STARTCHAR A\nENCODING 65\nBBX 2 2 0 0\nBITMAP\n80\n40\nENDCHAR\n"
+
+func TestParseBDF(t *testing.T) {
+	face, err := ParseBDF(bdfFont(bdfChar + "STARTCHAR unencoded\nENCODING -1\nBBX 1 1 0 0\nBITMAP\n80\nENDCHAR\n"))
+	if err != nil {
+		t.Fatalf("ParseBDF() error = %v", err)
+	}
+	// without the properties the ascent and the descent come from the bounding box
+	if face.ascent != 7 || face.descent != 1 {
+		t.Errorf("ascent, descent = %d, %d, want 7, 1", face.ascent, face.descent)
+	}
+	if len(face.glyphs) != 1 {
+		t.Fatalf("%d glyphs, want 1", len(face.glyphs))
+	}
+	g := face.glyphs['A']
+	if g.advance != 8 || g.offset.X != 0 || g.offset.Y != -2 {
+		t.Errorf("glyph advance %d offset %v, want 8 (0,-2)", g.advance, g.offset)
+	}
+	if g.mask.Pix[0] != 0xff || g.mask.Pix[1] != 0 || g.mask.Pix[g.mask.Stride] != 0 || g.mask.Pix[g.mask.Stride+1] != 0xff {
+		t.Errorf("glyph mask = %v, want a diagonal", g.mask.Pix)
+	}
+}
+
+func TestParseBDFMalformed(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"negative height", bdfFont("STARTCHAR A\nENCODING 65\nBBX 2 -3 0 0\nBITMAP\nENDCHAR\n"), "invalid glyph size 2x-3"},
+		{"negative width", bdfFont("STARTCHAR A\nENCODING 65\nBBX -2 1 0 0\nBITMAP\n80\nENDCHAR\n"), "invalid glyph size -2x1"},
+		{"huge height", bdfFont("STARTCHAR A\nENCODING 65\nBBX 2 2000000000 0 0\nBITMAP\n80\nENDCHAR\n"), "invalid glyph size"},
+		{"huge width", bdfFont("STARTCHAR A\nENCODING 65\nBBX 100000 1 0 0\nBITMAP\n80\nENDCHAR\n"), "invalid glyph size"},
+		{"short BBX", bdfFont("STARTCHAR A\nENCODING 65\nBBX 2 2\nBITMAP\n80\n40\nENDCHAR\n"), "4 values are needed"},
+		{"invalid number", bdfFont("STARTCHAR A\nENCODING x\nBBX 2 2 0 0\nBITMAP\n80\n40\nENDCHAR\n"), "invalid ENCODING"},
+		{"short bitmap", bdfFont("STARTCHAR A\nENCODING 65\nBBX 2 3 0 0\nBITMAP\n80\n40\nENDCHAR\n"), "invalid bitmap"},
+		{"bitmap ends early", []byte("STARTFONT 2.1\nSTARTCHAR A\nENCODING 65\nBBX 2 3 0 0\nBITMAP\n80\n"), "bitmap ends early"},
+		{"narrow row", bdfFont("STARTCHAR A\nENCODING 65\nBBX 12 1 0 0\nBITMAP\n80\nENDCHAR\n"), "bitmap row 1 is shorter than the glyph"},
+		{"missing ENDCHAR", bdfFont("STARTCHAR A\nENCODING 65\nBBX 1 1 0 0\nBITMAP\n80\n"), "missing ENDCHAR"},
+		{"missing BITMAP", []byte("STARTFONT 2.1\nSTARTCHAR A\nENCODING 65\n"), "missing BITMAP"},
+		{"no glyphs", bdfFont(""), "the font has no glyphs"},
+		{"missing ENDFONT", []byte("STARTFONT 2.1\n" + bdfChar), "missing ENDFONT"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseBDF(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseBDF() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
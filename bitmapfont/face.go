@@ -0,0 +1,128 @@
+// Package bitmapfont reads BDF and PCF bitmap fonts. Their glyphs are drawn pixel for pixel,
+// which keeps small text crisp on the 1-bit displays where anti-aliased text is thresholded.
+package bitmapfont
+
+import (
+	"bytes"
+	"compress/gzip"
+	"image"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Face is a bitmap font. Bitmap fonts have a single size, the glyphs are not scaled.
+// Unlike the vector faces, a Face can be shared by goroutines.
+type Face struct {
+	glyphs map[rune]*glyph
+	// fallback is drawn for the runes the font does not have, it can be nil
+	fallback *glyph
+	ascent   int
+	descent  int
+}
+
+type glyph struct {
+	mask *image.Alpha
+	// offset is the top left corner of the mask relative to the dot
+	offset  image.Point
+	advance int
+}
+
+// ErrUnknownFormat is returned by Parse for the data which is neither a BDF nor a PCF font
+var ErrUnknownFormat = errors.New("not a BDF or PCF font")
+
+// Parse reads a BDF or a PCF font, gzip compressed PCF fonts (.pcf.gz) are decompressed.
+func Parse(data []byte) (*Face, error) {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not decompress font")
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return nil, errors.Wrap(err, "could not decompress font")
+		}
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte(pcfMagic)):
+		return ParsePCF(data)
+	case bytes.HasPrefix(data, []byte("STARTFONT")):
+		return ParseBDF(data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Ascent returns the distance from the top of a line to the baseline in pixels.
+func (f *Face) Ascent() int {
+	return f.ascent
+}
+
+func (f *Face) glyph(r rune) (*glyph, bool) {
+	if g, ok := f.glyphs[r]; ok {
+		return g, true
+	}
+
+	return f.fallback, false
+}
+
+func (f *Face) Close() error {
+	return nil
+}
+
+func (f *Face) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	g, ok := f.glyph(r)
+	if g == nil {
+		return image.Rectangle{}, nil, image.Point{}, 0, false
+	}
+	min := image.Pt(dot.X.Round(), dot.Y.Round()).Add(g.offset)
+
+	return image.Rectangle{Min: min, Max: min.Add(g.mask.Rect.Size())}, g.mask, image.Point{}, fixed.I(g.advance), ok
+}
+
+func (f *Face) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	g, ok := f.glyph(r)
+	if g == nil {
+		return fixed.Rectangle26_6{}, 0, false
+	}
+	size := g.mask.Rect.Size()
+	bounds = fixed.R(g.offset.X, g.offset.Y, g.offset.X+size.X, g.offset.Y+size.Y)
+
+	return bounds, fixed.I(g.advance), ok
+}
+
+func (f *Face) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	g, ok := f.glyph(r)
+	if g == nil {
+		return 0, false
+	}
+
+	return fixed.I(g.advance), ok
+}
+
+func (f *Face) Kern(r0, r1 rune) fixed.Int26_6 {
+	return 0
+}
+
+func (f *Face) Metrics() font.Metrics {
+	return font.Metrics{
+		Height:  fixed.I(f.ascent + f.descent),
+		Ascent:  fixed.I(f.ascent),
+		Descent: fixed.I(f.descent),
+	}
+}
+
+// newGlyph creates the glyph of the given size, set tells which pixels of the bitmap are drawn.
+func newGlyph(width, height int, offset image.Point, advance int, set func(x, y int) bool) *glyph {
+	mask := image.NewAlpha(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if set(x, y) {
+				mask.Pix[y*mask.Stride+x] = 0xff
+			}
+		}
+	}
+
+	return &glyph{mask: mask, offset: offset, advance: advance}
+}
@@ -0,0 +1,110 @@
+package bitmapfont
+
+import (
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// the fonts in testdata are the printable ASCII characters of basicfont.Face7x13 with '?' as
+// the default character, the PCF fonts cover the byte and bit orders, paddings and scan units
+var testFonts = []string{
+	"7x13.bdf",
+	"7x13-msb.pcf",
+	"7x13-lsb.pcf.gz",
+	"7x13-msbbit-lsbbyte.pcf",
+	"7x13-lsbbit-msbbyte.pcf",
+	"7x13-pad8.pcf.gz",
+}
+
+func readTestFont(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestParse(t *testing.T) {
+	for _, name := range testFonts {
+		t.Run(name, func(t *testing.T) {
+			face, err := Parse(readTestFont(t, name))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if face.Ascent() != 11 {
+				t.Errorf("Ascent() = %d, want 11", face.Ascent())
+			}
+			if m := face.Metrics(); m.Height != fixed.I(13) || m.Descent != fixed.I(2) {
+				t.Errorf("Metrics() = %+v, want a height of 13 and a descent of 2", m)
+			}
+			for r := rune(' '); r <= '~'; r++ {
+				compareGlyph(t, face, r, r)
+			}
+		})
+	}
+}
+
+func TestFaceFallback(t *testing.T) {
+	face, err := Parse(readTestFont(t, "7x13.bdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := face.GlyphAdvance('é'); ok {
+		t.Error("GlyphAdvance() ok for a missing rune")
+	}
+	compareGlyph(t, face, 'é', '?')
+
+	face.fallback = nil
+	if _, _, _, _, ok := face.Glyph(fixed.P(0, 0), 'é'); ok {
+		t.Error("Glyph() ok for a missing rune without a default character")
+	}
+	if width := font.MeasureString(face, "ab"); width != fixed.I(14) {
+		t.Errorf("MeasureString() = %v, want 14", width)
+	}
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	if _, err := Parse([]byte("\x00\x01\x00\x00 not a bitmap font")); err != ErrUnknownFormat {
+		t.Errorf("Parse() error = %v, want ErrUnknownFormat", err)
+	}
+	if _, err := Parse([]byte{0x1f, 0x8b, 0x08}); err == nil {
+		t.Error("Parse() accepted broken gzip data")
+	}
+}
+
+// compareGlyph checks the glyph of the rune against the one of want in basicfont pixel for pixel
+func compareGlyph(t *testing.T, face *Face, r, want rune) {
+	t.Helper()
+	dot := fixed.P(10, 20)
+	dr, mask, maskp, advance, _ := face.Glyph(dot, r)
+	wantDr, wantMask, wantMaskp, wantAdvance, _ := basicfont.Face7x13.Glyph(dot, want)
+	if advance != wantAdvance {
+		t.Errorf("advance of %q = %v, want %v", r, advance, wantAdvance)
+	}
+	if mask == nil {
+		t.Errorf("no glyph for %q", r)
+		return
+	}
+	// basicfont draws every glyph in the full cell, the bitmap fonts only in their bounding box
+	for y := wantDr.Min.Y; y < wantDr.Max.Y; y++ {
+		for x := wantDr.Min.X; x < wantDr.Max.X; x++ {
+			_, _, _, a := wantMask.At(wantMaskp.X+x-wantDr.Min.X, wantMaskp.Y+y-wantDr.Min.Y).RGBA()
+			var got uint32
+			if image.Pt(x, y).In(dr) {
+				_, _, _, got = mask.At(maskp.X+x-dr.Min.X, maskp.Y+y-dr.Min.Y).RGBA()
+			}
+			if (a > 0x7fff) != (got > 0x7fff) {
+				t.Errorf("pixel (%d, %d) of %q differs", x-wantDr.Min.X, y-wantDr.Min.Y, r)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package bitmapfont
+
+import (
+	"encoding/binary"
+	"image"
+
+	"github.com/pkg/errors"
+)
+
+// pcfMagic starts the files in the Portable Compiled Format of the X server
+const pcfMagic = "\x01fcp"
+
+// table types
+const (
+	pcfAccelerators    = 1 << 1
+	pcfMetrics         = 1 << 2
+	pcfBitmaps         = 1 << 3
+	pcfBDFEncodings    = 1 << 5
+	pcfBDFAccelerators = 1 << 8
+)
+
+// format bits of the tables
+const (
+	pcfGlyphPadMask      = 3
+	pcfByteOrderMSB      = 1 << 2
+	pcfBitOrderMSB       = 1 << 3
+	pcfScanUnitMask      = 3 << 4
+	pcfCompressedMetrics = 0x100
+)
+
+// pcfTable reads the values of a table in the byte order of its format.
+type pcfTable struct {
+	data   []byte
+	format uint32
+	order  binary.ByteOrder
+	pos    int
+	err    error
+}
+
+func (t *pcfTable) next(n int) []byte {
+	switch {
+	case n < 0:
+		t.err = errors.Errorf("invalid size %d", n)
+		return nil
+	case t.err != nil || t.pos+n > len(t.data):
+		t.err = errors.New("table ends early")
+		return make([]byte, n)
+	}
+	b := t.data[t.pos : t.pos+n]
+	t.pos += n
+
+	return b
+}
+
+func (t *pcfTable) uint8() int {
+	return int(t.next(1)[0])
+}
+
+func (t *pcfTable) int16() int {
+	return int(int16(t.order.Uint16(t.next(2))))
+}
+
+func (t *pcfTable) uint16() int {
+	return int(t.order.Uint16(t.next(2)))
+}
+
+func (t *pcfTable) int32() int {
+	return int(int32(t.order.Uint32(t.next(4))))
+}
+
+// pcfMetric is the size of a glyph relative to the origin, ascent grows up
+type pcfMetric struct {
+	left, right, width, ascent, descent int
+}
+
+// ParsePCF reads a font in the Portable Compiled Format. The encodings of the glyphs are
+// taken as Unicode code points, which holds for ISO 10646 and ISO 8859-1 fonts.
+func ParsePCF(data []byte) (*Face, error) {
+	if len(data) < 8 || string(data[:4]) != pcfMagic {
+		return nil, errors.New("not a PCF font")
+	}
+	tables := map[uint32]*pcfTable{}
+	count := int(binary.LittleEndian.Uint32(data[4:]))
+	for i := 0; i < count; i++ {
+		if len(data) < 8+(i+1)*16 {
+			return nil, errors.New("table of contents ends early")
+		}
+		entry := data[8+i*16:]
+		kind := binary.LittleEndian.Uint32(entry)
+		size, offset := binary.LittleEndian.Uint32(entry[8:]), binary.LittleEndian.Uint32(entry[12:])
+		if uint64(offset)+uint64(size) > uint64(len(data)) || size < 4 {
+			return nil, errors.Errorf("table %#x is out of the file", kind)
+		}
+		table := &pcfTable{data: data[offset : offset+size], order: binary.LittleEndian}
+		// the format itself is always little endian
+		table.format = binary.LittleEndian.Uint32(table.data)
+		table.pos = 4
+		if table.format&pcfByteOrderMSB != 0 {
+			table.order = binary.BigEndian
+		}
+		tables[kind] = table
+	}
+	for _, kind := range []uint32{pcfMetrics, pcfBitmaps, pcfBDFEncodings} {
+		if tables[kind] == nil {
+			return nil, errors.Errorf("missing table %#x", kind)
+		}
+	}
+
+	metrics, err := readPCFMetrics(tables[pcfMetrics])
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read metrics")
+	}
+	glyphs, err := readPCFBitmaps(tables[pcfBitmaps], metrics)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read bitmaps")
+	}
+	face := &Face{glyphs: map[rune]*glyph{}}
+	if face.fallback, err = readPCFEncodings(tables[pcfBDFEncodings], glyphs, face.glyphs); err != nil {
+		return nil, errors.Wrap(err, "could not read encodings")
+	}
+
+	accelerators := tables[pcfBDFAccelerators]
+	if accelerators == nil {
+		accelerators = tables[pcfAccelerators]
+	}
+	if accelerators != nil {
+		// the flags come before the ascent and the descent of the font
+		accelerators.next(8)
+		face.ascent, face.descent = accelerators.int32(), accelerators.int32()
+		if accelerators.err != nil {
+			return nil, errors.Wrap(accelerators.err, "could not read accelerators")
+		}
+	} else {
+		for _, metric := range metrics {
+			if metric.ascent > face.ascent {
+				face.ascent = metric.ascent
+			}
+			if metric.descent > face.descent {
+				face.descent = metric.descent
+			}
+		}
+	}
+
+	return face, nil
+}
+
+func readPCFMetrics(t *pcfTable) ([]pcfMetric, error) {
+	compressed := t.format&pcfCompressedMetrics != 0
+	count, size := 0, 12
+	if compressed {
+		count, size = t.uint16(), 5
+	} else {
+		count = t.int32()
+	}
+	if count < 0 || count*size > len(t.data)-t.pos {
+		return nil, errors.Errorf("invalid number of glyphs %d", count)
+	}
+
+	metrics := make([]pcfMetric, count)
+	if compressed {
+		for i := range metrics {
+			m := &metrics[i]
+			m.left, m.right, m.width = t.uint8()-0x80, t.uint8()-0x80, t.uint8()-0x80
+			m.ascent, m.descent = t.uint8()-0x80, t.uint8()-0x80
+		}
+	} else {
+		for i := range metrics {
+			m := &metrics[i]
+			m.left, m.right, m.width = t.int16(), t.int16(), t.int16()
+			m.ascent, m.descent = t.int16(), t.int16()
+			// attributes
+			t.uint16()
+		}
+	}
+
+	return metrics, t.err
+}
+
+func readPCFBitmaps(t *pcfTable, metrics []pcfMetric) ([]*glyph, error) {
+	count := t.int32()
+	if count != len(metrics) {
+		return nil, errors.Errorf("%d bitmaps for %d glyphs", count, len(metrics))
+	}
+	offsets := make([]int, count)
+	for i := range offsets {
+		offsets[i] = t.int32()
+	}
+	var sizes [4]int
+	for i := range sizes {
+		if sizes[i] = t.int32(); sizes[i] < 0 {
+			return nil, errors.Errorf("invalid bitmap size %d", sizes[i])
+		}
+	}
+	pad := 1 << (t.format & pcfGlyphPadMask)
+	unit := 1 << ((t.format & pcfScanUnitMask) >> 4)
+	bitmaps := t.next(sizes[t.format&pcfGlyphPadMask])
+	if t.err != nil {
+		return nil, t.err
+	}
+	msbBits := t.format&pcfBitOrderMSB != 0
+	// bytes are swapped within the scan units when the byte order differs from the bit order
+	swap := msbBits != (t.format&pcfByteOrderMSB != 0)
+
+	glyphs := make([]*glyph, count)
+	for i, m := range metrics {
+		width, height := m.right-m.left, m.ascent+m.descent
+		if width < 0 || height < 0 {
+			return nil, errors.Errorf("glyph %d has a negative size", i)
+		}
+		stride := (width + 8*pad - 1) / (8 * pad) * pad
+		if offsets[i] < 0 || offsets[i]+stride*height > len(bitmaps) {
+			return nil, errors.Errorf("bitmap of glyph %d is out of the table", i)
+		}
+		bitmap := bitmaps[offsets[i] : offsets[i]+stride*height]
+		glyphs[i] = newGlyph(width, height, image.Pt(m.left, -m.ascent), m.width, func(x, y int) bool {
+			at := y*stride + x/8
+			if swapped := at - at%unit + unit - 1 - at%unit; swap && swapped < len(bitmap) {
+				at = swapped
+			}
+			if msbBits {
+				return bitmap[at]&(0x80>>(x%8)) != 0
+			}
+			return bitmap[at]&(1<<(x%8)) != 0
+		})
+	}
+
+	return glyphs, nil
+}
+
+// readPCFEncodings maps the encodings to the glyphs and returns the default glyph.
+func readPCFEncodings(t *pcfTable, glyphs []*glyph, encoded map[rune]*glyph) (*glyph, error) {
+	minChar, maxChar := t.int16(), t.int16()
+	minByte, maxByte := t.int16(), t.int16()
+	defaultChar := t.int16()
+	var fallback *glyph
+	for b := minByte; b <= maxByte; b++ {
+		for c := minChar; c <= maxChar; c++ {
+			index := t.uint16()
+			if t.err != nil {
+				return nil, t.err
+			}
+			if index == 0xffff || index >= len(glyphs) {
+				continue
+			}
+			encoding := b<<8 | c
+			encoded[rune(encoding)] = glyphs[index]
+			if encoding == defaultChar {
+				fallback = glyphs[index]
+			}
+		}
+	}
+
+	return fallback, nil
+}
@@ -0,0 +1,104 @@
+package bitmapfont
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// pcfTableAt returns the offset of the table of the given type in the PCF data
+func pcfTableAt(t *testing.T, data []byte, kind uint32) int {
+	t.Helper()
+	count := int(binary.LittleEndian.Uint32(data[4:]))
+	for i := 0; i < count; i++ {
+		entry := data[8+i*16:]
+		if binary.LittleEndian.Uint32(entry) == kind {
+			return int(binary.LittleEndian.Uint32(entry[12:]))
+		}
+	}
+	t.Fatalf("no table %#x", kind)
+
+	return 0
+}
+
+func TestParsePCFMalformed(t *testing.T) {
+	// the tables of 7x13-msb.pcf are big endian with the bitmaps padded to 4 bytes
+	valid := readTestFont(t, "7x13-msb.pcf")
+	bitmaps := pcfTableAt(t, valid, pcfBitmaps)
+	glyphs := int(binary.BigEndian.Uint32(valid[bitmaps+4:]))
+	sizes := bitmaps + 8 + 4*glyphs
+	metrics := pcfTableAt(t, valid, pcfMetrics)
+
+	for _, tt := range []struct {
+		name   string
+		modify func(data []byte) []byte
+		err    string
+	}{
+		{"negative bitmap size", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[sizes+4*2:], 0xfffffff0)
+			return data
+		}, "invalid bitmap size -16"},
+		{"negative unused bitmap size", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[sizes:], 0xffffffff)
+			return data
+		}, "invalid bitmap size -1"},
+		{"bitmap size beyond the table", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[sizes+4*2:], 1<<30)
+			return data
+		}, "table ends early"},
+		{"negative glyph offset", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[bitmaps+8:], 0xffffffff)
+			return data
+		}, "bitmap of glyph 0 is out of the table"},
+		{"glyph count mismatch", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[bitmaps+4:], uint32(glyphs+1))
+			return data
+		}, "96 bitmaps for 95 glyphs"},
+		{"negative glyph height", func(data []byte) []byte {
+			// the ascent of the first compressed metric
+			data[metrics+6+3] = 0
+			return data
+		}, "glyph 0 has a negative size"},
+		{"too many glyphs", func(data []byte) []byte {
+			binary.BigEndian.PutUint16(data[metrics+4:], 0xffff)
+			return data
+		}, "invalid number of glyphs"},
+		{"table out of the file", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[8+12:], uint32(len(data)))
+			return data
+		}, "is out of the file"},
+		{"table of contents ends early", func(data []byte) []byte {
+			return data[:20]
+		}, "table of contents ends early"},
+		{"missing table", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[8:], 0)
+			binary.LittleEndian.PutUint32(data[8+16:], 0)
+			binary.LittleEndian.PutUint32(data[8+32:], 0)
+			return data
+		}, "missing table"},
+		{"not a PCF font", func(data []byte) []byte {
+			return data[:4]
+		}, "not a PCF font"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.modify(append([]byte(nil), valid...))
+			_, err := ParsePCF(data)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParsePCF() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPCFTableNext(t *testing.T) {
+	table := &pcfTable{data: make([]byte, 8), order: binary.LittleEndian}
+	if b := table.next(-1); len(b) != 0 || table.err == nil {
+		t.Errorf("next(-1) = %v, %v, want an error", b, table.err)
+	}
+
+	table = &pcfTable{data: make([]byte, 8), order: binary.LittleEndian}
+	table.next(6)
+	if table.int32(); table.err == nil {
+		t.Error("reading past the end of the table did not fail")
+	}
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"weather-pi/dashboard"
+	"weather-pi/epd"
+	"weather-pi/forecast"
+	"weather-pi/history"
+	"weather-pi/metrics"
+	"weather-pi/mqtt"
+	"weather-pi/netatmo"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// daemonCmd keeps the app running and refreshes the display periodically
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "periodically refresh the display",
+	Long: `Keeps the program running, fetches the Netatmo measurements
+and redraws the e-Paper display every refresh interval. The display
+is put into deep sleep when the program receives SIGTERM or SIGINT.`,
+	Run: RunDaemon,
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+
+	daemonCmd.Flags().Duration("refreshInterval", 10*time.Minute, "how often the measurements should be fetched and the display refreshed")
+	daemonCmd.Flags().String("metricsListen", "", "address of the Prometheus /metrics endpoint (e.g. :9100, disabled when empty)")
+	daemonCmd.Flags().String("dashboardListen", "", "address of the HTTP dashboard showing the display content (e.g. :8080, disabled when empty)")
+
+	if err := viper.BindPFlag("refreshInterval", daemonCmd.Flags().Lookup("refreshInterval")); err != nil {
+		zap.S().With("err", err, "flag", "refreshInterval").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("metrics.listen", daemonCmd.Flags().Lookup("metricsListen")); err != nil {
+		zap.S().With("err", err, "flag", "metricsListen").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("dashboard.listen", daemonCmd.Flags().Lookup("dashboardListen")); err != nil {
+		zap.S().With("err", err, "flag", "dashboardListen").Fatal("could not bind flag to a config variable")
+	}
+}
+
+func RunDaemon(cmd *cobra.Command, args []string) {
+	sugaredLogger := newLogger()
+	if appConfig.RefreshInterval <= 0 {
+		sugaredLogger.With("refresh_interval", appConfig.RefreshInterval).Error("refresh interval has to be positive")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	e, err := epd.New(appConfig.Display.Model, sugaredLogger)
+	if err != nil {
+		sugaredLogger.With("err", err).Error("could not create display driver")
+		os.Exit(2)
+	}
+	if !appConfig.TestMode {
+		defer func(e epd.Display) {
+			if err := e.Close(); err != nil {
+				sugaredLogger.With("err", err).Error("could not close device")
+			}
+		}(e)
+		if err := e.Init(); err != nil {
+			sugaredLogger.With("err", err).Error("error while initializing device")
+			return
+		}
+		// the device can only be put to sleep once it has been initialized
+		defer func(e epd.Display) {
+			sugaredLogger.Info("putting the device to sleep")
+			if err := e.Sleep(); err != nil {
+				sugaredLogger.With("err", err).Error("could not put the device to sleep")
+			}
+		}(e)
+
+		if err := e.Clear(); err != nil {
+			sugaredLogger.With("err", err).Error("error while clearing the device screen")
+			return
+		}
+	}
+
+	source, err := newDataSource(sugaredLogger)
+	if err != nil {
+		sugaredLogger.With("err", err).Error("could not create data source")
+		return
+	}
+	d := &daemon{log: sugaredLogger, display: e, source: source, forecast: openForecast(sugaredLogger)}
+
+	d.publisher, err = newPublisher(sugaredLogger)
+	if err != nil {
+		// the display is more important than the home automation so keep running without it
+		sugaredLogger.With("err", err).Error("could not connect to MQTT broker, measurements will not be published")
+	}
+	if d.publisher != nil {
+		defer d.publisher.Close()
+	}
+	d.history, err = openHistory()
+	if err != nil {
+		sugaredLogger.With("err", err).Error("could not open history, readings will not be recorded")
+	}
+	if d.history != nil {
+		defer d.history.Close()
+	}
+
+	// dashboard and metrics share a server when they are configured with the same address
+	handlers := map[string]*http.ServeMux{}
+	handle := func(address, pattern string, handler http.Handler) {
+		if handlers[address] == nil {
+			handlers[address] = http.NewServeMux()
+		}
+		handlers[address].Handle(pattern, handler)
+	}
+	if appConfig.Dashboard.Listen != "" {
+		d.dashboard = dashboard.New(sugaredLogger)
+		handle(appConfig.Dashboard.Listen, "/", d.dashboard.Handler())
+	}
+	if appConfig.Metrics.Listen != "" {
+		d.readings = metrics.NewReadings(appConfig.ModuleMaxAge)
+		prometheus.MustRegister(d.readings)
+		handle(appConfig.Metrics.Listen, "/metrics", metrics.Handler())
+	}
+	for address, mux := range handlers {
+		server := &http.Server{Addr: address, Handler: mux}
+		go func() {
+			sugaredLogger.With("address", server.Addr).Info("starting HTTP server")
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				sugaredLogger.With("err", err, "address", server.Addr).Error("could not start HTTP server")
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				sugaredLogger.With("err", err, "address", server.Addr).Error("could not shut down HTTP server")
+			}
+		}()
+	}
+
+	sugaredLogger.With("refresh_interval", appConfig.RefreshInterval).Info("starting refresh loop")
+	ticker := time.NewTicker(appConfig.RefreshInterval)
+	defer ticker.Stop()
+	for page := 0; ; page++ {
+		if err := d.refresh(ctx, page); err != nil {
+			sugaredLogger.With("err", err).Error("could not refresh the display")
+		}
+
+		select {
+		case <-ctx.Done():
+			sugaredLogger.Info("received shutdown signal")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// daemon holds everything that is reused between refreshes
+type daemon struct {
+	log      *zap.SugaredLogger
+	display  epd.Display
+	source   netatmo.DataSource
+	forecast forecast.Provider
+	// dashboard, readings, publisher and history are nil when they are disabled
+	dashboard *dashboard.Dashboard
+	readings  *metrics.Readings
+	publisher *mqtt.Publisher
+	history   *history.Store
+}
+
+func (d *daemon) refresh(ctx context.Context, page int) error {
+	start := time.Now()
+	data, err := fetchMeasurements(ctx, d.log, d.source, d.history)
+	if err != nil {
+		return err
+	}
+	if d.readings != nil {
+		d.readings.Update(data)
+	}
+	if d.publisher != nil {
+		publishMeasurements(d.log, d.publisher, data)
+	}
+	days := fetchForecast(ctx, d.log, d.forecast)
+
+	bImage, rImage, err := renderImages(d.log, epd.Horizontal(d.display.Bounds()), data, days, page)
+	if err != nil {
+		return err
+	}
+	if d.dashboard != nil {
+		if err := d.dashboard.Update(bImage, rImage, data); err != nil {
+			d.log.With("err", err).Warn("could not update dashboard")
+		}
+	}
+	bImage, rImage, err = orientImages(bImage, rImage)
+	if err != nil {
+		return err
+	}
+
+	if appConfig.TestMode {
+		err = writeTestImages(d.log, bImage, rImage)
+	} else {
+		err = displayImages(d.log, d.display, bImage, rImage)
+	}
+	if err != nil {
+		return err
+	}
+	if d.readings != nil {
+		metrics.RefreshDuration.Observe(time.Since(start).Seconds())
+		metrics.LastDisplayUpdate.SetToCurrentTime()
+	}
+	d.log.With("duration", time.Since(start)).Info("display refreshed")
+
+	return nil
+}
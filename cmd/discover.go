@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+	"weather-pi/internal"
+	"weather-pi/netatmo"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// discoverCmd lists what the account has access to so the sources do not have to be guessed
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "list the stations and modules available to the account",
+	Long: `Fetches the stations data and prints the homes, base stations and modules
+with their types, IDs, battery levels and the time they were last seen.
+With --sources a Sources block selecting all of them is printed instead,
+ready to be pasted into the config file.`,
+	Run: RunDiscover,
+}
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+func init() {
+	rootCmd.AddCommand(discoverCmd)
+
+	discoverCmd.Flags().StringP("output", "o", outputTable, fmt.Sprintf("output format (%s, %s or %s)", outputTable, outputJSON, outputYAML))
+	discoverCmd.Flags().Bool("sources", false, "print a Sources block for the config file")
+}
+
+func RunDiscover(cmd *cobra.Command, args []string) {
+	sugaredLogger := newLogger()
+	output, _ := cmd.Flags().GetString("output")
+	sources, _ := cmd.Flags().GetBool("sources")
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	source, err := newDataSource(sugaredLogger)
+	if err != nil {
+		sugaredLogger.With("err", err).Error("could not create data source")
+		os.Exit(3)
+	}
+	stations, err := netatmo.Discover(ctx, source)
+	if err != nil {
+		sugaredLogger.With("err", err).Error("could not discover stations")
+		os.Exit(3)
+	}
+
+	if sources {
+		err = writeSources(os.Stdout, stations)
+	} else {
+		err = writeStations(os.Stdout, stations, output)
+	}
+	if err != nil {
+		sugaredLogger.With("err", err).Error("could not print stations")
+		os.Exit(1)
+	}
+}
+
+func writeStations(w io.Writer, stations []netatmo.StationInfo, output string) error {
+	switch output {
+	case outputTable:
+		return writeStationsTable(w, stations)
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return errors.Wrap(encoder.Encode(stations), "could not encode stations")
+	case outputYAML:
+		return errors.Wrap(yaml.NewEncoder(w).Encode(stations), "could not encode stations")
+	default:
+		return errors.Errorf("unknown output format %q", output)
+	}
+}
+
+func writeStationsTable(w io.Writer, stations []netatmo.StationInfo) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "HOME\tNAME\tTYPE\tID\tBATTERY\tREACHABLE\tLAST SEEN")
+	for _, station := range stations {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%t\t%s\n",
+			station.Home, station.Name, station.Type, station.Id, "-", station.Reachable, formatLastSeen(station.LastSeen))
+		for _, module := range station.Modules {
+			fmt.Fprintf(table, "%s\t  %s\t%s\t%s\t%s\t%t\t%s\n",
+				station.Home, module.Name, module.Type, module.Id, strconv.FormatInt(module.Battery, 10)+"%", module.Reachable, formatLastSeen(module.LastSeen))
+		}
+	}
+
+	return errors.Wrap(table.Flush(), "could not write table")
+}
+
+// writeSources prints the config selecting all the stations and their modules by ID
+func writeSources(w io.Writer, stations []netatmo.StationInfo) error {
+	config := struct {
+		Sources []internal.Source `yaml:"Sources"`
+	}{}
+	for _, station := range stations {
+		config.Sources = append(config.Sources, station.Source())
+	}
+
+	return errors.Wrap(yaml.NewEncoder(w).Encode(config), "could not encode sources")
+}
+
+func formatLastSeen(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format("2006-01-02 15:04")
+}
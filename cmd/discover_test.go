@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"weather-pi/internal"
+	"weather-pi/netatmo"
+	"weather-pi/netatmo/netatmotest"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// discoverStations lists the stations of the test server through the configured data source
+func discoverStations(t *testing.T) []netatmo.StationInfo {
+	t.Helper()
+	server := netatmotest.NewServer(nil)
+	t.Cleanup(server.Close)
+	setConfig(t, internal.Config{
+		ClientId:     netatmotest.ClientID,
+		ClientSecret: netatmotest.ClientSecret,
+		Token:        netatmotest.InitialAccessToken,
+		RefreshToken: netatmotest.InitialRefreshToken,
+		TokenExpiry:  time.Now().Add(time.Hour).Format(time.RFC3339),
+		TokenFile:    filepath.Join(t.TempDir(), "token.json"),
+		APIURL:       server.URL,
+	})
+
+	source, err := newDataSource(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("newDataSource() error = %v", err)
+	}
+	stations, err := netatmo.Discover(context.Background(), source)
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	return stations
+}
+
+var discoveredIDs = []string{"70:ee:50:00:00:01", "02:00:00:00:00:01", "03:00:00:00:00:01", "05:00:00:00:00:01", "06:00:00:00:00:01"}
+
+func TestWriteStationsTable(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeStations(&out, discoverStations(t), outputTable); err != nil {
+		t.Fatalf("writeStations() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("table = %q, want the header, the station and 4 modules", out.String())
+	}
+	if fields := strings.Fields(lines[0]); fields[0] != "HOME" || fields[len(fields)-2] != "LAST" {
+		t.Errorf("header = %q", lines[0])
+	}
+	// the station has no battery, the modules are listed below it
+	for i, want := range []string{"Living room NAMain", "Outdoor NAModule1", "Bedroom NAModule4", "Rain gauge NAModule3", "Wind gauge NAModule2"} {
+		line := strings.Join(strings.Fields(lines[i+1]), " ")
+		if !strings.Contains(line, want+" "+discoveredIDs[i]) {
+			t.Errorf("line %d = %q, want %s %s", i+1, line, want, discoveredIDs[i])
+		}
+	}
+	if line := strings.Join(strings.Fields(lines[1]), " "); !strings.Contains(line, discoveredIDs[0]+" - true") {
+		t.Errorf("station line = %q, want no battery", line)
+	}
+	if line := strings.Join(strings.Fields(lines[2]), " "); !strings.Contains(line, discoveredIDs[1]+" 74% true") {
+		t.Errorf("outdoor line = %q, want its battery", line)
+	}
+}
+
+func TestWriteStationsEncoded(t *testing.T) {
+	stations := discoverStations(t)
+	for _, tt := range []struct {
+		output string
+		decode func(data []byte, v interface{}) error
+	}{
+		{output: outputJSON, decode: json.Unmarshal},
+		{output: outputYAML, decode: yaml.Unmarshal},
+	} {
+		var out bytes.Buffer
+		if err := writeStations(&out, stations, tt.output); err != nil {
+			t.Fatalf("writeStations(%s) error = %v", tt.output, err)
+		}
+		var decoded []netatmo.StationInfo
+		if err := tt.decode(out.Bytes(), &decoded); err != nil {
+			t.Fatalf("could not decode %s output: %v", tt.output, err)
+		}
+		if len(decoded) != 1 || len(decoded[0].Modules) != 4 {
+			t.Fatalf("%s output = %+v, want a station with 4 modules", tt.output, decoded)
+		}
+		ids := []string{decoded[0].Id}
+		for _, module := range decoded[0].Modules {
+			ids = append(ids, module.Id)
+		}
+		if !reflect.DeepEqual(ids, discoveredIDs) {
+			t.Errorf("%s output IDs = %v, want %v", tt.output, ids, discoveredIDs)
+		}
+		if !decoded[0].LastSeen.Equal(stations[0].LastSeen) || decoded[0].Modules[0].Battery != 74 {
+			t.Errorf("%s output = %+v, want %+v", tt.output, decoded[0], stations[0])
+		}
+	}
+
+	if err := writeStations(&bytes.Buffer{}, stations, "xml"); err == nil {
+		t.Error("writeStations() succeeded with an unknown output format")
+	}
+}
+
+func TestWriteSources(t *testing.T) {
+	stations := discoverStations(t)
+	var out bytes.Buffer
+	if err := writeSources(&out, stations); err != nil {
+		t.Fatalf("writeSources() error = %v", err)
+	}
+
+	var config internal.Config
+	if err := yaml.Unmarshal(out.Bytes(), &config); err != nil {
+		t.Fatalf("could not decode sources: %v", err)
+	}
+	if len(config.Sources) != 1 || config.Sources[0].StationName != "Home" || config.Sources[0].DeviceId != discoveredIDs[0] {
+		t.Fatalf("sources = %+v", config.Sources)
+	}
+
+	// the printed block selects the station and every module when pasted into the config
+	source, err := newDataSource(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("newDataSource() error = %v", err)
+	}
+	measurements, err := netatmo.FetchData(context.Background(), zap.NewNop().Sugar(), source, config.Sources, time.Now())
+	if err != nil {
+		t.Fatalf("FetchData() error = %v", err)
+	}
+	var names []string
+	for _, reading := range measurements[0].Readings() {
+		names = append(names, reading.Name)
+	}
+	if want := []string{"Living room", "Outdoor", "Bedroom", "Rain gauge", "Wind gauge"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("selected readings = %v, want %v", names, want)
+	}
+}
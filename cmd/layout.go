@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"os"
+	"weather-pi/ui"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// layoutCmd prints the default layout as a starting point for the layout file
+var layoutCmd = &cobra.Command{
+	Use:   "layout",
+	Short: "print the default layout of the panes",
+	Long: `Prints the widgets of the default pane layout in the format of the
+layout file. Save the output, change the widgets and pass the file
+with --layoutFile to draw the panes with them.`,
+	Run: RunLayout,
+}
+
+func init() {
+	rootCmd.AddCommand(layoutCmd)
+}
+
+func RunLayout(cmd *cobra.Command, args []string) {
+	sugaredLogger := newLogger()
+	if err := yaml.NewEncoder(os.Stdout).Encode(ui.DefaultLayout); err != nil {
+		sugaredLogger.With("err", err).Error("could not print layout")
+		os.Exit(1)
+	}
+}
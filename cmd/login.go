@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"weather-pi/netatmo"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// loginCmd obtains the first OAuth tokens so they do not have to be copied from the Netatmo dev portal
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "authorize the app to read the Netatmo weather station",
+	Long: `Starts the OAuth authorization code flow. Open the printed URL,
+authorize the app and the browser is redirected to a local listener
+which exchanges the code for tokens and saves them to the token file.
+The redirect URI of the Netatmo app has to point to the listener
+(http://localhost:8765/callback by default).`,
+	Run: RunLogin,
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+
+	loginCmd.Flags().String("callbackListen", "localhost:8765", "address the OAuth callback listener is bound to")
+	loginCmd.Flags().Duration("loginTimeout", 5*time.Minute, "how long to wait for the authorization")
+
+	if err := viper.BindPFlag("login.callbackListen", loginCmd.Flags().Lookup("callbackListen")); err != nil {
+		zap.S().With("err", err, "flag", "callbackListen").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("login.timeout", loginCmd.Flags().Lookup("loginTimeout")); err != nil {
+		zap.S().With("err", err, "flag", "loginTimeout").Fatal("could not bind flag to a config variable")
+	}
+}
+
+func RunLogin(cmd *cobra.Command, args []string) {
+	sugaredLogger := newLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, appConfig.Login.Timeout)
+	defer cancel()
+
+	token, err := netatmo.Login(ctx, sugaredLogger, appConfig.ClientId, appConfig.ClientSecret, appConfig.Login.CallbackListen, appConfig.APIURL, func(authURL string) {
+		fmt.Println("Open the following URL in a browser and authorize the app:")
+		fmt.Println(authURL)
+	})
+	if err != nil {
+		sugaredLogger.With("err", err).Error("could not log in")
+		os.Exit(3)
+	}
+
+	store := newTokenStore()
+	if err := store.Save(token); err != nil {
+		sugaredLogger.With("err", err).Error("could not save OAuth tokens")
+		os.Exit(5)
+	}
+	sugaredLogger.With("token_file", appConfig.TokenFile, "expiry", token.Expiry).Info("OAuth tokens have been saved")
+}
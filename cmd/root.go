@@ -23,18 +23,29 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"image"
+	"image/draw"
 	"image/png"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 	"weather-pi/epd"
+	"weather-pi/forecast"
+	"weather-pi/history"
 	"weather-pi/internal"
+	"weather-pi/mqtt"
 	"weather-pi/netatmo"
+	"weather-pi/tokenstore"
 	"weather-pi/ui"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/oauth2"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
@@ -70,10 +81,30 @@ func init() {
 	rootCmd.PersistentFlags().String("secret", "", "secret used to connect to the Netatmo API")
 	rootCmd.PersistentFlags().String("token", "", "OAuth token generated for the API")
 	rootCmd.PersistentFlags().String("refreshToken", "", "OAuth refresh token generated for the API")
+	rootCmd.PersistentFlags().String("tokenFile", tokenstore.DefaultPath, "file where the rotated OAuth tokens are kept")
 	rootCmd.PersistentFlags().Bool("testMode", false, "run the app in test mode (output test image without connecting to a device")
 	rootCmd.PersistentFlags().String("logLevel", "info", "logger log level")
 	rootCmd.PersistentFlags().Bool("rotate180", false, "should image be rotated 180 degrees")
 	rootCmd.PersistentFlags().Duration("timeWindow", 2*time.Hour, "how large would be the time window to fetch measurements (min/max)")
+	rootCmd.PersistentFlags().String("replayFile", "", "replay stations data from a recorded getstationsdata response instead of calling the Netatmo API")
+	rootCmd.PersistentFlags().String("apiURL", "", "base URL of the Netatmo API (e.g. a local stand-in server)")
+	rootCmd.PersistentFlags().String("cacheFile", netatmo.DefaultCachePath, "file keeping the last fetched measurements shown when the API is not reachable (disabled when empty)")
+	rootCmd.PersistentFlags().Duration("staleAfter", 30*time.Minute, "age of the newest reading after which the data is marked as stale (disabled when zero)")
+	rootCmd.PersistentFlags().Duration("moduleMaxAge", time.Hour, "age of a module reading after which the module is flagged as not reporting (disabled when zero)")
+	rootCmd.PersistentFlags().String("historyFile", "", fmt.Sprintf("SQLite database keeping every reading for trends (e.g. %s, disabled when empty)", history.DefaultPath))
+	rootCmd.PersistentFlags().Duration("historyRetention", history.DefaultPolicy.Retention, "how long the hourly averages of the readings are kept in the history")
+	rootCmd.PersistentFlags().Int("retryAttempts", netatmo.DefaultRetryPolicy.Attempts, "how many times a failed Netatmo request is tried")
+	rootCmd.PersistentFlags().Duration("requestTimeout", netatmo.DefaultRetryPolicy.RequestTimeout, "how long a single try of a Netatmo request can take")
+	rootCmd.PersistentFlags().Int("panesPerPage", ui.DefaultPanesPerPage, "how many readings are shown on the screen at once (the rest is shown on the next pages)")
+	rootCmd.PersistentFlags().String("stationLayout", string(ui.RotateStations), fmt.Sprintf("how several stations are shown (%q pages or a compact %q)", ui.RotateStations, ui.GridStations))
+	rootCmd.PersistentFlags().String("layoutFile", "", "YAML file with the widgets drawn in the panes (the default layout when empty, see the layout command)")
+	rootCmd.PersistentFlags().String("valueFont", "", fmt.Sprintf("font of the values, one of %v or the path of a TTF, OTF, BDF or PCF file (%s when empty)", ui.EmbeddedFonts(), ui.DefaultFont))
+	rootCmd.PersistentFlags().String("labelFont", "", "font of the labels and the module names, like valueFont")
+	rootCmd.PersistentFlags().String("statusFont", "", "font of the status line, the header and the tags, like valueFont")
+	rootCmd.PersistentFlags().Float64("fontDPI", 0, "resolution the font sizes are converted to pixels with (the resolution of the 2.13\" display when zero)")
+	rootCmd.PersistentFlags().String("displayModel", epd.Model2in13v3, fmt.Sprintf("model of the connected display (one of %v)", epd.Models()))
+	rootCmd.PersistentFlags().String("mqttBroker", "", "address of the MQTT broker the readings are published to (e.g. tcp://localhost:1883, disabled when empty)")
+	rootCmd.PersistentFlags().String("forecastProvider", "", fmt.Sprintf("where the forecast is fetched from (%q or empty to disable it)", forecastOpenMeteo))
 
 	if err := viper.BindPFlag("clientId", rootCmd.PersistentFlags().Lookup("clientId")); err != nil {
 		zap.S().With("err", err, "flag", "clientId").Fatal("could not bind flag to a config variable")
@@ -87,6 +118,9 @@ func init() {
 	if err := viper.BindPFlag("refreshToken", rootCmd.PersistentFlags().Lookup("refreshToken")); err != nil {
 		zap.S().With("err", err, "flag", "token").Fatal("could not bind flag to a config variable")
 	}
+	if err := viper.BindPFlag("tokenFile", rootCmd.PersistentFlags().Lookup("tokenFile")); err != nil {
+		zap.S().With("err", err, "flag", "tokenFile").Fatal("could not bind flag to a config variable")
+	}
 	if err := viper.BindPFlag("logLevel", rootCmd.PersistentFlags().Lookup("logLevel")); err != nil {
 		zap.S().With("err", err, "flag", "logLevel").Fatal("could not bind flag to a config variable")
 	}
@@ -99,6 +133,63 @@ func init() {
 	if err := viper.BindPFlag("timeWindow", rootCmd.PersistentFlags().Lookup("timeWindow")); err != nil {
 		zap.S().With("err", err, "flag", "timeWindow").Fatal("could not bind flag to a config variable")
 	}
+	if err := viper.BindPFlag("replayFile", rootCmd.PersistentFlags().Lookup("replayFile")); err != nil {
+		zap.S().With("err", err, "flag", "replayFile").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("apiURL", rootCmd.PersistentFlags().Lookup("apiURL")); err != nil {
+		zap.S().With("err", err, "flag", "apiURL").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("cacheFile", rootCmd.PersistentFlags().Lookup("cacheFile")); err != nil {
+		zap.S().With("err", err, "flag", "cacheFile").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("staleAfter", rootCmd.PersistentFlags().Lookup("staleAfter")); err != nil {
+		zap.S().With("err", err, "flag", "staleAfter").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("moduleMaxAge", rootCmd.PersistentFlags().Lookup("moduleMaxAge")); err != nil {
+		zap.S().With("err", err, "flag", "moduleMaxAge").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("history.file", rootCmd.PersistentFlags().Lookup("historyFile")); err != nil {
+		zap.S().With("err", err, "flag", "historyFile").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("history.retention", rootCmd.PersistentFlags().Lookup("historyRetention")); err != nil {
+		zap.S().With("err", err, "flag", "historyRetention").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("retry.attempts", rootCmd.PersistentFlags().Lookup("retryAttempts")); err != nil {
+		zap.S().With("err", err, "flag", "retryAttempts").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("retry.requestTimeout", rootCmd.PersistentFlags().Lookup("requestTimeout")); err != nil {
+		zap.S().With("err", err, "flag", "requestTimeout").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("panesPerPage", rootCmd.PersistentFlags().Lookup("panesPerPage")); err != nil {
+		zap.S().With("err", err, "flag", "panesPerPage").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("stationLayout", rootCmd.PersistentFlags().Lookup("stationLayout")); err != nil {
+		zap.S().With("err", err, "flag", "stationLayout").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("layoutFile", rootCmd.PersistentFlags().Lookup("layoutFile")); err != nil {
+		zap.S().With("err", err, "flag", "layoutFile").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("fonts.value", rootCmd.PersistentFlags().Lookup("valueFont")); err != nil {
+		zap.S().With("err", err, "flag", "valueFont").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("fonts.label", rootCmd.PersistentFlags().Lookup("labelFont")); err != nil {
+		zap.S().With("err", err, "flag", "labelFont").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("fonts.status", rootCmd.PersistentFlags().Lookup("statusFont")); err != nil {
+		zap.S().With("err", err, "flag", "statusFont").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("fonts.dpi", rootCmd.PersistentFlags().Lookup("fontDPI")); err != nil {
+		zap.S().With("err", err, "flag", "fontDPI").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("display.model", rootCmd.PersistentFlags().Lookup("displayModel")); err != nil {
+		zap.S().With("err", err, "flag", "displayModel").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("mqtt.broker", rootCmd.PersistentFlags().Lookup("mqttBroker")); err != nil {
+		zap.S().With("err", err, "flag", "mqttBroker").Fatal("could not bind flag to a config variable")
+	}
+	if err := viper.BindPFlag("forecast.provider", rootCmd.PersistentFlags().Lookup("forecastProvider")); err != nil {
+		zap.S().With("err", err, "flag", "forecastProvider").Fatal("could not bind flag to a config variable")
+	}
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -134,7 +225,7 @@ func initConfig() {
 	}
 }
 
-func RunApp(cmd *cobra.Command, args []string) {
+func newLogger() *zap.SugaredLogger {
 	config := zap.NewDevelopmentConfig()
 	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	logLevel := zap.NewAtomicLevel()
@@ -142,107 +233,394 @@ func RunApp(cmd *cobra.Command, args []string) {
 	config.OutputPaths = []string{"stdout"}
 	config.ErrorOutputPaths = []string{"stderr"}
 	logger, _ := config.Build()
-	sugaredLogger := logger.Sugar()
 	if err := logLevel.UnmarshalText([]byte(appConfig.LogLevel)); err != nil {
 		logLevel.SetLevel(zap.InfoLevel)
 	}
 
-	tm := time.Now().UTC().Add(-appConfig.TimeWindow)
-	var tokenExpiry time.Time
-	if appConfig.TokenExpiry == "" {
-		tokenExpiry = time.Now()
-	} else {
-		var err error
-		tokenExpiry, err = time.Parse(time.RFC3339, appConfig.TokenExpiry)
-		if err != nil {
-			sugaredLogger.With("err", err).Error("could not parse token expiration time")
-			os.Exit(4)
-		}
+	return logger.Sugar()
+}
+
+func RunApp(cmd *cobra.Command, args []string) {
+	sugaredLogger := newLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	source, err := newDataSource(sugaredLogger)
+	if err != nil {
+		sugaredLogger.With("err", err).Error("could not create data source")
+		os.Exit(3)
+	}
+	store, err := openHistory()
+	if err != nil {
+		sugaredLogger.With("err", err).Error("could not open history, readings will not be recorded")
 	}
-	data, err := netatmo.FetchData(sugaredLogger, appConfig.Sources, appConfig.ClientId, appConfig.ClientSecret, appConfig.Token, appConfig.RefreshToken, tokenExpiry, tm)
+	if store != nil {
+		defer store.Close()
+	}
+	data, err := fetchMeasurements(ctx, sugaredLogger, source, store)
 	if err != nil {
 		sugaredLogger.With("err", err).Error("could not fetch data")
 		os.Exit(3)
 	}
+	publisher, err := newPublisher(sugaredLogger)
+	if err != nil {
+		sugaredLogger.With("err", err).Error("could not connect to MQTT broker")
+	} else if publisher != nil {
+		publishMeasurements(sugaredLogger, publisher, data)
+		publisher.Disconnect()
+	}
+	days := fetchForecast(ctx, sugaredLogger, openForecast(sugaredLogger))
 
-	e := epd.NewEpd2in13v3(sugaredLogger)
-	bImage, rImage, err := ui.BuildGUI(sugaredLogger, e.BoundsHorizontal(), data)
+	e, err := epd.New(appConfig.Display.Model, sugaredLogger)
+	if err != nil {
+		sugaredLogger.With("err", err).Error("could not create display driver")
+		os.Exit(2)
+	}
+	bImage, rImage, err := renderImages(sugaredLogger, epd.Horizontal(e.Bounds()), data, days, pageAt(time.Now(), appConfig.RefreshInterval))
+	if err == nil {
+		bImage, rImage, err = orientImages(bImage, rImage)
+	}
 	if err != nil {
 		sugaredLogger.With("err", err).Error("could not generate UI")
 		os.Exit(4)
 	}
 
-	if appConfig.Rotate180 {
-		bImage, err = ui.RotateImage(bImage)
+	if appConfig.TestMode {
+		if err := writeTestImages(sugaredLogger, bImage, rImage); err != nil {
+			sugaredLogger.With("err", err).Error("could not write test images")
+			os.Exit(5)
+		}
+	} else {
+		defer func(e epd.Display) {
+			if err := e.Close(); err != nil {
+				sugaredLogger.With("err", err).Error("could not close device")
+			}
+		}(e)
+		err := e.Init()
 		if err != nil {
-			sugaredLogger.With("err", err).Fatal("could not rotate black image")
+			sugaredLogger.With("err", err).Fatal("error while initializing device")
 		}
 
-		rImage, err = ui.RotateImage(rImage)
+		err = e.Clear()
 		if err != nil {
-			sugaredLogger.With("err", err).Fatal("could not rotate red image")
+			sugaredLogger.With("err", err).Fatal("error while clearing the device screen")
+		}
+
+		if err := displayImages(sugaredLogger, e, bImage, rImage); err != nil {
+			sugaredLogger.With("err", err).Fatal("could not display GUI")
 		}
 	}
+}
 
-	if appConfig.TestMode {
-		bFile, err := os.OpenFile("out_test_b.png", os.O_WRONLY|os.O_CREATE, 0666)
+func newDataSource(logger *zap.SugaredLogger) (netatmo.DataSource, error) {
+	if appConfig.ReplayFile != "" {
+		logger.With("file", appConfig.ReplayFile).Info("replaying recorded stations data")
+		return netatmo.NewFileSource(appConfig.ReplayFile), nil
+	}
+
+	store := newTokenStore()
+	token, err := store.Load()
+	if errors.Is(err, tokenstore.ErrNotFound) {
+		// tokens from the config are only used until they are rotated for the first time
+		logger.Info("no stored OAuth token, using the one from the config")
+		token, err = configToken()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	retry := netatmo.RetryPolicy{
+		Attempts:       appConfig.Retry.Attempts,
+		InitialBackoff: appConfig.Retry.InitialBackoff,
+		MaxBackoff:     appConfig.Retry.MaxBackoff,
+		RequestTimeout: appConfig.Retry.RequestTimeout,
+	}
+
+	return netatmo.NewAPISource(logger, appConfig.ClientId, appConfig.ClientSecret, token, store, appConfig.APIURL, retry)
+}
+
+func newTokenStore() tokenstore.Store {
+	return tokenstore.NewFileStore(appConfig.TokenFile)
+}
+
+func configToken() (*oauth2.Token, error) {
+	var tokenExpiry time.Time
+	if appConfig.TokenExpiry == "" {
+		tokenExpiry = time.Now()
+	} else {
+		var err error
+		tokenExpiry, err = time.Parse(time.RFC3339, appConfig.TokenExpiry)
 		if err != nil {
-			sugaredLogger.With("err", err).Error("could not open test file for write")
-			os.Exit(5)
+			return nil, errors.Wrap(err, "could not parse token expiration time")
 		}
-		defer func(file *os.File) {
-			err := file.Close()
-			if err != nil {
-				sugaredLogger.With("err", err).Error("could not close a file")
-			}
-		}(bFile)
-		err = png.Encode(bFile, bImage)
+	}
+
+	return &oauth2.Token{AccessToken: appConfig.Token, RefreshToken: appConfig.RefreshToken, Expiry: tokenExpiry}, nil
+}
+
+// fetchMeasurements warns about the modules which stopped reporting, also when the
+// measurements come from the cache, and records them in the history when it is enabled
+func fetchMeasurements(ctx context.Context, logger *zap.SugaredLogger, source netatmo.DataSource, store *history.Store) ([]netatmo.Measurement, error) {
+	data, err := fetchOrLoadMeasurements(ctx, logger, source)
+	if err != nil {
+		return nil, err
+	}
+	netatmo.WarnStale(logger, data, time.Now(), appConfig.ModuleMaxAge)
+	if store != nil {
+		recordHistory(ctx, logger, store, data)
+	}
+
+	return data, nil
+}
+
+// openHistory returns nil when the history is disabled
+func openHistory() (*history.Store, error) {
+	if appConfig.History.File == "" {
+		return nil, nil
+	}
+
+	return history.Open(appConfig.History.File, history.Policy{
+		RawRetention: appConfig.History.RawRetention,
+		Retention:    appConfig.History.Retention,
+	})
+}
+
+// recordHistory appends the readings to the history and fills in the trends the Netatmo API
+// did not return (e.g. when getmeasure is rate limited). The history is optional so failures
+// are only logged.
+func recordHistory(ctx context.Context, logger *zap.SugaredLogger, store *history.Store, data []netatmo.Measurement) {
+	now := time.Now()
+	if err := store.Append(ctx, data); err != nil {
+		logger.With("err", err).Warn("could not record readings in the history")
+	}
+	if err := store.Compact(ctx, now); err != nil {
+		logger.With("err", err).Warn("could not compact the history")
+	}
+
+	since := now.Add(-appConfig.TimeWindow)
+	fill := func(reading *netatmo.Reading) {
+		if !reading.Type.HasTemperature() || len(reading.History) > 0 {
+			return
+		}
+		samples, err := store.Samples(ctx, reading.Module, since)
 		if err != nil {
-			sugaredLogger.With("err", err).Error("could not encode the output file")
+			logger.With("err", err, "name", reading.Name).Warn("could not read temperature history")
+			return
+		}
+		logger.With("name", reading.Name, "num", len(samples)).Debug("using temperature history from the local history")
+		reading.History = samples
+	}
+	for i := range data {
+		if data[i].StationReading != nil {
+			fill(data[i].StationReading)
+		}
+		for j := range data[i].ModuleReadings {
+			fill(&data[i].ModuleReadings[j])
 		}
+	}
+}
 
-		rFile, err := os.OpenFile("out_test_r.png", os.O_WRONLY|os.O_CREATE, 0666)
-		if err != nil {
-			sugaredLogger.With("err", err).Error("could not open test file for write")
-			os.Exit(5)
+// fetchOrLoadMeasurements falls back to the cached measurements when they cannot be fetched
+func fetchOrLoadMeasurements(ctx context.Context, logger *zap.SugaredLogger, source netatmo.DataSource) ([]netatmo.Measurement, error) {
+	tm := time.Now().UTC().Add(-appConfig.TimeWindow)
+
+	data, err := netatmo.FetchData(ctx, logger, source, appConfig.Sources, tm)
+	if appConfig.CacheFile == "" {
+		return data, err
+	}
+	cache := netatmo.NewCache(appConfig.CacheFile)
+	if err != nil {
+		cached, fetchedAt, cacheErr := cache.Load()
+		if cacheErr != nil {
+			logger.With("err", cacheErr, "cache_file", appConfig.CacheFile).Warn("could not load cached measurements")
+			return nil, err
 		}
-		defer func(file *os.File) {
-			err := file.Close()
-			if err != nil {
-				sugaredLogger.With("err", err).Error("could not close a file")
-			}
-		}(rFile)
-		err = png.Encode(rFile, rImage)
-		if err != nil {
-			sugaredLogger.With("err", err).Error("could not encode the output file")
+		logger.With("err", err, "fetched_at", fetchedAt).Warn("could not fetch data, using cached measurements")
+		return cached, nil
+	}
+	if err := cache.Save(data); err != nil {
+		logger.With("err", err, "cache_file", appConfig.CacheFile).Warn("could not cache measurements")
+	}
+
+	return data, nil
+}
+
+// newPublisher returns nil when publishing to MQTT is disabled
+func newPublisher(logger *zap.SugaredLogger) (*mqtt.Publisher, error) {
+	if appConfig.MQTT.Broker == "" {
+		return nil, nil
+	}
+
+	return mqtt.NewPublisher(logger, mqtt.Options{
+		Broker:          appConfig.MQTT.Broker,
+		ClientID:        appConfig.MQTT.ClientID,
+		Username:        appConfig.MQTT.Username,
+		Password:        appConfig.MQTT.Password,
+		TopicPrefix:     appConfig.MQTT.TopicPrefix,
+		DiscoveryPrefix: appConfig.MQTT.DiscoveryPrefix,
+	})
+}
+
+// publishMeasurements only logs failures as publishing should not prevent the display refresh
+func publishMeasurements(logger *zap.SugaredLogger, publisher *mqtt.Publisher, data []netatmo.Measurement) {
+	if err := publisher.Publish(data); err != nil {
+		logger.With("err", err).Warn("could not publish measurements to MQTT")
+	}
+}
+
+// forecastOpenMeteo is the name of the Open-Meteo forecast provider in the config
+const forecastOpenMeteo = "open-meteo"
+
+// newForecastProvider returns nil when the forecast is disabled
+func newForecastProvider() (forecast.Provider, error) {
+	switch appConfig.Forecast.Provider {
+	case "":
+		return nil, nil
+	case forecastOpenMeteo:
+		// zero is a valid coordinate so a missing one cannot be told from the value
+		if !viper.IsSet("forecast.latitude") || !viper.IsSet("forecast.longitude") {
+			return nil, errors.New("the forecast location needs Forecast.Latitude and Forecast.Longitude")
 		}
-	} else {
-		defer func(e *epd.Dev2in13v3) {
-			if err := e.Close(); err != nil {
-				sugaredLogger.With("err", err).Error("could not close device")
-			}
-		}(e)
-		err := e.Init()
-		if err != nil {
-			sugaredLogger.With("err", err).Fatal("error while initializing device")
+		return forecast.NewOpenMeteo(appConfig.Forecast.URL, appConfig.Forecast.Latitude, appConfig.Forecast.Longitude)
+	default:
+		return nil, errors.Errorf("unknown forecast provider %q", appConfig.Forecast.Provider)
+	}
+}
+
+// pageAt shows consecutive pages on consecutive runs when started periodically (e.g. by cron)
+// every interval, the layout wraps the page around the number of pages
+func pageAt(now time.Time, interval time.Duration) int {
+	if interval <= 0 {
+		return 0
+	}
+
+	return int(now.UnixNano() / int64(interval))
+}
+
+// openForecast returns nil when the forecast is disabled or misconfigured, the forecast is
+// optional so the measurements are shown without it
+func openForecast(logger *zap.SugaredLogger) forecast.Provider {
+	provider, err := newForecastProvider()
+	if err != nil {
+		logger.With("err", err).Warn("could not create forecast provider, the forecast will not be shown")
+		return nil
+	}
+
+	return provider
+}
+
+// fetchForecast returns nil when the forecast is disabled or could not be fetched so the
+// measurements are still shown
+func fetchForecast(ctx context.Context, logger *zap.SugaredLogger, provider forecast.Provider) []forecast.Day {
+	if provider == nil {
+		return nil
+	}
+
+	days, err := provider.Forecast(ctx)
+	if err != nil {
+		logger.With("err", err).Warn("could not fetch forecast")
+		return nil
+	}
+
+	return days
+}
+
+// renderImages reads the layout file on every refresh so it can be tweaked without a restart
+func renderImages(logger *zap.SugaredLogger, bounds image.Rectangle, data []netatmo.Measurement, days []forecast.Day, page int) (bImage draw.Image, rImage draw.Image, err error) {
+	var layout ui.Layout
+	if appConfig.LayoutFile != "" {
+		if layout, err = ui.LoadLayout(appConfig.LayoutFile); err != nil {
+			return nil, nil, err
 		}
+	}
 
-		err = e.Clear()
+	return ui.BuildGUI(logger, bounds, data, ui.Options{
+		PanesPerPage:  appConfig.PanesPerPage,
+		Page:          page,
+		Forecast:      days,
+		StationLayout: ui.StationLayout(appConfig.StationLayout),
+		StaleAfter:    appConfig.StaleAfter,
+		ModuleMaxAge:  appConfig.ModuleMaxAge,
+		Layout:        layout,
+		Fonts: ui.Fonts{
+			Value:  appConfig.Fonts.Value,
+			Label:  appConfig.Fonts.Label,
+			Status: appConfig.Fonts.Status,
+			DPI:    appConfig.Fonts.DPI,
+		},
+	})
+}
+
+// orientImages rotates the rendered images to match how the display is mounted
+func orientImages(bImage, rImage draw.Image) (draw.Image, draw.Image, error) {
+	var err error
+	if appConfig.Rotate180 {
+		bImage, err = ui.RotateImage(bImage)
 		if err != nil {
-			sugaredLogger.With("err", err).Fatal("error while clearing the device screen")
+			return nil, nil, errors.Wrap(err, "could not rotate black image")
 		}
 
-		bBuff, err := epd.GetBuffer(sugaredLogger, bImage, e.Bounds(), false)
+		rImage, err = ui.RotateImage(rImage)
 		if err != nil {
-			sugaredLogger.With("err", err).Fatal("could not generate buffer for black the GUI image")
+			return nil, nil, errors.Wrap(err, "could not rotate red image")
 		}
-		rBuff, err := epd.GetBuffer(sugaredLogger, rImage, e.Bounds(), false)
+	}
+
+	return bImage, rImage, nil
+}
+
+func writeTestImages(logger *zap.SugaredLogger, bImage, rImage image.Image) error {
+	if err := writePNG(logger, "out_test_b.png", bImage); err != nil {
+		return err
+	}
+
+	return writePNG(logger, "out_test_r.png", rImage)
+}
+
+func writePNG(logger *zap.SugaredLogger, fileName string, img image.Image) error {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return errors.Wrap(err, "could not open test file for write")
+	}
+	defer func(file *os.File) {
+		err := file.Close()
 		if err != nil {
-			sugaredLogger.With("err", err).Fatal("could not generate buffer for red the GUI image")
+			logger.With("err", err).Error("could not close a file")
 		}
-		err = e.Display(bBuff, rBuff)
+	}(file)
+
+	if err = png.Encode(file, img); err != nil {
+		return errors.Wrap(err, "could not encode the output file")
+	}
+
+	return nil
+}
+
+func displayImages(logger *zap.SugaredLogger, e epd.Display, bImage, rImage image.Image) error {
+	if !epd.HasPlane(e, epd.PlaneRed) {
+		// display without a red plane would lose the content drawn in red so show it in black
+		bImage = ui.MergeImages(bImage, rImage)
+	}
+
+	var buffers [][]byte
+	for _, plane := range e.Planes() {
+		var img image.Image
+		switch plane {
+		case epd.PlaneBlack:
+			img = bImage
+		case epd.PlaneRed:
+			img = rImage
+		default:
+			return errors.Errorf("unsupported color plane %q", plane)
+		}
+
+		buff, err := epd.GetBuffer(logger, img, e.Bounds(), false)
 		if err != nil {
-			sugaredLogger.With("err", err).Fatal("could not display GUI")
+			return errors.Wrapf(err, "could not generate buffer for %s plane of the GUI image", plane)
 		}
+		buffers = append(buffers, buff)
 	}
+
+	return e.Display(buffers...)
 }
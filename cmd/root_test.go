@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"weather-pi/internal"
+	"weather-pi/netatmo"
+	"weather-pi/netatmo/netatmotest"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// setConfig replaces the config for the duration of the test
+func setConfig(t *testing.T, config internal.Config) {
+	t.Helper()
+	saved := appConfig
+	appConfig = config
+	t.Cleanup(func() { appConfig = saved })
+}
+
+func TestFetchOrLoadMeasurements(t *testing.T) {
+	dir := t.TempDir()
+	recorded := filepath.Join(dir, "getstationsdata.json")
+	if err := ioutil.WriteFile(recorded, netatmotest.StationData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	setConfig(t, internal.Config{
+		CacheFile:  filepath.Join(dir, "measurements.json"),
+		TimeWindow: time.Hour,
+		Sources:    []internal.Source{{StationName: "Home", ModuleNames: []string{"Outdoor"}}},
+	})
+	logger := zap.NewNop().Sugar()
+	failing := netatmo.NewFileSource(filepath.Join(dir, "missing.json"))
+
+	// nothing has been cached yet so the error is returned
+	if _, err := fetchOrLoadMeasurements(context.Background(), logger, failing); err == nil {
+		t.Fatal("fetchOrLoadMeasurements() succeeded without data")
+	}
+
+	fetched, err := fetchOrLoadMeasurements(context.Background(), logger, netatmo.NewFileSource(recorded))
+	if err != nil {
+		t.Fatalf("fetchOrLoadMeasurements() error = %v", err)
+	}
+	cached, err := fetchOrLoadMeasurements(context.Background(), logger, failing)
+	if err != nil {
+		t.Fatalf("fetchOrLoadMeasurements() with the cache error = %v", err)
+	}
+	if len(cached) != 1 || len(cached[0].Readings()) != 2 {
+		t.Fatalf("cached measurements = %+v, want the station and the outdoor module", cached)
+	}
+	// the readings keep the time they were measured at so they are marked as stale
+	for i, reading := range cached[0].Readings() {
+		if want := fetched[0].Readings()[i]; reading.Name != want.Name || !reading.Timestamp.Equal(want.Timestamp) || reading.Temperature != want.Temperature {
+			t.Errorf("cached reading = %+v, want %+v", reading, want)
+		}
+	}
+
+	bounds := image.Rect(0, 0, 212, 104)
+	fresh, _, err := renderImages(logger, bounds, cached, nil, 0)
+	if err != nil {
+		t.Fatalf("renderImages() error = %v", err)
+	}
+	appConfig.StaleAfter = 30 * time.Minute
+	stale, _, err := renderImages(logger, bounds, cached, nil, 0)
+	if err != nil {
+		t.Fatalf("renderImages() error = %v", err)
+	}
+	if reflect.DeepEqual(pixels(fresh), pixels(stale)) {
+		t.Error("the cached measurements from 2021 have not been marked as stale")
+	}
+
+	// without the cache the error is returned as it is
+	appConfig.CacheFile = ""
+	if _, err := fetchOrLoadMeasurements(context.Background(), logger, failing); err == nil {
+		t.Error("fetchOrLoadMeasurements() succeeded with the cache disabled")
+	}
+}
+
+func pixels(img draw.Image) []uint8 {
+	return img.(*image.Paletted).Pix
+}
+
+func TestOpenForecast(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		provider string
+		warned   bool
+	}{
+		{name: "disabled"},
+		{name: "unknown", provider: "met.no", warned: true},
+		// the location has not been set
+		{name: "misconfigured", provider: forecastOpenMeteo, warned: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, internal.Config{Forecast: internal.Forecast{Provider: tt.provider}})
+			core, logs := observer.New(zapcore.WarnLevel)
+
+			// the measurements are rendered without the forecast instead of failing
+			if provider := openForecast(zap.New(core).Sugar()); provider != nil {
+				t.Errorf("openForecast() = %#v, want nil", provider)
+			}
+			if warned := logs.Len() == 1; warned != tt.warned {
+				t.Errorf("warnings = %v, want a warning %v", logs.All(), tt.warned)
+			}
+		})
+	}
+}
+
+func TestPageAt(t *testing.T) {
+	start := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	first := pageAt(start, 10*time.Minute)
+	for _, tt := range []struct {
+		name     string
+		now      time.Time
+		interval time.Duration
+		want     int
+	}{
+		{name: "no interval", now: start, want: 0},
+		{name: "negative interval", now: start, interval: -time.Minute, want: 0},
+		{name: "same run", now: start.Add(9 * time.Minute), interval: 10 * time.Minute, want: first},
+		{name: "next run", now: start.Add(10 * time.Minute), interval: 10 * time.Minute, want: first + 1},
+		// a run started a bit early still shows the next page
+		{name: "early run", now: start.Add(20*time.Minute - time.Second), interval: 10 * time.Minute, want: first + 1},
+		{name: "sub-second interval", now: start.Add(1500 * time.Millisecond), interval: 500 * time.Millisecond, want: int(start.UnixNano()/int64(500*time.Millisecond)) + 3},
+	} {
+		if got := pageAt(tt.now, tt.interval); got != tt.want {
+			t.Errorf("%s: pageAt() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPageAtWrapAround(t *testing.T) {
+	dir := t.TempDir()
+	recorded := filepath.Join(dir, "getstationsdata.json")
+	if err := ioutil.WriteFile(recorded, netatmotest.StationData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the station and two modules take a page each
+	setConfig(t, internal.Config{
+		PanesPerPage: 1,
+		Sources:      []internal.Source{{StationName: "Home", ModuleNames: []string{"Outdoor", "Bedroom"}}},
+	})
+	logger := zap.NewNop().Sugar()
+	measurements, err := netatmo.FetchData(context.Background(), logger, netatmo.NewFileSource(recorded), appConfig.Sources, time.Now())
+	if err != nil {
+		t.Fatalf("FetchData() error = %v", err)
+	}
+	bounds := image.Rect(0, 0, 250, 122)
+
+	// the runs after the last page start over with the first one
+	start := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	var renders [][]uint8
+	for run := 0; run < 4; run++ {
+		img, _, err := renderImages(logger, bounds, measurements, nil, pageAt(start.Add(time.Duration(run)*time.Minute), time.Minute))
+		if err != nil {
+			t.Fatalf("renderImages() error = %v", err)
+		}
+		renders = append(renders, pixels(img))
+	}
+	if reflect.DeepEqual(renders[0], renders[1]) || reflect.DeepEqual(renders[1], renders[2]) || reflect.DeepEqual(renders[0], renders[2]) {
+		t.Error("consecutive runs show the same page")
+	}
+	if !reflect.DeepEqual(renders[0], renders[3]) {
+		t.Error("the run after the last page does not show the first one")
+	}
+}
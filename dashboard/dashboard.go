@@ -0,0 +1,147 @@
+// Package dashboard serves the content of the display over HTTP so it can be checked remotely.
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"image"
+	"image/png"
+	"net/http"
+	"sync"
+	"time"
+	"weather-pi/netatmo"
+	"weather-pi/ui"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Dashboard keeps the latest rendered screen and measurements.
+type Dashboard struct {
+	log *zap.SugaredLogger
+
+	mu           sync.RWMutex
+	png          []byte
+	measurements []netatmo.Measurement
+	updated      time.Time
+}
+
+func New(logger *zap.SugaredLogger) *Dashboard {
+	return &Dashboard{log: logger}
+}
+
+// Update replaces the served screen with the given black and red images and measurements.
+func (d *Dashboard) Update(bImage, rImage image.Image, measurements []netatmo.Measurement) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, ui.CompositeImages(bImage, rImage)); err != nil {
+		return errors.Wrap(err, "could not encode dashboard image")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.png = buf.Bytes()
+	d.measurements = measurements
+	d.updated = time.Now()
+
+	return nil
+}
+
+// Handler returns a handler serving the HTML page, the screen image and the measurements.
+func (d *Dashboard) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", d.handleIndex)
+	mux.HandleFunc("/screen.png", d.handleImage)
+	mux.HandleFunc("/measurements.json", d.handleMeasurements)
+
+	return mux
+}
+
+func (d *Dashboard) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	d.mu.RLock()
+	data := indexData{Updated: d.updated, Measurements: d.measurements}
+	d.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, data); err != nil {
+		d.log.With("err", err).Error("could not render dashboard page")
+	}
+}
+
+func (d *Dashboard) handleImage(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	img, updated := d.png, d.updated
+	d.mu.RUnlock()
+
+	if img == nil {
+		http.Error(w, "display has not been refreshed yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	if _, err := w.Write(img); err != nil {
+		d.log.With("err", err).Debug("could not write dashboard image")
+	}
+}
+
+func (d *Dashboard) handleMeasurements(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	measurements, updated := d.measurements, d.updated
+	d.mu.RUnlock()
+
+	if updated.IsZero() {
+		http.Error(w, "display has not been refreshed yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	if err := json.NewEncoder(w).Encode(measurements); err != nil {
+		d.log.With("err", err).Debug("could not write measurements")
+	}
+}
+
+type indexData struct {
+	Updated      time.Time
+	Measurements []netatmo.Measurement
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="60">
+<title>weather-pie</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+img { width: 100%; max-width: 636px; image-rendering: pixelated; border: 1px solid #ccc; }
+td, th { padding: 0.2em 0.6em; text-align: right; }
+td:first-child, th:first-child { text-align: left; }
+</style>
+</head>
+<body>
+{{if .Updated.IsZero}}
+<p>The display has not been refreshed yet.</p>
+{{else}}
+<img src="screen.png" alt="display">
+<p>Updated {{.Updated.Format "2006-01-02 15:04:05 MST"}}, <a href="measurements.json">JSON</a></p>
+<table>
+<tr><th>Module</th><th>Temperature</th><th>Min</th><th>Max</th><th>Humidity</th><th>CO2</th><th>Pressure</th><th>Rain</th><th>Wind</th><th>Measured</th></tr>
+{{range .Measurements}}{{range .Readings}}
+<tr><td>{{.Name}}</td>
+{{if .Type.HasTemperature}}<td>{{printf "%.1f" .Temperature}}°C</td><td>{{printf "%.1f" .MinTemp}}°C</td><td>{{printf "%.1f" .MaxTemp}}°C</td><td>{{.Humidity}}%</td>{{else}}<td></td><td></td><td></td><td></td>{{end}}
+<td>{{with .CO2}}{{.}} ppm{{end}}</td><td>{{with .Pressure}}{{printf "%.1f" .Value}} mbar{{end}}</td>
+<td>{{with .Rain}}{{printf "%.1f" .Current}} mm ({{printf "%.1f" .SumDay}} mm today){{end}}</td><td>{{with .Wind}}{{.Strength}} km/h (gusts {{.GustStrength}} km/h){{end}}</td>
+<td>{{.Timestamp.Format "15:04"}}</td></tr>
+{{end}}{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,145 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"weather-pi/netatmo"
+
+	"go.uber.org/zap"
+)
+
+func testMeasurements() []netatmo.Measurement {
+	at := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	co2 := int64(612)
+
+	return []netatmo.Measurement{{
+		StationName: "Home",
+		StationReading: &netatmo.Reading{
+			Name: "Living room", Type: netatmo.BaseStation, Module: netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01"},
+			Timestamp: at, Temperature: 21.4, MinTemp: 19.8, MaxTemp: 22.1, Humidity: 48, CO2: &co2,
+			Pressure: &netatmo.Pressure{Value: 1016.2}, Status: netatmo.Status{Reachable: true},
+		},
+		ModuleReadings: []netatmo.Reading{{
+			Name: "Rain gauge", Type: netatmo.RainGauge, Module: netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01", ModuleId: "05:00:00:00:00:01"},
+			Timestamp: at, Rain: &netatmo.Rain{Current: 0.1, SumDay: 2.7}, Status: netatmo.Status{Reachable: true},
+		}},
+	}}
+}
+
+func get(t *testing.T, handler http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	return rec
+}
+
+func TestDashboardBeforeRefresh(t *testing.T) {
+	handler := New(zap.NewNop().Sugar()).Handler()
+
+	for _, path := range []string{"/screen.png", "/measurements.json"} {
+		if rec := get(t, handler, path); rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("GET %s = %d, want 503", path, rec.Code)
+		}
+	}
+	rec := get(t, handler, "/")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "has not been refreshed yet") || strings.Contains(rec.Body.String(), "<img") {
+		t.Errorf("GET / = %d %q, want the page without the screen", rec.Code, rec.Body.String())
+	}
+	if rec := get(t, handler, "/favicon.ico"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /favicon.ico = %d, want 404", rec.Code)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	d := New(zap.NewNop().Sugar())
+	handler := d.Handler()
+	palette := color.Palette{color.White, color.Black}
+	black := image.NewPaletted(image.Rect(0, 0, 212, 104), palette)
+	red := image.NewPaletted(image.Rect(0, 0, 212, 104), palette)
+	black.SetColorIndex(10, 10, 1)
+	red.SetColorIndex(20, 20, 1)
+	if err := d.Update(black, red, testMeasurements()); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	rec := get(t, handler, "/screen.png")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" || rec.Header().Get("Last-Modified") == "" {
+		t.Fatalf("GET /screen.png = %d %v", rec.Code, rec.Header())
+	}
+	screen, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("could not decode the screen: %v", err)
+	}
+	if screen.Bounds() != black.Bounds() {
+		t.Errorf("screen bounds = %v, want %v", screen.Bounds(), black.Bounds())
+	}
+	// the red plane is drawn over the black one
+	for _, pixel := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+		{10, 10, color.RGBA{A: 255}},
+		{20, 20, color.RGBA{R: 0xcc, A: 0xff}},
+	} {
+		if got := color.RGBAModel.Convert(screen.At(pixel.x, pixel.y)); got != pixel.want {
+			t.Errorf("pixel at %d,%d = %v, want %v", pixel.x, pixel.y, got, pixel.want)
+		}
+	}
+
+	rec = get(t, handler, "/measurements.json")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /measurements.json = %d %v", rec.Code, rec.Header())
+	}
+	var measurements []netatmo.Measurement
+	if err := json.NewDecoder(rec.Body).Decode(&measurements); err != nil {
+		t.Fatalf("could not decode the measurements: %v", err)
+	}
+	if !reflect.DeepEqual(measurements, testMeasurements()) {
+		t.Errorf("measurements = %+v, want %+v", measurements, testMeasurements())
+	}
+
+	rec = get(t, handler, "/")
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("GET / = %d %v", rec.Code, rec.Header())
+	}
+	for _, want := range []string{`<img src="screen.png"`, "<td>Living room</td>", "21.4°C", "612 ppm", "1016.2 mbar", "<td>Rain gauge</td>", "0.1 mm (2.7 mm today)", "12:00"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %q", want)
+		}
+	}
+}
+
+func TestDashboardUpdate(t *testing.T) {
+	d := New(zap.NewNop().Sugar())
+	handler := d.Handler()
+	img := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.White, color.Black})
+	if err := d.Update(img, img, testMeasurements()); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	// the next refresh replaces the measurements
+	updated := testMeasurements()[:1]
+	updated[0].ModuleReadings = nil
+	updated[0].StationReading.Temperature = 22
+	if err := d.Update(img, img, updated); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	var measurements []netatmo.Measurement
+	if err := json.NewDecoder(get(t, handler, "/measurements.json").Body).Decode(&measurements); err != nil {
+		t.Fatalf("could not decode the measurements: %v", err)
+	}
+	if !reflect.DeepEqual(measurements, updated) {
+		t.Errorf("measurements = %+v, want the last ones %+v", measurements, updated)
+	}
+}
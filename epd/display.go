@@ -0,0 +1,81 @@
+package epd
+
+import (
+	"image"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Plane is a single color layer which a display is able to show.
+type Plane string
+
+const (
+	PlaneBlack Plane = "black"
+	PlaneRed   Plane = "red"
+)
+
+// Display is implemented by all supported e-Paper panels.
+type Display interface {
+	Init() error
+	Clear() error
+	// Display sends one buffer per plane (in the order returned by Planes) and refreshes the panel.
+	Display(buffers ...[]byte) error
+	Sleep() error
+	Close() error
+	// Bounds returns the native (vertical) resolution of the panel.
+	Bounds() image.Rectangle
+	Planes() []Plane
+}
+
+// Factory creates a not yet initialized display driver.
+type Factory func(logger *zap.SugaredLogger) Display
+
+var drivers = map[string]Factory{}
+
+// Register makes a display driver available under the given model name.
+// It is meant to be called from the init function of the driver.
+func Register(model string, factory Factory) {
+	if _, ok := drivers[model]; ok {
+		panic("display model registered twice: " + model)
+	}
+	drivers[model] = factory
+}
+
+// New creates a driver for the given display model.
+func New(model string, logger *zap.SugaredLogger) (Display, error) {
+	factory, ok := drivers[model]
+	if !ok {
+		return nil, errors.Errorf("unsupported display model %q (supported: %v)", model, Models())
+	}
+
+	return factory(logger), nil
+}
+
+// Models returns the names of all registered display models.
+func Models() []string {
+	models := make([]string, 0, len(drivers))
+	for model := range drivers {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	return models
+}
+
+// Horizontal returns bounds of the display rotated by 90 degrees.
+func Horizontal(bounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, bounds.Dy(), bounds.Dx())
+}
+
+// HasPlane reports whether the display is able to show the given plane.
+func HasPlane(d Display, plane Plane) bool {
+	for _, p := range d.Planes() {
+		if p == plane {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,99 @@
+package epd_test
+
+import (
+	"image"
+	"sort"
+	"strings"
+	"testing"
+	"weather-pi/epd"
+
+	"go.uber.org/zap"
+)
+
+// monoDisplay is a black and white panel which does nothing
+type monoDisplay struct{}
+
+func (monoDisplay) Init() error                     { return nil }
+func (monoDisplay) Clear() error                    { return nil }
+func (monoDisplay) Display(buffers ...[]byte) error { return nil }
+func (monoDisplay) Sleep() error                    { return nil }
+func (monoDisplay) Close() error                    { return nil }
+
+func (monoDisplay) Bounds() image.Rectangle {
+	return image.Rect(0, 0, 122, 250)
+}
+
+func (monoDisplay) Planes() []epd.Plane {
+	return []epd.Plane{epd.PlaneBlack}
+}
+
+func init() {
+	// registered under names sorting on both sides of the real drivers
+	epd.Register("test-mono", func(logger *zap.SugaredLogger) epd.Display { return monoDisplay{} })
+	epd.Register("0test", func(logger *zap.SugaredLogger) epd.Display { return monoDisplay{} })
+}
+
+func TestNew(t *testing.T) {
+	d, err := epd.New(epd.Model2in13v3, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, ok := d.(*epd.Dev2in13v3); !ok {
+		t.Errorf("New() = %T, want *epd.Dev2in13v3", d)
+	}
+
+	if d, err := epd.New("test-mono", zap.NewNop().Sugar()); err != nil || d.Bounds() != image.Rect(0, 0, 122, 250) {
+		t.Errorf("New() = %v, %v, want the registered test display", d, err)
+	}
+}
+
+func TestNewUnknownModel(t *testing.T) {
+	d, err := epd.New("7in5", zap.NewNop().Sugar())
+	if err == nil {
+		t.Fatalf("New() = %v, want an error", d)
+	}
+	// the error lists the models which can be used instead
+	if !strings.Contains(err.Error(), `"7in5"`) || !strings.Contains(err.Error(), epd.Model2in13v3) {
+		t.Errorf("New() error = %v, want the model and the supported ones", err)
+	}
+}
+
+func TestModels(t *testing.T) {
+	models := epd.Models()
+	if !sort.StringsAreSorted(models) {
+		t.Errorf("Models() = %v, want them sorted", models)
+	}
+	want := map[string]bool{epd.Model2in13v3: true, "test-mono": true, "0test": true}
+	for _, model := range models {
+		delete(want, model)
+	}
+	if len(want) != 0 {
+		t.Errorf("Models() = %v, missing %v", models, want)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "test-mono") {
+			t.Errorf("Register() panic = %v, want the model registered twice", r)
+		}
+	}()
+	epd.Register("test-mono", func(logger *zap.SugaredLogger) epd.Display { return monoDisplay{} })
+}
+
+func TestHasPlane(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		display epd.Display
+		plane   epd.Plane
+		want    bool
+	}{
+		{name: "black on mono", display: monoDisplay{}, plane: epd.PlaneBlack, want: true},
+		{name: "red on mono", display: monoDisplay{}, plane: epd.PlaneRed, want: false},
+		{name: "red on 2in13v3", display: &epd.Dev2in13v3{}, plane: epd.PlaneRed, want: true},
+	} {
+		if got := epd.HasPlane(tt.display, tt.plane); got != tt.want {
+			t.Errorf("%s: HasPlane() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -19,6 +19,18 @@ import (
 const width = 104
 const height = 212
 
+// Model2in13v3 is the name of the Waveshare 2.13" (B) V3 display in the config
+const Model2in13v3 = "2in13v3"
+
+// busyTimeout limits the wait for the device, a full refresh takes about 15 seconds
+const busyTimeout = 30 * time.Second
+
+func init() {
+	Register(Model2in13v3, func(logger *zap.SugaredLogger) Display {
+		return NewEpd2in13v3(logger)
+	})
+}
+
 type Dev2in13v3 struct {
 	resetPin gpio.PinOut
 	dcPin gpio.PinOut
@@ -29,6 +41,7 @@ type Dev2in13v3 struct {
 	conn spi.Conn
 	port spi.PortCloser
 	log *zap.SugaredLogger
+	busyTimeout time.Duration
 }
 
 func NewEpd2in13v3(logger *zap.SugaredLogger) *Dev2in13v3 {
@@ -36,10 +49,32 @@ func NewEpd2in13v3(logger *zap.SugaredLogger) *Dev2in13v3 {
 		width: width,
 		height: height,
 		log: logger,
+		busyTimeout: busyTimeout,
 	}
 }
 
-func (e *Dev2in13v3) Init() error {
+// Pins groups GPIO pins used to control the display.
+type Pins struct {
+	Reset gpio.PinOut
+	DC    gpio.PinOut
+	CS    gpio.PinOut
+	Busy  gpio.PinIn
+}
+
+// NewEpd2in13v3WithConn creates a driver which talks to the display over the given
+// SPI connection and pins instead of opening the Raspberry Pi peripherals in Init.
+func NewEpd2in13v3WithConn(logger *zap.SugaredLogger, c spi.Conn, pins Pins) *Dev2in13v3 {
+	e := NewEpd2in13v3(logger)
+	e.conn = c
+	e.resetPin = pins.Reset
+	e.dcPin = pins.DC
+	e.csPin = pins.CS
+	e.busyPin = pins.Busy
+
+	return e
+}
+
+func (e *Dev2in13v3) open() error {
 	e.log.Info("initializing host")
 	_, err := host.Init()
 	if err != nil {
@@ -71,11 +106,22 @@ func (e *Dev2in13v3) Init() error {
 		return errors.Wrap(err, "could not connect to SPI")
 	}
 
+	return nil
+}
+
+func (e *Dev2in13v3) Init() error {
+	if e.conn == nil {
+		if err := e.open(); err != nil {
+			return err
+		}
+	}
+
 	if err := e.Reset(); err != nil {
 		return errors.Wrap(err, "could not reset the device")
 	}
 	time.Sleep(10*time.Millisecond)
 
+	var err error
 	if err = e.sendCommand(0x04); err != nil {
 		return errors.Wrap(err, "could not send command 0x04")
 	}
@@ -147,7 +193,16 @@ func (e *Dev2in13v3) Clear() error {
 	return e.Display(buff, buff)
 }
 
-func (e *Dev2in13v3) Display(blacks, reds []byte) error {
+func (e *Dev2in13v3) Planes() []Plane {
+	return []Plane{PlaneBlack, PlaneRed}
+}
+
+func (e *Dev2in13v3) Display(buffers ...[]byte) error {
+	if len(buffers) != 2 {
+		return errors.Errorf("expected 2 buffers (black and red) got %d", len(buffers))
+	}
+	blacks, reds := buffers[0], buffers[1]
+
 	err := e.sendCommand(0x10)
 	if err != nil {
 		return errors.Wrap(err, "could not send command 0x10 to device")
@@ -180,6 +235,36 @@ func (e *Dev2in13v3) Display(blacks, reds []byte) error {
 	return nil
 }
 
+// Sleep powers the panel off and puts the controller into deep sleep. The device
+// has to be reset (by calling Init) before it can be used again.
+func (e *Dev2in13v3) Sleep() error {
+	if err := e.sendCommand(0x50); err != nil {
+		return errors.Wrap(err, "could not VCOM and data interval settings")
+	}
+
+	if err := e.sendData([]byte{0xf7}); err != nil {
+		return errors.Wrap(err, "could not set border floating")
+	}
+
+	if err := e.sendCommand(0x02); err != nil {
+		return errors.Wrap(err, "could not send power off command")
+	}
+
+	if err := e.waitUntilIdle(); err != nil {
+		return errors.Wrap(err, "could not wait for the device")
+	}
+
+	if err := e.sendCommand(0x07); err != nil {
+		return errors.Wrap(err, "could not send deep sleep command")
+	}
+
+	if err := e.sendData([]byte{0xA5}); err != nil {
+		return errors.Wrap(err, "could not send deep sleep check code")
+	}
+
+	return nil
+}
+
 func (e *Dev2in13v3) Reset() error {
 	if err := e.resetPin.Out(gpio.High); err != nil {
 		return errors.Wrap(err, "could not set RESET pin to HIGH")
@@ -252,6 +337,10 @@ func (e *Dev2in13v3) sendData(b []byte) error {
 
 func (e *Dev2in13v3) waitUntilIdle() error {
 	e.log.Debug("busy")
+	start := time.Now()
+	defer func() {
+		busyWaitDuration.Observe(time.Since(start).Seconds())
+	}()
 	err := e.sendCommand(0x71)
 	if err != nil {
 		return errors.Wrap(err, "could not send command 0x71")
@@ -261,6 +350,9 @@ func (e *Dev2in13v3) waitUntilIdle() error {
 		if e.busyPin.Read() == gpio.High {
 			break
 		}
+		if time.Since(start) > e.busyTimeout {
+			return errors.Errorf("device still busy after %s", e.busyTimeout)
+		}
 		time.Sleep(100 * time.Millisecond)
 
 		err = e.sendCommand(0x71)
@@ -0,0 +1,127 @@
+package epd_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"weather-pi/epd"
+	"weather-pi/epd/epdtest"
+
+	"go.uber.org/zap"
+)
+
+func newTestDisplay() (*epd.Dev2in13v3, *epdtest.Bus) {
+	bus := epdtest.NewBus()
+	return epd.NewEpd2in13v3WithConn(zap.NewNop().Sugar(), bus.Conn(), bus.Pins()), bus
+}
+
+func TestEpd2in13v3Init(t *testing.T) {
+	e, bus := newTestDisplay()
+	if err := e.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	if toggles := bus.Pin("RESET").Toggles(); toggles != 2 {
+		t.Errorf("RESET toggled %d times, want 2", toggles)
+	}
+	// power on is followed by a status check for every busy read and one when the device is idle
+	want := []byte{0x04, 0x71, 0x71, 0x71, 0x00, 0x61, 0x50}
+	if cmds := bus.Commands(); !bytes.Equal(cmds, want) {
+		t.Errorf("commands = % x, want % x", cmds, want)
+	}
+	for _, tt := range []struct {
+		cmd  byte
+		data []byte
+	}{
+		{0x00, []byte{0x0f, 0x89}},
+		{0x61, []byte{0x68, 0x00, 0xd4}},
+		{0x50, []byte{0x77}},
+	} {
+		if data := bus.Data(tt.cmd); len(data) != 1 || !bytes.Equal(data[0], tt.data) {
+			t.Errorf("data of command %#x = % x, want % x", tt.cmd, data, tt.data)
+		}
+	}
+	if polls := bus.BusyPolls(); polls != 2 {
+		t.Errorf("BUSY polled %d times while busy, want 2", polls)
+	}
+}
+
+func TestEpd2in13v3Display(t *testing.T) {
+	e, bus := newTestDisplay()
+	// the planes do not fit in a single transfer
+	bus.MaxTxSize = 1000
+	size := e.Width() * e.Height() / 8
+	black, red := make([]byte, size), make([]byte, size)
+	for i := range black {
+		black[i], red[i] = byte(i), byte(255-i%256)
+	}
+
+	if err := e.Display(black, red); err != nil {
+		t.Fatalf("Display() error = %v", err)
+	}
+	if data := bus.Data(0x10); len(data) != 1 || !bytes.Equal(data[0], black) {
+		t.Error("the black plane was not sent with command 0x10")
+	}
+	if data := bus.Data(0x13); len(data) != 1 || !bytes.Equal(data[0], red) {
+		t.Error("the red plane was not sent with command 0x13")
+	}
+	cmds := bus.Commands()
+	if len(cmds) < 4 || !bytes.Equal(cmds[:3], []byte{0x10, 0x13, 0x12}) || cmds[len(cmds)-1] != 0x71 {
+		t.Errorf("commands = % x, want the planes followed by a refresh and a status check", cmds)
+	}
+	if polls := bus.BusyPolls(); polls != 2 {
+		t.Errorf("BUSY polled %d times while busy, want 2", polls)
+	}
+
+	if err := e.Display(black); err == nil {
+		t.Error("Display() accepted a single plane")
+	}
+}
+
+func TestEpd2in13v3Clear(t *testing.T) {
+	e, bus := newTestDisplay()
+	if err := e.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+
+	white := bytes.Repeat([]byte{0xff}, e.Width()*e.Height()/8)
+	for _, cmd := range []byte{0x10, 0x13} {
+		if data := bus.Data(cmd); len(data) != 1 || !bytes.Equal(data[0], white) {
+			t.Errorf("plane of command %#x is not white", cmd)
+		}
+	}
+}
+
+func TestEpd2in13v3Sleep(t *testing.T) {
+	e, bus := newTestDisplay()
+	if err := e.Sleep(); err != nil {
+		t.Fatalf("Sleep() error = %v", err)
+	}
+
+	want := []byte{0x50, 0x02, 0x71, 0x71, 0x71, 0x07}
+	if cmds := bus.Commands(); !bytes.Equal(cmds, want) {
+		t.Errorf("commands = % x, want % x", cmds, want)
+	}
+	if data := bus.Data(0x07); len(data) != 1 || !bytes.Equal(data[0], []byte{0xa5}) {
+		t.Errorf("deep sleep check code = % x, want a5", data)
+	}
+}
+
+func TestEpd2in13v3BusyTimeout(t *testing.T) {
+	e, bus := newTestDisplay()
+	bus.BusyReads = 1 << 30
+	epd.SetBusyTimeout(e, 250*time.Millisecond)
+
+	start := time.Now()
+	err := e.Init()
+	if err == nil || !strings.Contains(err.Error(), "device still busy after 250ms") {
+		t.Fatalf("Init() error = %v, want a busy timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Init() gave up after %s", elapsed)
+	}
+	if cmds := bus.Commands(); bytes.Contains(cmds, []byte{0x00}) {
+		t.Errorf("commands = % x, the panel was set up while busy", cmds)
+	}
+}
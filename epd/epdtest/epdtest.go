@@ -0,0 +1,298 @@
+// Package epdtest simulates the SPI connection and GPIO pins of an e-Paper display
+// so the drivers can be exercised without the hardware.
+package epdtest
+
+import (
+	"sync"
+	"time"
+	"weather-pi/epd"
+
+	"github.com/pkg/errors"
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+)
+
+// Op is a single SPI transfer recorded by the Bus.
+type Op struct {
+	// Command is true when the DC pin was LOW during the transfer
+	Command bool
+	Bytes   []byte
+}
+
+// Bus simulates the display connected over SPI and records all the traffic sent to it.
+//
+// The BUSY pin reports the device as busy (LOW) for BusyReads reads after every
+// command listed in BusyCommands.
+type Bus struct {
+	// MaxTxSize limits the size of a single SPI transfer
+	MaxTxSize    int
+	BusyReads    int
+	BusyCommands []byte
+
+	mu        sync.Mutex
+	ops       []Op
+	busyLeft  int
+	busyTotal int
+	pins      map[string]*Pin
+}
+
+// NewBus creates a simulated display which is busy for 2 reads after power on (0x04),
+// refresh (0x12) and power off (0x02) commands.
+func NewBus() *Bus {
+	b := &Bus{
+		MaxTxSize:    4096,
+		BusyReads:    2,
+		BusyCommands: []byte{0x02, 0x04, 0x12},
+		pins:         map[string]*Pin{},
+	}
+	for _, name := range []string{"RESET", "DC", "CS", "BUSY"} {
+		b.pins[name] = &Pin{name: name, bus: b, level: gpio.High}
+	}
+
+	return b
+}
+
+// Conn returns the simulated SPI connection.
+func (b *Bus) Conn() spi.Conn {
+	return &Conn{bus: b}
+}
+
+// Pins returns the simulated GPIO pins.
+func (b *Bus) Pins() epd.Pins {
+	return epd.Pins{
+		Reset: b.pins["RESET"],
+		DC:    b.pins["DC"],
+		CS:    b.pins["CS"],
+		Busy:  b.pins["BUSY"],
+	}
+}
+
+// Pin returns the simulated pin with the given name (RESET, DC, CS or BUSY).
+func (b *Bus) Pin(name string) *Pin {
+	return b.pins[name]
+}
+
+// Ops returns a copy of all the recorded transfers. Consecutive data transfers are
+// not merged so chunking done by the driver is visible.
+func (b *Bus) Ops() []Op {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ops := make([]Op, len(b.ops))
+	copy(ops, b.ops)
+
+	return ops
+}
+
+// Commands returns all the command bytes in the order they were sent.
+func (b *Bus) Commands() []byte {
+	var cmds []byte
+	for _, op := range b.Ops() {
+		if op.Command {
+			cmds = append(cmds, op.Bytes...)
+		}
+	}
+
+	return cmds
+}
+
+// Data returns data payloads sent after each occurrence of the given command.
+// Data split into several transfers is joined together.
+func (b *Bus) Data(cmd byte) [][]byte {
+	var payloads [][]byte
+	current := -1
+	for _, op := range b.Ops() {
+		if op.Command {
+			current = -1
+			if len(op.Bytes) == 1 && op.Bytes[0] == cmd {
+				payloads = append(payloads, []byte{})
+				current = len(payloads) - 1
+			}
+			continue
+		}
+		if current >= 0 {
+			payloads[current] = append(payloads[current], op.Bytes...)
+		}
+	}
+
+	return payloads
+}
+
+// BusyPolls returns how many times the BUSY pin has been read while the device was busy.
+func (b *Bus) BusyPolls() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.busyTotal
+}
+
+// Reset forgets all the recorded transfers.
+func (b *Bus) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.ops = nil
+	b.busyLeft = 0
+	b.busyTotal = 0
+}
+
+func (b *Bus) tx(w []byte) error {
+	dc := b.pins["DC"].Read()
+	cs := b.pins["CS"].Read()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if cs != gpio.Low {
+		return errors.Errorf("transfer of %d bytes without CS asserted", len(w))
+	}
+	if len(w) > b.MaxTxSize {
+		return errors.Errorf("transfer of %d bytes exceeds limit of %d bytes", len(w), b.MaxTxSize)
+	}
+
+	op := Op{Command: dc == gpio.Low, Bytes: make([]byte, len(w))}
+	copy(op.Bytes, w)
+	b.ops = append(b.ops, op)
+
+	if op.Command && len(w) == 1 {
+		for _, cmd := range b.BusyCommands {
+			if cmd == w[0] {
+				b.busyLeft = b.BusyReads
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *Bus) readBusy() gpio.Level {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.busyLeft > 0 {
+		b.busyLeft--
+		b.busyTotal++
+		return gpio.Low
+	}
+
+	return gpio.High
+}
+
+// Conn implements spi.Conn and conn.Limits on top of the Bus.
+type Conn struct {
+	bus *Bus
+}
+
+func (c *Conn) String() string {
+	return "epdtest"
+}
+
+func (c *Conn) Tx(w, r []byte) error {
+	if len(r) != 0 {
+		return errors.New("reading is not supported by the simulated display")
+	}
+
+	return c.bus.tx(w)
+}
+
+func (c *Conn) Duplex() conn.Duplex {
+	return conn.Half
+}
+
+func (c *Conn) TxPackets(p []spi.Packet) error {
+	for _, packet := range p {
+		if err := c.Tx(packet.W, packet.R); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Conn) MaxTxSize() int {
+	return c.bus.MaxTxSize
+}
+
+// Pin implements gpio.PinIO. Reading the BUSY pin follows the simulated device state.
+type Pin struct {
+	name string
+	bus  *Bus
+
+	mu    sync.Mutex
+	level gpio.Level
+	// toggles counts level changes set with Out
+	toggles int
+}
+
+func (p *Pin) String() string {
+	return p.name
+}
+
+func (p *Pin) Halt() error {
+	return nil
+}
+
+func (p *Pin) Name() string {
+	return p.name
+}
+
+func (p *Pin) Number() int {
+	return -1
+}
+
+func (p *Pin) Function() string {
+	return "epdtest"
+}
+
+func (p *Pin) In(pull gpio.Pull, edge gpio.Edge) error {
+	return nil
+}
+
+func (p *Pin) Read() gpio.Level {
+	if p.name == "BUSY" {
+		return p.bus.readBusy()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.level
+}
+
+func (p *Pin) WaitForEdge(timeout time.Duration) bool {
+	return false
+}
+
+func (p *Pin) Pull() gpio.Pull {
+	return gpio.PullNoChange
+}
+
+func (p *Pin) DefaultPull() gpio.Pull {
+	return gpio.PullNoChange
+}
+
+func (p *Pin) Out(l gpio.Level) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.level != l {
+		p.toggles++
+	}
+	p.level = l
+
+	return nil
+}
+
+func (p *Pin) PWM(duty gpio.Duty, f physic.Frequency) error {
+	return errors.New("PWM is not supported by the simulated display")
+}
+
+// Toggles returns how many times the level of the pin has been changed.
+func (p *Pin) Toggles() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.toggles
+}
@@ -0,0 +1,8 @@
+package epd
+
+import "time"
+
+// SetBusyTimeout shortens the wait for the simulated device in the tests.
+func SetBusyTimeout(e *Dev2in13v3, timeout time.Duration) {
+	e.busyTimeout = timeout
+}
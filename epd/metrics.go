@@ -0,0 +1,15 @@
+package epd
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// busyWaitDuration tracks how long the controller keeps the display busy, mostly while refreshing the panel
+var busyWaitDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "weatherpie",
+	Subsystem: "display",
+	Name:      "busy_wait_seconds",
+	Help:      "Time spent waiting for the display controller to become idle.",
+	Buckets:   []float64{0.1, 0.5, 1, 2, 5, 10, 15, 20, 30, 60},
+})
@@ -0,0 +1,33 @@
+// Package forecast fetches daily weather forecasts shown next to the station measurements.
+package forecast
+
+import (
+	"context"
+	"time"
+)
+
+// Condition describes the weather of a day. Its value is the name of the matching icon
+// in resources/weather_icons.
+type Condition string
+
+const (
+	Sunny        Condition = "sun"
+	PartlyCloudy Condition = "partial_cloudy"
+	Foggy        Condition = "foggy"
+	Rain         Condition = "rain"
+	Snow         Condition = "snow"
+	Storm        Condition = "storm"
+)
+
+// Day is a forecast for a single day.
+type Day struct {
+	Date      time.Time
+	Condition Condition
+	MinTemp   float64
+	MaxTemp   float64
+}
+
+// Provider returns forecast for the following days starting with today.
+type Provider interface {
+	Forecast(ctx context.Context) ([]Day, error)
+}
@@ -0,0 +1,88 @@
+// Package forecasttest provides a local stand-in for the Open-Meteo forecast API.
+package forecasttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Day is a single day served by the stand-in server.
+type Day struct {
+	WeatherCode int
+	MinTemp     float64
+	MaxTemp     float64
+}
+
+// Server mimics the /v1/forecast endpoint of Open-Meteo.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	days    []Day
+	queries []url.Values
+}
+
+// NewServer starts a stand-in server returning the given days starting today.
+func NewServer(days ...Day) *Server {
+	s := &Server{days: days}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handleForecast))
+
+	return s
+}
+
+// SetDays replaces the served forecast.
+func (s *Server) SetDays(days ...Day) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.days = days
+}
+
+// Queries returns query parameters of all the requests received by the server.
+func (s *Server) Queries() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]url.Values(nil), s.queries...)
+}
+
+func (s *Server) handleForecast(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.queries = append(s.queries, r.URL.Query())
+	days := s.days
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	query := r.URL.Query()
+	if r.URL.Path != "/v1/forecast" || query.Get("latitude") == "" || query.Get("longitude") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": true, "reason": "invalid request"})
+		return
+	}
+
+	daily := map[string]interface{}{}
+	var dates []string
+	var codes []int
+	var minTemps, maxTemps []float64
+	today := time.Now().UTC()
+	for i, day := range days {
+		dates = append(dates, today.AddDate(0, 0, i).Format("2006-01-02"))
+		codes = append(codes, day.WeatherCode)
+		minTemps = append(minTemps, day.MinTemp)
+		maxTemps = append(maxTemps, day.MaxTemp)
+	}
+	daily["time"] = dates
+	daily["weathercode"] = codes
+	daily["temperature_2m_min"] = minTemps
+	daily["temperature_2m_max"] = maxTemps
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"latitude":  query.Get("latitude"),
+		"longitude": query.Get("longitude"),
+		"daily":     daily,
+	})
+}
@@ -0,0 +1,127 @@
+package forecast
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OpenMeteoURL is the base URL of the public Open-Meteo API
+const OpenMeteoURL = "https://api.open-meteo.com"
+
+// OpenMeteo fetches the forecast from an Open-Meteo compatible API.
+type OpenMeteo struct {
+	BaseURL   string
+	Latitude  float64
+	Longitude float64
+	Days      int
+	client    *http.Client
+}
+
+// NewOpenMeteo returns a provider of a two day forecast for the given location. The public API is used
+// when baseURL is empty.
+func NewOpenMeteo(baseURL string, latitude, longitude float64) (*OpenMeteo, error) {
+	if latitude < -90 || latitude > 90 {
+		return nil, errors.Errorf("invalid latitude %v", latitude)
+	}
+	if longitude < -180 || longitude > 180 {
+		return nil, errors.Errorf("invalid longitude %v", longitude)
+	}
+	if baseURL == "" {
+		baseURL = OpenMeteoURL
+	}
+
+	return &OpenMeteo{
+		BaseURL:   baseURL,
+		Latitude:  latitude,
+		Longitude: longitude,
+		Days:      2,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+type openMeteoResponse struct {
+	Daily struct {
+		Time        []string  `json:"time"`
+		WeatherCode []int     `json:"weathercode"`
+		MaxTemp     []float64 `json:"temperature_2m_max"`
+		MinTemp     []float64 `json:"temperature_2m_min"`
+	} `json:"daily"`
+	Error  bool   `json:"error"`
+	Reason string `json:"reason"`
+}
+
+func (o *OpenMeteo) Forecast(ctx context.Context) ([]Day, error) {
+	params := url.Values{}
+	params.Set("latitude", strconv.FormatFloat(o.Latitude, 'f', -1, 64))
+	params.Set("longitude", strconv.FormatFloat(o.Longitude, 'f', -1, 64))
+	params.Set("daily", "weathercode,temperature_2m_max,temperature_2m_min")
+	params.Set("timezone", "auto")
+	params.Set("forecast_days", strconv.Itoa(o.Days))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(o.BaseURL, "/")+"/v1/forecast?"+params.Encode(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create forecast request")
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not fetch forecast")
+	}
+	defer resp.Body.Close()
+
+	var data openMeteoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, errors.Wrapf(err, "could not decode forecast response (HTTP %d)", resp.StatusCode)
+	}
+	if data.Error {
+		return nil, errors.Errorf("forecast request failed: %s", data.Reason)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("forecast request failed with HTTP %d", resp.StatusCode)
+	}
+
+	daily := data.Daily
+	if len(daily.WeatherCode) != len(daily.Time) || len(daily.MaxTemp) != len(daily.Time) || len(daily.MinTemp) != len(daily.Time) {
+		return nil, errors.New("inconsistent daily forecast data")
+	}
+	days := make([]Day, 0, len(daily.Time))
+	for i := range daily.Time {
+		date, err := time.Parse("2006-01-02", daily.Time[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid forecast date %q", daily.Time[i])
+		}
+		days = append(days, Day{
+			Date:      date,
+			Condition: ConditionFromWMO(daily.WeatherCode[i]),
+			MinTemp:   daily.MinTemp[i],
+			MaxTemp:   daily.MaxTemp[i],
+		})
+	}
+
+	return days, nil
+}
+
+// ConditionFromWMO maps WMO weather interpretation codes used by Open-Meteo onto conditions.
+func ConditionFromWMO(code int) Condition {
+	switch {
+	case code <= 1:
+		return Sunny
+	case code <= 3:
+		return PartlyCloudy
+	case code == 45 || code == 48:
+		return Foggy
+	case code >= 71 && code <= 77, code == 85 || code == 86:
+		return Snow
+	case code >= 95:
+		return Storm
+	default:
+		// drizzle, rain and showers
+		return Rain
+	}
+}
@@ -0,0 +1,141 @@
+package forecast
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"weather-pi/forecast/forecasttest"
+)
+
+func TestConditionFromWMO(t *testing.T) {
+	for code, want := range map[int]Condition{
+		0:  Sunny,
+		1:  Sunny,
+		2:  PartlyCloudy,
+		3:  PartlyCloudy,
+		45: Foggy,
+		48: Foggy,
+		51: Rain,
+		56: Rain,
+		61: Rain,
+		67: Rain,
+		71: Snow,
+		75: Snow,
+		77: Snow,
+		80: Rain,
+		82: Rain,
+		85: Snow,
+		86: Snow,
+		95: Storm,
+		96: Storm,
+		99: Storm,
+	} {
+		if got := ConditionFromWMO(code); got != want {
+			t.Errorf("ConditionFromWMO(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func newTestOpenMeteo(t *testing.T, baseURL string) *OpenMeteo {
+	t.Helper()
+	o, err := NewOpenMeteo(baseURL, 52.23, 21.01)
+	if err != nil {
+		t.Fatalf("NewOpenMeteo() error = %v", err)
+	}
+
+	return o
+}
+
+func TestOpenMeteoForecast(t *testing.T) {
+	server := forecasttest.NewServer(
+		forecasttest.Day{WeatherCode: 3, MinTemp: 4.5, MaxTemp: 11.2},
+		forecasttest.Day{WeatherCode: 63, MinTemp: 2, MaxTemp: 7.8},
+	)
+	defer server.Close()
+
+	days, err := newTestOpenMeteo(t, server.URL).Forecast(context.Background())
+	if err != nil {
+		t.Fatalf("Forecast() error = %v", err)
+	}
+	today := time.Now().UTC()
+	want := []Day{
+		{Date: time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC), Condition: PartlyCloudy, MinTemp: 4.5, MaxTemp: 11.2},
+		{Date: time.Date(today.Year(), today.Month(), today.Day()+1, 0, 0, 0, 0, time.UTC), Condition: Rain, MinTemp: 2, MaxTemp: 7.8},
+	}
+	if len(days) != len(want) {
+		t.Fatalf("Forecast() = %v, want %v", days, want)
+	}
+	for i := range want {
+		if !days[i].Date.Equal(want[i].Date) || days[i].Condition != want[i].Condition || days[i].MinTemp != want[i].MinTemp || days[i].MaxTemp != want[i].MaxTemp {
+			t.Errorf("day %d = %+v, want %+v", i, days[i], want[i])
+		}
+	}
+
+	queries := server.Queries()
+	if len(queries) != 1 {
+		t.Fatalf("%d requests, want 1", len(queries))
+	}
+	query := queries[0]
+	if query.Get("latitude") != "52.23" || query.Get("longitude") != "21.01" || query.Get("forecast_days") != "2" || query.Get("timezone") != "auto" {
+		t.Errorf("forecast request %v", query)
+	}
+}
+
+func TestOpenMeteoErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		status int
+		body   string
+		err    string
+	}{
+		{name: "api error", status: http.StatusBadRequest, body: `{"error": true, "reason": "Latitude must be in range of -90 to 90°."}`, err: "forecast request failed: Latitude must be in range"},
+		{name: "server error", status: http.StatusBadGateway, body: `<html>Bad Gateway</html>`, err: "could not decode forecast response (HTTP 502)"},
+		{name: "unexpected status", status: http.StatusServiceUnavailable, body: `{}`, err: "forecast request failed with HTTP 503"},
+		{name: "inconsistent", status: http.StatusOK, body: `{"daily": {"time": ["2024-03-05", "2024-03-06"], "weathercode": [1], "temperature_2m_max": [1, 2], "temperature_2m_min": [0, 1]}}`, err: "inconsistent daily forecast data"},
+		{name: "invalid date", status: http.StatusOK, body: `{"daily": {"time": ["05.03.2024"], "weathercode": [1], "temperature_2m_max": [1], "temperature_2m_min": [0]}}`, err: `invalid forecast date "05.03.2024"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, err := newTestOpenMeteo(t, server.URL).Forecast(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Forecast() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestOpenMeteoUnreachable(t *testing.T) {
+	server := forecasttest.NewServer()
+	url := server.URL
+	server.Close()
+
+	if _, err := newTestOpenMeteo(t, url).Forecast(context.Background()); err == nil || !strings.Contains(err.Error(), "could not fetch forecast") {
+		t.Errorf("Forecast() error = %v, want a network error", err)
+	}
+}
+
+func TestNewOpenMeteoLocation(t *testing.T) {
+	for _, tt := range []struct {
+		latitude, longitude float64
+		wantErr             bool
+	}{
+		{latitude: 52.23, longitude: 21.01},
+		{latitude: -90, longitude: 180},
+		// a valid location in the Gulf of Guinea
+		{latitude: 0, longitude: 0},
+		{latitude: 91, longitude: 21.01, wantErr: true},
+		{latitude: 52.23, longitude: -181, wantErr: true},
+	} {
+		if _, err := NewOpenMeteo("", tt.latitude, tt.longitude); (err != nil) != tt.wantErr {
+			t.Errorf("NewOpenMeteo(%v, %v) error = %v, wantErr %v", tt.latitude, tt.longitude, err, tt.wantErr)
+		}
+	}
+}
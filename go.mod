@@ -5,16 +5,23 @@ go 1.16
 require (
 	github.com/BurntSushi/graphics-go v0.0.0-20160129215708-b43f31a4a966
 	github.com/MaxHalford/halfgone v0.0.0-20171017091812-482157b86ccb
+	github.com/eclipse/paho.mqtt.golang v1.3.5
+	github.com/gofrs/flock v0.8.1
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/hekmon/go-netatmo v0.0.0-20210909120051-89b2a280c4fa
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.10.0
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/viper v1.7.0
+	github.com/srwiley/oksvg v0.0.0-20200311192757-870daf9aa564
+	github.com/srwiley/rasterx v0.0.0-20200120212402-85cb7272f5e9
 	go.uber.org/multierr v1.6.0 // indirect
 	go.uber.org/zap v1.16.0
 	golang.org/x/image v0.10.0
 	golang.org/x/oauth2 v0.0.0-20210514164344-f6687ab2804c
+	gopkg.in/yaml.v2 v2.4.0
+	modernc.org/sqlite v1.11.2
 	periph.io/x/conn/v3 v3.6.7
 	periph.io/x/host/v3 v3.6.7
 )
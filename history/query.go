@@ -0,0 +1,33 @@
+package history
+
+import (
+	"context"
+	"time"
+	"weather-pi/netatmo"
+
+	"github.com/pkg/errors"
+)
+
+// Samples returns the temperatures of the module since the given time ordered by time.
+// Downsampled hours are returned as their average.
+func (s *Store) Samples(ctx context.Context, module netatmo.ModuleInfo, since time.Time) ([]netatmo.Sample, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT measured_at, temperature FROM readings
+		WHERE device_id = ? AND module_id = ? AND measured_at >= ? AND temperature IS NOT NULL
+		ORDER BY measured_at`, module.DeviceId, module.ModuleId, since.Unix())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query temperatures")
+	}
+	defer rows.Close()
+
+	var samples []netatmo.Sample
+	for rows.Next() {
+		var at int64
+		var value float64
+		if err := rows.Scan(&at, &value); err != nil {
+			return nil, errors.Wrap(err, "could not read temperature")
+		}
+		samples = append(samples, netatmo.Sample{Time: time.Unix(at, 0), Value: value})
+	}
+
+	return samples, errors.Wrap(rows.Err(), "could not read temperatures")
+}
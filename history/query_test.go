@@ -0,0 +1,44 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+	"weather-pi/netatmo"
+)
+
+func TestSamples(t *testing.T) {
+	s := openTestStore(t, Policy{RawRetention: 2 * time.Hour, Retention: 48 * time.Hour})
+	hour := func(h, m int) time.Time { return time.Date(2024, time.March, 5, h, m, 0, 0, time.UTC) }
+	appendOutdoor(t, s, map[time.Time]float64{hour(8, 10): 4, hour(8, 50): 6, hour(11, 0): 8, hour(12, 0): 9})
+	if err := s.Append(context.Background(), []netatmo.Measurement{{ModuleReadings: []netatmo.Reading{
+		{Name: "Rain gauge", Type: netatmo.RainGauge, Module: rainInfo, Timestamp: hour(12, 0), Rain: &netatmo.Rain{SumDay: 1}},
+	}}}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if err := s.Compact(context.Background(), hour(12, 30)); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	samples, err := s.Samples(context.Background(), outdoorInfo, hour(8, 0))
+	if err != nil {
+		t.Fatalf("Samples() error = %v", err)
+	}
+	// the downsampled hour is returned as its average
+	want := []netatmo.Sample{{Time: hour(8, 0), Value: 5}, {Time: hour(11, 0), Value: 8}, {Time: hour(12, 0), Value: 9}}
+	if len(samples) != len(want) {
+		t.Fatalf("samples = %v, want %v", samples, want)
+	}
+	for i := range want {
+		if !samples[i].Time.Equal(want[i].Time) || samples[i].Value != want[i].Value {
+			t.Errorf("sample %d = %v, want %v", i, samples[i], want[i])
+		}
+	}
+
+	if samples, err := s.Samples(context.Background(), outdoorInfo, hour(11, 30)); err != nil || len(samples) != 1 {
+		t.Errorf("Samples() since 11:30 = %v, %v, want the last sample", samples, err)
+	}
+	if samples, err := s.Samples(context.Background(), rainInfo, hour(8, 0)); err != nil || len(samples) != 0 {
+		t.Errorf("Samples() of the rain gauge = %v, %v, want none", samples, err)
+	}
+}
@@ -0,0 +1,214 @@
+// Package history keeps the fetched readings in a local SQLite database so trends can be
+// shown without asking the Netatmo API.
+package history
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"time"
+	"weather-pi/netatmo"
+
+	"github.com/pkg/errors"
+	// pure Go driver, no cgo is needed to cross compile for the Raspberry Pi
+	_ "modernc.org/sqlite"
+)
+
+// DefaultPath is where the history is kept when it is enabled without another file
+const DefaultPath = "/var/lib/weather-pie/history.db"
+
+// Policy controls how long the readings are kept. Zero fields are replaced with the values
+// of DefaultPolicy.
+type Policy struct {
+	// RawRetention is how long every reading is kept before it is averaged into hourly rows
+	RawRetention time.Duration
+	// Retention is how long the hourly rows are kept
+	Retention time.Duration
+}
+
+// DefaultPolicy keeps two days of readings and a year of hourly averages.
+var DefaultPolicy = Policy{
+	RawRetention: 48 * time.Hour,
+	Retention:    365 * 24 * time.Hour,
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.RawRetention <= 0 {
+		p.RawRetention = DefaultPolicy.RawRetention
+	}
+	if p.Retention <= 0 {
+		p.Retention = DefaultPolicy.Retention
+	}
+
+	return p
+}
+
+// downsampledResolution is the time covered by a downsampled row
+const downsampledResolution = time.Hour
+
+// resolution is 0 for the raw readings and the covered seconds for the downsampled rows.
+// Raw min/max temperatures equal the temperature so both kinds of rows are queried the same way.
+const schema = `
+CREATE TABLE IF NOT EXISTS readings (
+	device_id       TEXT NOT NULL,
+	module_id       TEXT NOT NULL,
+	station         TEXT NOT NULL,
+	module          TEXT NOT NULL,
+	type            TEXT NOT NULL,
+	measured_at     INTEGER NOT NULL,
+	resolution      INTEGER NOT NULL,
+	temperature     REAL,
+	min_temperature REAL,
+	max_temperature REAL,
+	humidity        REAL,
+	co2             REAL,
+	noise           REAL,
+	pressure        REAL,
+	rain_today      REAL,
+	wind_strength   REAL,
+	gust_strength   REAL,
+	PRIMARY KEY (device_id, module_id, resolution, measured_at)
+)`
+
+// Store appends the readings to the database and answers the queries of the display.
+type Store struct {
+	db     *sql.DB
+	policy Policy
+}
+
+// Open opens the database creating it when it does not exist yet.
+func Open(path string, policy Policy) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "could not create history directory")
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open history %s", path)
+	}
+	// a single connection keeps the pragmas applied and the writes serialized
+	db.SetMaxOpenConns(1)
+	for _, statement := range []string{"PRAGMA busy_timeout = 5000", "PRAGMA journal_mode = WAL", schema} {
+		if _, err := db.Exec(statement); err != nil {
+			_ = db.Close()
+			return nil, errors.Wrapf(err, "could not initialize history %s", path)
+		}
+	}
+
+	return &Store{db: db, policy: policy.withDefaults()}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Append stores the readings. Readings which have already been stored (the module has not
+// sent anything new since the previous fetch) are skipped, also when they have been
+// downsampled since as the hourly row already includes them.
+func (s *Store) Append(ctx context.Context, measurements []netatmo.Measurement) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "could not start transaction")
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO readings
+		(device_id, module_id, station, module, type, measured_at, resolution, temperature, min_temperature, max_temperature,
+		 humidity, co2, noise, pressure, rain_today, wind_strength, gust_strength)
+		SELECT ?1, ?2, ?3, ?4, ?5, ?6, 0, ?7, ?7, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14
+		WHERE NOT EXISTS (SELECT 1 FROM readings
+			WHERE device_id = ?1 AND module_id = ?2 AND resolution = ?15 AND measured_at = ?6 - ?6 % ?15)`)
+	if err != nil {
+		return errors.Wrap(err, "could not prepare insert")
+	}
+	defer insert.Close()
+
+	bucket := int64(downsampledResolution / time.Second)
+	for _, measurement := range measurements {
+		for _, reading := range measurement.Readings() {
+			if reading.Timestamp.IsZero() {
+				continue
+			}
+			v := newValues(reading)
+			_, err := insert.ExecContext(ctx, reading.Module.DeviceId, reading.Module.ModuleId, measurement.StationName,
+				reading.Name, string(reading.Type), reading.Timestamp.Unix(), v.temperature,
+				v.humidity, v.co2, v.noise, v.pressure, v.rainToday, v.windStrength, v.gustStrength, bucket)
+			if err != nil {
+				return errors.Wrapf(err, "could not store %s reading", reading.Name)
+			}
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "could not commit readings")
+}
+
+// values holds the columns of a reading, nil for the values the module does not measure
+type values struct {
+	temperature, humidity, co2, noise, pressure, rainToday, windStrength, gustStrength *float64
+}
+
+func newValues(reading netatmo.Reading) values {
+	var v values
+	float := func(value float64) *float64 { return &value }
+	optional := func(value *int64) *float64 {
+		if value == nil {
+			return nil
+		}
+		return float(float64(*value))
+	}
+
+	if reading.Type.HasTemperature() {
+		v.temperature = float(reading.Temperature)
+		v.humidity = float(float64(reading.Humidity))
+	}
+	v.co2 = optional(reading.CO2)
+	v.noise = optional(reading.Noise)
+	if reading.Pressure != nil {
+		v.pressure = float(reading.Pressure.Value)
+	}
+	if reading.Rain != nil {
+		v.rainToday = float(reading.Rain.SumDay)
+	}
+	if reading.Wind != nil {
+		v.windStrength = float(float64(reading.Wind.Strength))
+		v.gustStrength = float(float64(reading.Wind.GustStrength))
+	}
+
+	return v
+}
+
+// Compact averages the readings older than the raw retention into hourly rows and removes
+// the rows older than the retention. The extremes of the temperature are kept.
+func (s *Store) Compact(ctx context.Context, now time.Time) error {
+	bucket := int64(downsampledResolution / time.Second)
+	// only whole hours are downsampled so every hour ends up in a single row
+	rawCutoff := now.Add(-s.policy.RawRetention).Unix()
+	rawCutoff -= rawCutoff % bucket
+	cutoff := now.Add(-s.policy.Retention).Unix()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "could not start transaction")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO readings
+		(device_id, module_id, station, module, type, measured_at, resolution, temperature, min_temperature, max_temperature,
+		 humidity, co2, noise, pressure, rain_today, wind_strength, gust_strength)
+		SELECT device_id, module_id, MAX(station), MAX(module), MAX(type), measured_at - measured_at % ?1, ?1,
+			AVG(temperature), MIN(min_temperature), MAX(max_temperature), AVG(humidity), AVG(co2), AVG(noise),
+			AVG(pressure), MAX(rain_today), AVG(wind_strength), MAX(gust_strength)
+		FROM readings WHERE resolution = 0 AND measured_at < ?2
+		GROUP BY device_id, module_id, measured_at - measured_at % ?1`, bucket, rawCutoff)
+	if err != nil {
+		return errors.Wrap(err, "could not downsample readings")
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM readings WHERE resolution = 0 AND measured_at < ?", rawCutoff); err != nil {
+		return errors.Wrap(err, "could not remove downsampled readings")
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM readings WHERE measured_at < ?", cutoff); err != nil {
+		return errors.Wrap(err, "could not remove expired readings")
+	}
+
+	return errors.Wrap(tx.Commit(), "could not commit compaction")
+}
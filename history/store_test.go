@@ -0,0 +1,229 @@
+package history
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+	"weather-pi/netatmo"
+)
+
+var (
+	stationInfo = netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01"}
+	outdoorInfo = netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01", ModuleId: "02:00:00:00:00:01"}
+	rainInfo    = netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01", ModuleId: "05:00:00:00:00:01"}
+)
+
+func openTestStore(t *testing.T, policy Policy) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "history.db"), policy)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	return s
+}
+
+// outdoor returns a measurement with a single outdoor reading
+func outdoor(at time.Time, temperature float64) []netatmo.Measurement {
+	return []netatmo.Measurement{{
+		StationName:    "Home",
+		ModuleReadings: []netatmo.Reading{{Name: "Outdoor", Type: netatmo.OutdoorModule, Module: outdoorInfo, Timestamp: at, Temperature: temperature, Humidity: 80}},
+	}}
+}
+
+func appendOutdoor(t *testing.T, s *Store, temperatures map[time.Time]float64) {
+	t.Helper()
+	for at, temperature := range temperatures {
+		if err := s.Append(context.Background(), outdoor(at, temperature)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+}
+
+func countRows(t *testing.T, s *Store, where string, args ...interface{}) int {
+	t.Helper()
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM readings WHERE "+where, args...).Scan(&count); err != nil {
+		t.Fatalf("could not count rows: %v", err)
+	}
+
+	return count
+}
+
+type hourlyRow struct {
+	temperature, min, max float64
+}
+
+func hourlyRows(t *testing.T, s *Store) map[time.Time]hourlyRow {
+	t.Helper()
+	rows, err := s.db.Query("SELECT measured_at, temperature, min_temperature, max_temperature FROM readings WHERE resolution = 3600")
+	if err != nil {
+		t.Fatalf("could not query hourly rows: %v", err)
+	}
+	defer rows.Close()
+
+	hours := map[time.Time]hourlyRow{}
+	for rows.Next() {
+		var at int64
+		var row hourlyRow
+		if err := rows.Scan(&at, &row.temperature, &row.min, &row.max); err != nil {
+			t.Fatalf("could not read hourly row: %v", err)
+		}
+		hours[time.Unix(at, 0).UTC()] = row
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("could not read hourly rows: %v", err)
+	}
+
+	return hours
+}
+
+func TestAppend(t *testing.T) {
+	s := openTestStore(t, Policy{})
+	at := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	co2, noise := int64(600), int64(40)
+	measurements := []netatmo.Measurement{{
+		StationName: "Home",
+		StationReading: &netatmo.Reading{
+			Name: "Living room", Type: netatmo.BaseStation, Module: stationInfo, Timestamp: at, Temperature: 21.5, Humidity: 45,
+			CO2: &co2, Noise: &noise, Pressure: &netatmo.Pressure{Value: 1013.2},
+		},
+		ModuleReadings: []netatmo.Reading{
+			{Name: "Rain gauge", Type: netatmo.RainGauge, Module: rainInfo, Timestamp: at, Rain: &netatmo.Rain{Current: 0.1, SumDay: 2.7}},
+			// the module has not sent any data
+			{Name: "Bedroom", Type: netatmo.IndoorModule, Module: netatmo.ModuleInfo{DeviceId: stationInfo.DeviceId, ModuleId: "03:00:00:00:00:01"}},
+		},
+	}}
+
+	if err := s.Append(context.Background(), measurements); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if rows := countRows(t, s, "1"); rows != 2 {
+		t.Errorf("%d rows, want the station and the rain gauge", rows)
+	}
+	if rows := countRows(t, s, "module_id = '' AND temperature = 21.5 AND co2 = 600 AND pressure = 1013.2 AND rain_today IS NULL"); rows != 1 {
+		t.Error("the station reading has not been stored")
+	}
+	if rows := countRows(t, s, "module_id = ? AND temperature IS NULL AND rain_today = 2.7", rainInfo.ModuleId); rows != 1 {
+		t.Error("the rain gauge reading has not been stored")
+	}
+
+	// the module has not sent anything new so the next fetch returns the same reading
+	measurements[0].StationReading.Temperature = 30
+	if err := s.Append(context.Background(), measurements); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if rows := countRows(t, s, "1"); rows != 2 {
+		t.Errorf("%d rows after appending the same readings, want 2", rows)
+	}
+	if rows := countRows(t, s, "module_id = '' AND temperature = 21.5"); rows != 1 {
+		t.Error("the stored reading has been replaced")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	s := openTestStore(t, Policy{RawRetention: 2 * time.Hour, Retention: 48 * time.Hour})
+	hour := func(h, m int) time.Time { return time.Date(2024, time.March, 5, h, m, 0, 0, time.UTC) }
+	appendOutdoor(t, s, map[time.Time]float64{
+		hour(8, 5): 5, hour(8, 25): 7, hour(8, 45): 6,
+		hour(9, 10): 10, hour(9, 50): 12,
+		// the hour crossing the raw retention stays raw until it has passed completely
+		hour(10, 10): 11, hour(10, 40): 13,
+		hour(12, 0): 14,
+	})
+
+	now := hour(12, 30)
+	if err := s.Compact(context.Background(), now); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	want := map[time.Time]hourlyRow{
+		hour(8, 0): {temperature: 6, min: 5, max: 7},
+		hour(9, 0): {temperature: 11, min: 10, max: 12},
+	}
+	checkHourlyRows(t, s, want)
+	if rows := countRows(t, s, "resolution = 0"); rows != 3 {
+		t.Errorf("%d raw rows, want the 3 since 10:00", rows)
+	}
+
+	// compacting again does not touch the hours already downsampled
+	if err := s.Compact(context.Background(), now); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	checkHourlyRows(t, s, want)
+
+	// the hour is downsampled once it has passed the raw retention
+	if err := s.Compact(context.Background(), hour(13, 0)); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	want[hour(10, 0)] = hourlyRow{temperature: 12, min: 11, max: 13}
+	checkHourlyRows(t, s, want)
+	if rows := countRows(t, s, "resolution = 0"); rows != 1 {
+		t.Errorf("%d raw rows, want the one at 12:00", rows)
+	}
+}
+
+func TestCompactStaleReading(t *testing.T) {
+	s := openTestStore(t, Policy{RawRetention: 2 * time.Hour, Retention: 48 * time.Hour})
+	hour := func(h, m int) time.Time { return time.Date(2024, time.March, 5, h, m, 0, 0, time.UTC) }
+	appendOutdoor(t, s, map[time.Time]float64{hour(8, 5): 5, hour(8, 25): 7, hour(8, 45): 6})
+	want := map[time.Time]hourlyRow{hour(8, 0): {temperature: 6, min: 5, max: 7}}
+
+	// the module stopped reporting, every refresh returns its last reading again
+	// after it has been downsampled
+	for _, now := range []time.Time{hour(12, 0), hour(12, 10), hour(12, 20)} {
+		appendOutdoor(t, s, map[time.Time]float64{hour(8, 45): 6})
+		if err := s.Compact(context.Background(), now); err != nil {
+			t.Fatalf("Compact() error = %v", err)
+		}
+		checkHourlyRows(t, s, want)
+	}
+	if rows := countRows(t, s, "resolution = 0"); rows != 0 {
+		t.Errorf("%d raw rows, want the stale reading to be skipped", rows)
+	}
+}
+
+func checkHourlyRows(t *testing.T, s *Store, want map[time.Time]hourlyRow) {
+	t.Helper()
+	hours := hourlyRows(t, s)
+	if len(hours) != len(want) {
+		t.Errorf("hourly rows = %v, want %v", hours, want)
+	}
+	for at, row := range want {
+		if hours[at] != row {
+			t.Errorf("hourly row at %s = %+v, want %+v", at.Format("15:04"), hours[at], row)
+		}
+	}
+}
+
+func TestCompactExpiry(t *testing.T) {
+	s := openTestStore(t, Policy{RawRetention: 2 * time.Hour, Retention: 48 * time.Hour})
+	now := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	appendOutdoor(t, s, map[time.Time]float64{
+		now.Add(-50 * time.Hour): 1,
+		now.Add(-47 * time.Hour): 2,
+		now.Add(-time.Hour):      3,
+	})
+	if err := s.Compact(context.Background(), now); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	// an expired hour written by an earlier compaction is removed as well
+	if _, err := s.db.Exec(`INSERT INTO readings (device_id, module_id, station, module, type, measured_at, resolution, temperature)
+		VALUES (?, ?, 'Home', 'Outdoor', 'NAModule1', ?, 3600, 0)`, outdoorInfo.DeviceId, outdoorInfo.ModuleId, now.Add(-49*time.Hour).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Compact(context.Background(), now); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	if rows := countRows(t, s, "measured_at < ?", now.Add(-48*time.Hour).Unix()); rows != 0 {
+		t.Errorf("%d expired rows have been kept", rows)
+	}
+	if rows := countRows(t, s, "resolution = 3600 AND measured_at = ?", now.Add(-47*time.Hour).Unix()); rows != 1 {
+		t.Error("the hour within the retention has been removed")
+	}
+	if rows := countRows(t, s, "resolution = 0"); rows != 1 {
+		t.Errorf("%d raw rows, want the last one", rows)
+	}
+}
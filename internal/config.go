@@ -3,19 +3,118 @@ package internal
 import "time"
 
 type Config struct {
-	LogLevel     string        `yaml:"LogLevel"`
-	ClientId     string        `yaml:"ClientId"`
-	ClientSecret string        `yaml:"ClientSecret"`
-	Token        string        `yaml:"Token"`
-	RefreshToken string        `yaml:"RefreshToken"`
-	TokenExpiry  string        `yaml:"TokenExpiry"`
-	Sources      []Source      `yaml:"Sources"`
-	TestMode     bool          `yaml:"TestMode"`
-	Rotate180    bool          `yaml:"Rotate180"`
-	TimeWindow   time.Duration `yaml:"TimeWindow"`
+	LogLevel        string        `yaml:"LogLevel"`
+	ClientId        string        `yaml:"ClientId"`
+	ClientSecret    string        `yaml:"ClientSecret"`
+	Token           string        `yaml:"Token"`
+	RefreshToken    string        `yaml:"RefreshToken"`
+	TokenExpiry     string        `yaml:"TokenExpiry"`
+	TokenFile       string        `yaml:"TokenFile"`
+	Sources         []Source      `yaml:"Sources"`
+	TestMode        bool          `yaml:"TestMode"`
+	Rotate180       bool          `yaml:"Rotate180"`
+	TimeWindow      time.Duration `yaml:"TimeWindow"`
+	RefreshInterval time.Duration `yaml:"RefreshInterval"`
+	ReplayFile      string        `yaml:"ReplayFile"`
+	APIURL          string        `yaml:"APIURL"`
+	Retry           Retry         `yaml:"Retry"`
+	CacheFile       string        `yaml:"CacheFile"`
+	StaleAfter      time.Duration `yaml:"StaleAfter"`
+	ModuleMaxAge    time.Duration `yaml:"ModuleMaxAge"`
+	History         History       `yaml:"History"`
+	PanesPerPage    int           `yaml:"PanesPerPage"`
+	StationLayout   string        `yaml:"StationLayout"`
+	LayoutFile      string        `yaml:"LayoutFile"`
+	Fonts           Fonts         `yaml:"Fonts"`
+	Display         Display       `yaml:"Display"`
+	Forecast        Forecast      `yaml:"Forecast"`
+	Dashboard       Dashboard     `yaml:"Dashboard"`
+	Metrics         Metrics       `yaml:"Metrics"`
+	MQTT            MQTT          `yaml:"MQTT"`
+	Login           Login         `yaml:"Login"`
 }
 
+// Retry controls how failed Netatmo requests are retried, zero values fall back to the defaults.
+type Retry struct {
+	Attempts       int           `yaml:"Attempts"`
+	InitialBackoff time.Duration `yaml:"InitialBackoff"`
+	MaxBackoff     time.Duration `yaml:"MaxBackoff"`
+	// RequestTimeout limits a single try of a request
+	RequestTimeout time.Duration `yaml:"RequestTimeout"`
+}
+
+// History keeps every reading in a local database, zero retentions fall back to the defaults.
+type History struct {
+	// File is the SQLite database, empty disables the history
+	File         string        `yaml:"File"`
+	RawRetention time.Duration `yaml:"RawRetention"`
+	Retention    time.Duration `yaml:"Retention"`
+}
+
+// Fonts selects the font of every text role by the name of an embedded Go font or the path
+// of a TTF, OTF, BDF or PCF file.
+type Fonts struct {
+	Value  string `yaml:"Value"`
+	Label  string `yaml:"Label"`
+	Status string `yaml:"Status"`
+	// DPI converts the font sizes to pixels, the resolution of the display when zero
+	DPI float64 `yaml:"DPI"`
+}
+
+type Display struct {
+	Model string `yaml:"Model"`
+}
+
+type Forecast struct {
+	Provider  string  `yaml:"Provider"`
+	URL       string  `yaml:"URL"`
+	Latitude  float64 `yaml:"Latitude"`
+	Longitude float64 `yaml:"Longitude"`
+}
+
+type Dashboard struct {
+	// Listen is the address of the HTTP dashboard served by the daemon, empty disables it
+	Listen string `yaml:"Listen"`
+}
+
+type Metrics struct {
+	// Listen is the address of the Prometheus endpoint served by the daemon, empty disables it
+	Listen string `yaml:"Listen"`
+}
+
+type MQTT struct {
+	// Broker is the address of the MQTT broker (e.g. tcp://localhost:1883), empty disables publishing
+	Broker          string `yaml:"Broker"`
+	ClientID        string `yaml:"ClientID"`
+	Username        string `yaml:"Username"`
+	Password        string `yaml:"Password"`
+	TopicPrefix     string `yaml:"TopicPrefix"`
+	DiscoveryPrefix string `yaml:"DiscoveryPrefix"`
+}
+
+type Login struct {
+	// CallbackListen is the address of the OAuth redirect listener of the login command
+	CallbackListen string        `yaml:"CallbackListen"`
+	Timeout        time.Duration `yaml:"Timeout"`
+}
+
+// Source selects a station and its modules. The station is matched by DeviceId when it is set,
+// otherwise by the name of the home.
 type Source struct {
-	StationName string   `yaml:"StationName"`
-	ModuleNames []string `yaml:"ModuleNames"`
+	StationName string `yaml:"StationName,omitempty"`
+	// DeviceId is the MAC address of the base station (e.g. 70:ee:50:00:00:01)
+	DeviceId    string   `yaml:"DeviceId,omitempty"`
+	ModuleNames []string `yaml:"ModuleNames,omitempty"`
+	Modules     []Module `yaml:"Modules,omitempty"`
+}
+
+// Module selects a module of the station by its MAC address or, when Id is empty, by its name.
+// The base station itself can be given an alias by using the DeviceId of the source as Id.
+type Module struct {
+	Id   string `yaml:"Id,omitempty"`
+	Name string `yaml:"Name,omitempty"`
+	// Alias replaces the name set in the Netatmo app on the display
+	Alias string `yaml:"Alias,omitempty"`
+	// MaxAge overrides ModuleMaxAge for the module, e.g. for the rain gauge which reports less often
+	MaxAge time.Duration `yaml:"MaxAge,omitempty"`
 }
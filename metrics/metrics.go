@@ -0,0 +1,180 @@
+// Package metrics exposes the readings and the health of the daemon to Prometheus.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+	"weather-pi/netatmo"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "weatherpie"
+
+var (
+	// RefreshDuration tracks how long it takes to fetch the data and redraw the display
+	RefreshDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "refresh_duration_seconds",
+		Help:      "Time spent fetching the measurements and refreshing the display.",
+		Buckets:   []float64{1, 2, 5, 10, 15, 20, 30, 45, 60, 120},
+	})
+
+	// LastDisplayUpdate is the time of the last successful display refresh
+	LastDisplayUpdate = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_display_update_timestamp_seconds",
+		Help:      "Unix time of the last successful display refresh.",
+	})
+)
+
+// readingLabels name the reading, module_id tells apart the modules sharing a name
+var readingLabels = []string{"station", "module", "module_id"}
+
+var (
+	temperatureDesc = prometheus.NewDesc(namespace+"_temperature_celsius", "Current temperature.", readingLabels, nil)
+	minTempDesc     = prometheus.NewDesc(namespace+"_min_temperature_celsius", "Minimum temperature of the day.", readingLabels, nil)
+	maxTempDesc     = prometheus.NewDesc(namespace+"_max_temperature_celsius", "Maximum temperature of the day.", readingLabels, nil)
+	humidityDesc    = prometheus.NewDesc(namespace+"_humidity_percent", "Current relative humidity.", readingLabels, nil)
+	readingAgeDesc  = prometheus.NewDesc(namespace+"_reading_age_seconds", "Time since the module measured the reading.", readingLabels, nil)
+	co2Desc         = prometheus.NewDesc(namespace+"_co2_ppm", "Current CO2 level.", readingLabels, nil)
+	noiseDesc       = prometheus.NewDesc(namespace+"_noise_decibels", "Current noise level.", readingLabels, nil)
+	pressureDesc    = prometheus.NewDesc(namespace+"_pressure_mbar", "Current pressure at sea level.", readingLabels, nil)
+	rainDesc        = prometheus.NewDesc(namespace+"_rain_mm", "Rain in the last measurement period.", readingLabels, nil)
+	rainHourDesc    = prometheus.NewDesc(namespace+"_rain_last_hour_mm", "Rain in the last hour.", readingLabels, nil)
+	rainDayDesc     = prometheus.NewDesc(namespace+"_rain_today_mm", "Rain since midnight.", readingLabels, nil)
+	windDesc        = prometheus.NewDesc(namespace+"_wind_strength_kmh", "Current wind strength.", readingLabels, nil)
+	windAngleDesc   = prometheus.NewDesc(namespace+"_wind_angle_degrees", "Current wind direction.", readingLabels, nil)
+	gustDesc        = prometheus.NewDesc(namespace+"_gust_strength_kmh", "Strength of the last gust.", readingLabels, nil)
+	batteryDesc     = prometheus.NewDesc(namespace+"_battery_percent", "Battery level of the module.", readingLabels, nil)
+	rfStatusDesc    = prometheus.NewDesc(namespace+"_rf_status", "Radio signal quality between the module and the station.", readingLabels, nil)
+	wifiStatusDesc  = prometheus.NewDesc(namespace+"_wifi_status", "Wi-Fi signal quality of the station.", readingLabels, nil)
+	reachableDesc   = prometheus.NewDesc(namespace+"_reachable", "Whether the station or the module is reachable.", readingLabels, nil)
+	staleDesc       = prometheus.NewDesc(namespace+"_reading_stale", "Whether the module stopped reporting (older than its max age or unreachable).", readingLabels, nil)
+)
+
+// Readings exports the latest fetched readings as gauges labelled by station, module and module ID.
+type Readings struct {
+	mu           sync.Mutex
+	measurements []netatmo.Measurement
+	// maxAge is the default age after which a reading is stale
+	maxAge time.Duration
+}
+
+func NewReadings(maxAge time.Duration) *Readings {
+	return &Readings{maxAge: maxAge}
+}
+
+// Update replaces the exported readings.
+func (r *Readings) Update(measurements []netatmo.Measurement) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.measurements = measurements
+}
+
+func (r *Readings) Describe(ch chan<- *prometheus.Desc) {
+	ch <- temperatureDesc
+	ch <- minTempDesc
+	ch <- maxTempDesc
+	ch <- humidityDesc
+	ch <- readingAgeDesc
+	ch <- co2Desc
+	ch <- noiseDesc
+	ch <- pressureDesc
+	ch <- rainDesc
+	ch <- rainHourDesc
+	ch <- rainDayDesc
+	ch <- windDesc
+	ch <- windAngleDesc
+	ch <- gustDesc
+	ch <- batteryDesc
+	ch <- rfStatusDesc
+	ch <- wifiStatusDesc
+	ch <- reachableDesc
+	ch <- staleDesc
+}
+
+func (r *Readings) Collect(ch chan<- prometheus.Metric) {
+	r.mu.Lock()
+	measurements := r.measurements
+	r.mu.Unlock()
+
+	now := time.Now()
+	// a module selected by several sources would be exported twice and fail the whole scrape
+	collected := map[netatmo.ModuleInfo]bool{}
+	for _, measurement := range measurements {
+		for _, reading := range measurement.Readings() {
+			if collected[reading.Module] {
+				continue
+			}
+			collected[reading.Module] = true
+			labels := []string{measurement.StationName, reading.Name, moduleID(reading)}
+			gauge := func(desc *prometheus.Desc, value float64) {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+			}
+			optionalGauge := func(desc *prometheus.Desc, value *int64) {
+				if value != nil {
+					gauge(desc, float64(*value))
+				}
+			}
+
+			if reading.Type.HasTemperature() {
+				gauge(temperatureDesc, reading.Temperature)
+				gauge(minTempDesc, reading.MinTemp)
+				gauge(maxTempDesc, reading.MaxTemp)
+				gauge(humidityDesc, float64(reading.Humidity))
+			}
+			if !reading.Timestamp.IsZero() {
+				gauge(readingAgeDesc, now.Sub(reading.Timestamp).Seconds())
+			}
+			optionalGauge(co2Desc, reading.CO2)
+			optionalGauge(noiseDesc, reading.Noise)
+			if reading.Pressure != nil {
+				gauge(pressureDesc, reading.Pressure.Value)
+			}
+			if reading.Rain != nil {
+				gauge(rainDesc, reading.Rain.Current)
+				gauge(rainHourDesc, reading.Rain.SumHour)
+				gauge(rainDayDesc, reading.Rain.SumDay)
+			}
+			if reading.Wind != nil {
+				gauge(windDesc, float64(reading.Wind.Strength))
+				gauge(windAngleDesc, float64(reading.Wind.Angle))
+				gauge(gustDesc, float64(reading.Wind.GustStrength))
+			}
+			optionalGauge(batteryDesc, reading.Status.Battery)
+			optionalGauge(rfStatusDesc, reading.Status.RFStatus)
+			optionalGauge(wifiStatusDesc, reading.Status.WifiStatus)
+			if reading.Type != "" {
+				reachable := 0.0
+				if reading.Status.Reachable {
+					reachable = 1
+				}
+				gauge(reachableDesc, reachable)
+			}
+			stale := 0.0
+			if reading.Freshness(now, r.maxAge) != netatmo.Fresh {
+				stale = 1
+			}
+			gauge(staleDesc, stale)
+		}
+	}
+}
+
+// moduleID is the ID of the module or the one of the station for the station reading
+func moduleID(reading netatmo.Reading) string {
+	if reading.Module.ModuleId != "" {
+		return reading.Module.ModuleId
+	}
+
+	return reading.Module.DeviceId
+}
+
+// Handler serves all the registered metrics.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+	"weather-pi/netatmo"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestReadingsModuleID(t *testing.T) {
+	battery := int64(80)
+	now := time.Now()
+	// two modules with the same name must not collide
+	readings := NewReadings(time.Hour)
+	readings.Update([]netatmo.Measurement{{
+		StationName: "Home",
+		StationReading: &netatmo.Reading{
+			Name: "Indoor", Type: netatmo.BaseStation, Timestamp: now, Temperature: 21,
+			Module: netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01"},
+		},
+		ModuleReadings: []netatmo.Reading{
+			{
+				Name: "Outdoor", Type: netatmo.OutdoorModule, Timestamp: now, Temperature: 5, Status: netatmo.Status{Battery: &battery},
+				Module: netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01", ModuleId: "02:00:00:00:00:01"},
+			},
+			{
+				Name: "Outdoor", Type: netatmo.OutdoorModule, Timestamp: now, Temperature: 7, Status: netatmo.Status{Battery: &battery},
+				Module: netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01", ModuleId: "02:00:00:00:00:02"},
+			},
+		},
+	}})
+
+	temperatures := gatherTemperatures(t, readings)
+	want := map[string]float64{
+		"Indoor/70:ee:50:00:00:01":  21,
+		"Outdoor/02:00:00:00:00:01": 5,
+		"Outdoor/02:00:00:00:00:02": 7,
+	}
+	if len(temperatures) != len(want) {
+		t.Fatalf("temperatures = %v, want %v", temperatures, want)
+	}
+	for key, value := range want {
+		if temperatures[key] != value {
+			t.Errorf("temperature of %s = %v, want %v", key, temperatures[key], value)
+		}
+	}
+}
+
+func TestReadingsDuplicateModule(t *testing.T) {
+	now := time.Now()
+	station := netatmo.Reading{
+		Name: "Indoor", Type: netatmo.BaseStation, Timestamp: now, Temperature: 21,
+		Module: netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01"},
+	}
+	outdoor := netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01", ModuleId: "02:00:00:00:00:01"}
+	// the module is configured by ID with an alias and by name, and the station is
+	// selected by two sources
+	readings := NewReadings(time.Hour)
+	readings.Update([]netatmo.Measurement{
+		{
+			StationName:    "Home",
+			StationReading: &station,
+			ModuleReadings: []netatmo.Reading{
+				{Name: "Garden", Type: netatmo.OutdoorModule, Timestamp: now, Temperature: 5, Module: outdoor},
+				{Name: "Outdoor", Type: netatmo.OutdoorModule, Timestamp: now, Temperature: 5, Module: outdoor},
+			},
+		},
+		{StationName: "Home", StationReading: &station},
+	})
+
+	temperatures := gatherTemperatures(t, readings)
+	want := map[string]float64{
+		"Indoor/70:ee:50:00:00:01": 21,
+		"Garden/02:00:00:00:00:01": 5,
+	}
+	if len(temperatures) != len(want) {
+		t.Fatalf("temperatures = %v, want %v", temperatures, want)
+	}
+	for key, value := range want {
+		if temperatures[key] != value {
+			t.Errorf("temperature of %s = %v, want %v", key, temperatures[key], value)
+		}
+	}
+}
+
+// gatherTemperatures scrapes the readings and returns the temperatures by module name and ID
+func gatherTemperatures(t *testing.T, readings *Readings) map[string]float64 {
+	t.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(readings)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+
+	temperatures := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "weatherpie_temperature_celsius" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, pair := range metric.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			temperatures[labels["module"]+"/"+labels["module_id"]] = metric.GetGauge().GetValue()
+		}
+	}
+
+	return temperatures
+}
@@ -0,0 +1,124 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"time"
+	"weather-pi/netatmo"
+)
+
+type sensor struct {
+	key         string
+	name        string
+	unit        string
+	deviceClass string
+	stateClass  string
+}
+
+// sensors lists the values of a reading announced to Home Assistant, key is the field of the state.
+// Only the values present in the state of the reading are announced.
+var sensors = []sensor{
+	{key: "temperature", name: "Temperature", unit: "°C", deviceClass: "temperature", stateClass: "measurement"},
+	{key: "min_temperature", name: "Min temperature", unit: "°C", deviceClass: "temperature"},
+	{key: "max_temperature", name: "Max temperature", unit: "°C", deviceClass: "temperature"},
+	{key: "humidity", name: "Humidity", unit: "%", deviceClass: "humidity", stateClass: "measurement"},
+	{key: "co2", name: "CO2", unit: "ppm", deviceClass: "carbon_dioxide", stateClass: "measurement"},
+	{key: "noise", name: "Noise", unit: "dB", stateClass: "measurement"},
+	{key: "pressure", name: "Pressure", unit: "mbar", deviceClass: "pressure", stateClass: "measurement"},
+	{key: "rain", name: "Rain", unit: "mm", stateClass: "measurement"},
+	{key: "rain_hour", name: "Rain last hour", unit: "mm"},
+	{key: "rain_day", name: "Rain today", unit: "mm"},
+	{key: "wind_strength", name: "Wind strength", unit: "km/h", stateClass: "measurement"},
+	{key: "wind_angle", name: "Wind angle", unit: "°"},
+	{key: "gust_strength", name: "Gust strength", unit: "km/h", stateClass: "measurement"},
+	{key: "gust_angle", name: "Gust angle", unit: "°"},
+	{key: "battery", name: "Battery", unit: "%", deviceClass: "battery", stateClass: "measurement"},
+	{key: "timestamp", name: "Last measurement", deviceClass: "timestamp"},
+}
+
+// state is published to the state topic of every reading, values the module does not measure are left out
+type state struct {
+	Temperature    *float64  `json:"temperature,omitempty"`
+	MinTemperature *float64  `json:"min_temperature,omitempty"`
+	MaxTemperature *float64  `json:"max_temperature,omitempty"`
+	Humidity       *int64    `json:"humidity,omitempty"`
+	CO2            *int64    `json:"co2,omitempty"`
+	Noise          *int64    `json:"noise,omitempty"`
+	Pressure       *float64  `json:"pressure,omitempty"`
+	Rain           *float64  `json:"rain,omitempty"`
+	RainHour       *float64  `json:"rain_hour,omitempty"`
+	RainDay        *float64  `json:"rain_day,omitempty"`
+	WindStrength   *int64    `json:"wind_strength,omitempty"`
+	WindAngle      *int64    `json:"wind_angle,omitempty"`
+	GustStrength   *int64    `json:"gust_strength,omitempty"`
+	GustAngle      *int64    `json:"gust_angle,omitempty"`
+	Battery        *int64    `json:"battery,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+func newState(reading netatmo.Reading) state {
+	s := state{
+		CO2:       reading.CO2,
+		Noise:     reading.Noise,
+		Battery:   reading.Status.Battery,
+		Timestamp: reading.Timestamp,
+	}
+	if reading.Type.HasTemperature() {
+		s.Temperature = &reading.Temperature
+		s.MinTemperature = &reading.MinTemp
+		s.MaxTemperature = &reading.MaxTemp
+		s.Humidity = &reading.Humidity
+	}
+	if reading.Pressure != nil {
+		s.Pressure = &reading.Pressure.Value
+	}
+	if reading.Rain != nil {
+		s.Rain = &reading.Rain.Current
+		s.RainHour = &reading.Rain.SumHour
+		s.RainDay = &reading.Rain.SumDay
+	}
+	if reading.Wind != nil {
+		s.WindStrength = &reading.Wind.Strength
+		s.WindAngle = &reading.Wind.Angle
+		s.GustStrength = &reading.Wind.GustStrength
+		s.GustAngle = &reading.Wind.GustAngle
+	}
+
+	return s
+}
+
+// fields returns the keys of the values present in the state
+func (s state) fields() (map[string]bool, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(payload, &values); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]bool, len(values))
+	for key := range values {
+		fields[key] = true
+	}
+
+	return fields, nil
+}
+
+// discoveryConfig is the payload of Home Assistant MQTT discovery of a sensor
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	AvailabilityTopic string          `json:"availability_topic"`
+	ValueTemplate     string          `json:"value_template"`
+	Unit              string          `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	StateClass        string          `json:"state_class,omitempty"`
+	Device            discoveryDevice `json:"device"`
+}
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
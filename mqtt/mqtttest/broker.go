@@ -0,0 +1,208 @@
+// Package mqtttest provides a minimal local MQTT broker stand-in which records published messages.
+package mqtttest
+
+import (
+	"net"
+	"sync"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/pkg/errors"
+)
+
+// Message is a message published to the broker.
+type Message struct {
+	ClientID string
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retained bool
+}
+
+// Broker accepts MQTT 3.1.1 connections on a local port. Published messages are recorded
+// instead of being delivered to subscribers.
+type Broker struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	username string
+	password string
+	messages []Message
+	retained map[string]Message
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// NewBroker starts a broker listening on a random local port.
+func NewBroker() (*Broker, error) {
+	return ListenBroker("127.0.0.1:0")
+}
+
+// ListenBroker starts a broker listening on the given address.
+func ListenBroker(address string) (*Broker, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not listen for MQTT connections")
+	}
+
+	b := &Broker{listener: listener, retained: map[string]Message{}, conns: map[net.Conn]struct{}{}}
+	b.wg.Add(1)
+	go b.serve()
+
+	return b, nil
+}
+
+// URL returns the address clients should connect to.
+func (b *Broker) URL() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+// SetCredentials makes the broker refuse clients without the given username and password.
+func (b *Broker) SetCredentials(username, password string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.username, b.password = username, password
+}
+
+// Messages returns all the messages published so far.
+func (b *Broker) Messages() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]Message(nil), b.messages...)
+}
+
+// Retained returns the retained message of the topic.
+func (b *Broker) Retained(topic string) (Message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	msg, ok := b.retained[topic]
+	return msg, ok
+}
+
+// Close disconnects all the clients and stops the broker.
+func (b *Broker) Close() error {
+	err := b.listener.Close()
+	b.mu.Lock()
+	for conn := range b.conns {
+		_ = conn.Close()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+
+	return err
+}
+
+func (b *Broker) serve() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.conns[conn] = struct{}{}
+		b.mu.Unlock()
+
+		b.wg.Add(1)
+		go b.handle(conn)
+	}
+}
+
+func (b *Broker) handle(conn net.Conn) {
+	defer b.wg.Done()
+	defer func() {
+		b.mu.Lock()
+		delete(b.conns, conn)
+		b.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	packet, err := packets.ReadPacket(conn)
+	if err != nil {
+		return
+	}
+	connect, ok := packet.(*packets.ConnectPacket)
+	if !ok {
+		return
+	}
+	connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+	b.mu.Lock()
+	if b.username != "" && (connect.Username != b.username || string(connect.Password) != b.password) {
+		connack.ReturnCode = packets.ErrRefusedNotAuthorised
+	}
+	b.mu.Unlock()
+	if err := connack.Write(conn); err != nil || connack.ReturnCode != packets.Accepted {
+		return
+	}
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			// connection has been lost without DISCONNECT so the will is published
+			if connect.WillFlag {
+				b.record(Message{
+					ClientID: connect.ClientIdentifier,
+					Topic:    connect.WillTopic,
+					Payload:  connect.WillMessage,
+					QoS:      connect.WillQos,
+					Retained: connect.WillRetain,
+				})
+			}
+			return
+		}
+
+		var reply packets.ControlPacket
+		switch p := packet.(type) {
+		case *packets.PublishPacket:
+			b.record(Message{ClientID: connect.ClientIdentifier, Topic: p.TopicName, Payload: p.Payload, QoS: p.Qos, Retained: p.Retain})
+			switch p.Qos {
+			case 1:
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = p.MessageID
+				reply = puback
+			case 2:
+				pubrec := packets.NewControlPacket(packets.Pubrec).(*packets.PubrecPacket)
+				pubrec.MessageID = p.MessageID
+				reply = pubrec
+			}
+		case *packets.PubrelPacket:
+			pubcomp := packets.NewControlPacket(packets.Pubcomp).(*packets.PubcompPacket)
+			pubcomp.MessageID = p.MessageID
+			reply = pubcomp
+		case *packets.SubscribePacket:
+			suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			suback.MessageID = p.MessageID
+			suback.ReturnCodes = p.Qoss
+			reply = suback
+		case *packets.UnsubscribePacket:
+			unsuback := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			unsuback.MessageID = p.MessageID
+			reply = unsuback
+		case *packets.PingreqPacket:
+			reply = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		}
+		if reply != nil {
+			if err := reply.Write(conn); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (b *Broker) record(msg Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.messages = append(b.messages, msg)
+	if msg.Retained {
+		if len(msg.Payload) == 0 {
+			delete(b.retained, msg.Topic)
+		} else {
+			b.retained[msg.Topic] = msg
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package mqtt publishes the readings to an MQTT broker together with the Home Assistant
+// discovery config so the sensors show up automatically.
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"weather-pi/netatmo"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultTopicPrefix is used for the state topics when none is configured
+	DefaultTopicPrefix = "weather-pie"
+	// DefaultDiscoveryPrefix is the default discovery prefix of Home Assistant
+	DefaultDiscoveryPrefix = "homeassistant"
+
+	timeout = 10 * time.Second
+)
+
+var (
+	// connectRetryInterval is the delay between the attempts to connect to an unreachable broker
+	connectRetryInterval = 30 * time.Second
+	// connectWait is how long NewPublisher waits for the first connection before leaving
+	// it to the retries
+	connectWait = timeout
+)
+
+type Options struct {
+	Broker          string
+	ClientID        string
+	Username        string
+	Password        string
+	TopicPrefix     string
+	DiscoveryPrefix string
+}
+
+// Publisher sends the state of every reading and announces the sensors to Home Assistant.
+type Publisher struct {
+	log             *zap.SugaredLogger
+	client          paho.Client
+	topicPrefix     string
+	discoveryPrefix string
+
+	mu sync.Mutex
+	// announced contains the readings whose discovery config has been published
+	announced map[string]bool
+}
+
+// NewPublisher connects to the broker. The connection is kept and re-established when lost,
+// a broker which is not reachable at the start is retried in the background.
+func NewPublisher(logger *zap.SugaredLogger, opts Options) (*Publisher, error) {
+	if opts.Broker == "" {
+		return nil, errors.New("empty MQTT broker address")
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = DefaultTopicPrefix
+	}
+	if opts.TopicPrefix == "" {
+		opts.TopicPrefix = DefaultTopicPrefix
+	}
+	if opts.DiscoveryPrefix == "" {
+		opts.DiscoveryPrefix = DefaultDiscoveryPrefix
+	}
+
+	p := &Publisher{
+		log:             logger,
+		topicPrefix:     strings.TrimSuffix(opts.TopicPrefix, "/"),
+		discoveryPrefix: strings.TrimSuffix(opts.DiscoveryPrefix, "/"),
+		announced:       map[string]bool{},
+	}
+	clientOpts := paho.NewClientOptions().
+		AddBroker(opts.Broker).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetConnectTimeout(timeout).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(connectRetryInterval).
+		SetWill(p.availabilityTopic(), "offline", 1, true).
+		SetOnConnectHandler(p.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logger.With("err", err).Warn("lost connection to the MQTT broker")
+		})
+	p.client = paho.NewClient(clientOpts)
+
+	token := p.client.Connect()
+	if !token.WaitTimeout(connectWait) {
+		logger.With("broker", opts.Broker, "retry_interval", connectRetryInterval).Warn("MQTT broker is not reachable, retrying in the background")
+		return p, nil
+	}
+	if err := token.Error(); err != nil {
+		return nil, errors.Wrapf(err, "could not connect to the MQTT broker %s", opts.Broker)
+	}
+
+	return p, nil
+}
+
+func (p *Publisher) onConnect(client paho.Client) {
+	p.log.Info("connected to the MQTT broker")
+
+	// broker might have lost the retained discovery config so announce the sensors again
+	p.mu.Lock()
+	p.announced = map[string]bool{}
+	p.mu.Unlock()
+
+	// called from the client goroutine so the token cannot be waited for here
+	client.Publish(p.availabilityTopic(), 1, true, "online")
+}
+
+// Publish sends the state of all the readings. Sensors are announced to Home Assistant
+// the first time they are seen. Nothing is sent until the broker is connected so the
+// outdated states do not pile up.
+func (p *Publisher) Publish(measurements []netatmo.Measurement) error {
+	if !p.client.IsConnectionOpen() {
+		return errors.New("not connected to the MQTT broker")
+	}
+	for _, measurement := range measurements {
+		for _, reading := range measurement.Readings() {
+			id := objectID(measurement, reading)
+			p.mu.Lock()
+			announced := p.announced[id]
+			p.mu.Unlock()
+			if !announced {
+				if err := p.announce(id, reading); err != nil {
+					return err
+				}
+				p.mu.Lock()
+				p.announced[id] = true
+				p.mu.Unlock()
+			}
+
+			payload, err := json.Marshal(newState(reading))
+			if err != nil {
+				return errors.Wrapf(err, "could not encode state of %s", reading.Name)
+			}
+			if err := p.publish(p.stateTopic(id), false, payload); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close announces that the sensors are unavailable and disconnects from the broker.
+func (p *Publisher) Close() {
+	if err := p.publish(p.availabilityTopic(), true, []byte("offline")); err != nil {
+		p.log.With("err", err).Warn("could not publish availability")
+	}
+	p.Disconnect()
+}
+
+// Disconnect disconnects from the broker leaving the sensors available, which is what
+// the periodically started program needs between the runs.
+func (p *Publisher) Disconnect() {
+	p.client.Disconnect(uint(timeout / time.Millisecond))
+}
+
+func (p *Publisher) announce(id string, reading netatmo.Reading) error {
+	device := discoveryDevice{
+		Identifiers:  []string{"weatherpie_" + id},
+		Name:         reading.Name,
+		Manufacturer: "Netatmo",
+	}
+	fields, err := newState(reading).fields()
+	if err != nil {
+		return errors.Wrapf(err, "could not list values of %s", reading.Name)
+	}
+
+	for _, sensor := range sensors {
+		if !fields[sensor.key] {
+			continue
+		}
+		config := discoveryConfig{
+			Name:              fmt.Sprintf("%s %s", reading.Name, sensor.name),
+			UniqueID:          fmt.Sprintf("weatherpie_%s_%s", id, sensor.key),
+			StateTopic:        p.stateTopic(id),
+			AvailabilityTopic: p.availabilityTopic(),
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s }}", sensor.key),
+			Unit:              sensor.unit,
+			DeviceClass:       sensor.deviceClass,
+			StateClass:        sensor.stateClass,
+			Device:            device,
+		}
+		payload, err := json.Marshal(config)
+		if err != nil {
+			return errors.Wrapf(err, "could not encode discovery config of %s", config.Name)
+		}
+		topic := fmt.Sprintf("%s/sensor/%s/%s/config", p.discoveryPrefix, DefaultTopicPrefix, config.UniqueID)
+		if err := p.publish(topic, true, payload); err != nil {
+			return err
+		}
+	}
+	p.log.With("name", reading.Name, "id", id).Info("announced sensors to Home Assistant")
+
+	return nil
+}
+
+func (p *Publisher) publish(topic string, retained bool, payload []byte) error {
+	token := p.client.Publish(topic, 1, retained, payload)
+	if !token.WaitTimeout(timeout) {
+		return errors.Errorf("timed out publishing to %s", topic)
+	}
+
+	return errors.Wrapf(token.Error(), "could not publish to %s", topic)
+}
+
+func (p *Publisher) stateTopic(id string) string {
+	return fmt.Sprintf("%s/%s/state", p.topicPrefix, id)
+}
+
+func (p *Publisher) availabilityTopic() string {
+	return p.topicPrefix + "/status"
+}
+
+// objectID identifies the reading by its module ID and falls back to the names
+// for readings which do not have it
+func objectID(measurement netatmo.Measurement, reading netatmo.Reading) string {
+	switch {
+	case reading.Module.ModuleId != "":
+		return slug(reading.Module.ModuleId)
+	case reading.Module.DeviceId != "":
+		return slug(reading.Module.DeviceId)
+	default:
+		return slug(measurement.StationName + "_" + reading.Name)
+	}
+}
+
+// slug makes the value usable as a part of the topic and the object ID
+func slug(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, value)
+}
@@ -0,0 +1,229 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"weather-pi/mqtt/mqtttest"
+	"weather-pi/netatmo"
+
+	"go.uber.org/zap"
+)
+
+func testMeasurements() []netatmo.Measurement {
+	co2, battery := int64(640), int64(72)
+	timestamp := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+
+	return []netatmo.Measurement{{
+		StationName: "Home",
+		StationReading: &netatmo.Reading{
+			Name: "Living room", Type: netatmo.BaseStation, Timestamp: timestamp, Temperature: 21.5, Humidity: 45, CO2: &co2,
+			Pressure: &netatmo.Pressure{Value: 1013.2},
+			Module:   netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01"},
+		},
+		ModuleReadings: []netatmo.Reading{{
+			Name: "Garden", Type: netatmo.RainGauge, Timestamp: timestamp, Rain: &netatmo.Rain{Current: 0.3, SumDay: 4.2},
+			Status: netatmo.Status{Battery: &battery},
+			Module: netatmo.ModuleInfo{DeviceId: "70:ee:50:00:00:01", ModuleId: "05:00:00:00:00:02"},
+		}},
+	}}
+}
+
+func newTestPublisher(t *testing.T, broker *mqtttest.Broker) *Publisher {
+	t.Helper()
+	p, err := NewPublisher(zap.NewNop().Sugar(), Options{Broker: broker.URL()})
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+
+	return p
+}
+
+// waitFor polls until the condition holds as the broker records the messages asynchronously
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !condition(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitOnline waits for the availability published when the publisher connects
+func waitOnline(t *testing.T, broker *mqtttest.Broker) {
+	t.Helper()
+	waitFor(t, "the availability", func() bool {
+		msg, ok := broker.Retained("weather-pie/status")
+		return ok && string(msg.Payload) == "online"
+	})
+}
+
+func TestPublish(t *testing.T) {
+	broker, err := mqtttest.NewBroker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+	p := newTestPublisher(t, broker)
+	defer p.Disconnect()
+
+	waitOnline(t, broker)
+	if err := p.Publish(testMeasurements()); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	states := map[string]map[string]interface{}{}
+	configs := map[string]discoveryConfig{}
+	for _, msg := range broker.Messages() {
+		switch {
+		case strings.HasSuffix(msg.Topic, "/state"):
+			if msg.Retained {
+				t.Errorf("state %s is retained", msg.Topic)
+			}
+			var state map[string]interface{}
+			if err := json.Unmarshal(msg.Payload, &state); err != nil {
+				t.Fatalf("invalid state %s: %v", msg.Payload, err)
+			}
+			states[msg.Topic] = state
+		case strings.HasPrefix(msg.Topic, "homeassistant/"):
+			if !msg.Retained {
+				t.Errorf("discovery config %s is not retained", msg.Topic)
+			}
+			var config discoveryConfig
+			if err := json.Unmarshal(msg.Payload, &config); err != nil {
+				t.Fatalf("invalid discovery config %s: %v", msg.Payload, err)
+			}
+			configs[msg.Topic] = config
+		}
+	}
+
+	station, garden := states["weather-pie/70_ee_50_00_00_01/state"], states["weather-pie/05_00_00_00_00_02/state"]
+	if station["temperature"] != 21.5 || station["co2"] != 640.0 || station["pressure"] != 1013.2 || station["timestamp"] != "2024-03-05T14:30:00Z" {
+		t.Errorf("station state = %v", station)
+	}
+	if _, ok := station["rain"]; ok {
+		t.Errorf("station state has rain: %v", station)
+	}
+	if garden["rain_day"] != 4.2 || garden["battery"] != 72.0 {
+		t.Errorf("rain gauge state = %v", garden)
+	}
+	if _, ok := garden["temperature"]; ok {
+		t.Errorf("rain gauge state has a temperature: %v", garden)
+	}
+
+	config, ok := configs["homeassistant/sensor/weather-pie/weatherpie_70_ee_50_00_00_01_temperature/config"]
+	if !ok {
+		t.Fatalf("no temperature discovery config in %v", configs)
+	}
+	want := discoveryConfig{
+		Name:              "Living room Temperature",
+		UniqueID:          "weatherpie_70_ee_50_00_00_01_temperature",
+		StateTopic:        "weather-pie/70_ee_50_00_00_01/state",
+		AvailabilityTopic: "weather-pie/status",
+		ValueTemplate:     "{{ value_json.temperature }}",
+		Unit:              "°C",
+		DeviceClass:       "temperature",
+		StateClass:        "measurement",
+		Device:            discoveryDevice{Identifiers: []string{"weatherpie_70_ee_50_00_00_01"}, Name: "Living room", Manufacturer: "Netatmo"},
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("discovery config = %+v, want %+v", config, want)
+	}
+	if _, ok := configs["homeassistant/sensor/weather-pie/weatherpie_05_00_00_00_00_02_temperature/config"]; ok {
+		t.Error("the temperature of the rain gauge is announced")
+	}
+	if _, ok := configs["homeassistant/sensor/weather-pie/weatherpie_05_00_00_00_00_02_rain_day/config"]; !ok {
+		t.Error("the rain of the rain gauge is not announced")
+	}
+
+	// the sensors are announced only once
+	count := len(broker.Messages())
+	if err := p.Publish(testMeasurements()); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if published := len(broker.Messages()) - count; published != 2 {
+		t.Errorf("%d messages published on the second refresh, want the 2 states", published)
+	}
+}
+
+func TestPublisherWill(t *testing.T) {
+	broker, err := mqtttest.NewBroker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPublisher(t, broker)
+	defer p.Disconnect()
+	waitOnline(t, broker)
+
+	// the broker publishes the will when the connection is lost without a DISCONNECT
+	_ = broker.Close()
+	var will []mqtttest.Message
+	for _, msg := range broker.Messages() {
+		if msg.Topic == "weather-pie/status" && string(msg.Payload) == "offline" {
+			will = append(will, msg)
+		}
+	}
+	if len(will) != 1 || !will[0].Retained || will[0].QoS != 1 {
+		t.Errorf("will messages = %+v, want a retained offline message", will)
+	}
+}
+
+func TestPublisherClose(t *testing.T) {
+	broker, err := mqtttest.NewBroker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+	p := newTestPublisher(t, broker)
+	waitOnline(t, broker)
+
+	p.Close()
+	msg, ok := broker.Retained("weather-pie/status")
+	if !ok || string(msg.Payload) != "offline" {
+		t.Errorf("availability = %q, want offline", msg.Payload)
+	}
+}
+
+func TestPublisherConnectRetry(t *testing.T) {
+	defer func(interval, wait time.Duration) {
+		connectRetryInterval, connectWait = interval, wait
+	}(connectRetryInterval, connectWait)
+	connectRetryInterval, connectWait = 50*time.Millisecond, 100*time.Millisecond
+
+	// reserve an address nothing listens on yet
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	p, err := NewPublisher(zap.NewNop().Sugar(), Options{Broker: "tcp://" + address})
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	defer p.Disconnect()
+	if err := p.Publish(testMeasurements()); err == nil {
+		t.Error("Publish() succeeded without a broker")
+	}
+
+	broker, err := mqtttest.ListenBroker(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+	waitFor(t, "the connection", p.client.IsConnectionOpen)
+	if err := p.Publish(testMeasurements()); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	for _, msg := range broker.Messages() {
+		if strings.HasSuffix(msg.Topic, "/state") && strings.Contains(string(msg.Payload), `"temperature":21.5`) {
+			return
+		}
+	}
+	t.Error("the states were not published after the broker came up")
+}
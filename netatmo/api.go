@@ -0,0 +1,258 @@
+package netatmo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+	"weather-pi/tokenstore"
+
+	"github.com/hekmon/go-netatmo"
+	"github.com/hekmon/go-netatmo/weather"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// apiHost is the host of the Netatmo API used by the client library
+const apiHost = "api.netatmo.com"
+
+// readStationScope allows reading the weather station data
+const readStationScope = "read_station"
+
+// APISource fetches the stations data from the Netatmo API. It keeps track of the
+// rotated OAuth tokens so it can be reused between refreshes.
+type APISource struct {
+	log        *zap.SugaredLogger
+	baseConfig netatmo.OAuth2BaseConfig
+	token      *oauth2.Token
+	store      tokenstore.Store
+	httpClient *http.Client
+}
+
+// NewAPISource creates a data source using the Netatmo API. Rotated tokens are saved in the store.
+// When baseURL is not empty all the requests (including the OAuth ones) are sent there instead
+// of the Netatmo API. Failed requests are retried according to the retry policy.
+func NewAPISource(logger *zap.SugaredLogger, apiClientId, apiSecret string, token *oauth2.Token, store tokenstore.Store, baseURL string, retry RetryPolicy) (*APISource, error) {
+	if len(apiClientId) == 0 {
+		return nil, errors.New("empty API client ID")
+	}
+	if len(apiSecret) == 0 {
+		return nil, errors.New("empty API secret")
+	}
+	if len(token.AccessToken) == 0 {
+		return nil, errors.New("empty token")
+	}
+	if len(token.RefreshToken) == 0 {
+		return nil, errors.New("empty refreshToken")
+	}
+
+	httpClient, err := newHTTPClient(logger, baseURL, retry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &APISource{
+		log: logger,
+		baseConfig: netatmo.OAuth2BaseConfig{
+			ClientID:     apiClientId,
+			ClientSecret: apiSecret,
+			Scopes:       []string{readStationScope},
+		},
+		token:      token,
+		store:      store,
+		httpClient: httpClient,
+	}, nil
+}
+
+func (s *APISource) GetStationData(ctx context.Context) (weather.StationDataBody, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, s.httpClient)
+
+	s.log.With("clientId", s.baseConfig.ClientID).Info("connecting to the Netatmo API")
+	oauthConfig := netatmo.GenerateOAuth2Config(s.baseConfig)
+	curToken, err := s.currentToken(ctx, oauthConfig)
+	if err != nil {
+		return weather.StationDataBody{}, err
+	}
+	authedClient, err := netatmo.NewClientWithTokens(ctx, oauthConfig, curToken, s.httpClient)
+	if err != nil {
+		return weather.StationDataBody{}, errors.Wrap(err, "could not connect to the Netatmo API")
+	}
+
+	s.log.Info("fetching stations data")
+	client := weather.New(authedClient)
+	devices, _, _, err := client.GetStationData(ctx, weather.GetStationDataParameters{})
+	if err != nil {
+		return weather.StationDataBody{}, errors.Wrap(err, "could not fetch data from the Netatmo API")
+	}
+
+	return devices, nil
+}
+
+// GetMeasure fetches the temperature history using the getmeasure endpoint.
+func (s *APISource) GetMeasure(ctx context.Context, module ModuleInfo, since, until time.Time) ([]Sample, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, s.httpClient)
+
+	oauthConfig := netatmo.GenerateOAuth2Config(s.baseConfig)
+	curToken, err := s.currentToken(ctx, oauthConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("device_id", module.DeviceId)
+	if module.ModuleId != "" {
+		params.Set("module_id", module.ModuleId)
+	}
+	params.Set("scale", measureScale(until.Sub(since)))
+	params.Set("type", "temperature")
+	params.Set("date_begin", strconv.FormatInt(since.Unix(), 10))
+	params.Set("date_end", strconv.FormatInt(until.Unix(), 10))
+	params.Set("optimize", "false")
+	params.Set("real_time", "false")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+apiHost+"/api/getmeasure?"+params.Encode(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create getmeasure request")
+	}
+	curToken.SetAuthHeader(req)
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not fetch measures from the Netatmo API")
+	}
+	defer resp.Body.Close()
+
+	var measures measureResponse
+	if err := json.NewDecoder(resp.Body).Decode(&measures); err != nil {
+		return nil, errors.Wrapf(err, "could not decode getmeasure response (HTTP %d)", resp.StatusCode)
+	}
+	if measures.Error != nil {
+		return nil, errors.Errorf("getmeasure failed with code %d: %s", measures.Error.Code, measures.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("getmeasure failed with HTTP %d", resp.StatusCode)
+	}
+
+	return measures.samples()
+}
+
+// currentToken returns a valid token. An expired one is refreshed while the store is locked,
+// starting from the stored token when the login command or another run has rotated it since.
+func (s *APISource) currentToken(ctx context.Context, oauthConfig *oauth2.Config) (*oauth2.Token, error) {
+	if s.token.Valid() {
+		return s.token, nil
+	}
+
+	curToken, err := s.store.Update(func(stored *oauth2.Token) (*oauth2.Token, error) {
+		token := s.token
+		if stored != nil && stored.Expiry.After(token.Expiry) {
+			s.log.With("expiry", stored.Expiry).Info("using the OAuth token rotated by another process")
+			token = stored
+		}
+		refreshed, err := oauthConfig.TokenSource(ctx, token).Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not refresh the token")
+		}
+		if refreshed.AccessToken != token.AccessToken {
+			s.log.With("new_expiry", refreshed.Expiry).Info("OAuth token has been refreshed")
+			tokenRefreshes.Inc()
+		}
+
+		return refreshed, nil
+	})
+	if curToken == nil {
+		return nil, err
+	}
+	if err != nil {
+		// the token is still used until the next refresh
+		s.log.With("error", err).Error("could not save generated OAuth tokens")
+	}
+	s.token = curToken
+
+	return curToken, nil
+}
+
+// measureScale picks the getmeasure resolution so the window fits in a reasonable number of samples.
+func measureScale(window time.Duration) string {
+	switch {
+	case window <= 24*time.Hour:
+		return "30min"
+	case window <= 7*24*time.Hour:
+		return "1hour"
+	case window <= 30*24*time.Hour:
+		return "3hours"
+	default:
+		return "1day"
+	}
+}
+
+// measureResponse is the getmeasure response with optimize=false (values keyed by a unix timestamp).
+type measureResponse struct {
+	Body   map[string][]*float64 `json:"body"`
+	Status string                `json:"status"`
+	Error  *apiError             `json:"error"`
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (r measureResponse) samples() ([]Sample, error) {
+	samples := make([]Sample, 0, len(r.Body))
+	for ts, values := range r.Body {
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid measure timestamp %q", ts)
+		}
+		if len(values) == 0 || values[0] == nil {
+			continue
+		}
+		samples = append(samples, Sample{Time: time.Unix(unix, 0).UTC(), Value: *values[0]})
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+
+	return samples, nil
+}
+
+// newHTTPClient returns a client retrying failed requests and sending the requests for the
+// Netatmo API to baseURL if it is not empty.
+func newHTTPClient(logger *zap.SugaredLogger, baseURL string, retry RetryPolicy) (*http.Client, error) {
+	transport := newRetryTransport(logger, retry, http.DefaultTransport)
+	httpClient := &http.Client{Transport: transport}
+	if baseURL != "" {
+		base, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse API base URL")
+		}
+		httpClient.Transport = &baseURLTransport{base: base, next: transport}
+	}
+
+	return httpClient, nil
+}
+
+// baseURLTransport redirects requests sent to the Netatmo API to a different server.
+type baseURLTransport struct {
+	base *url.URL
+	next http.RoundTripper
+}
+
+func (t *baseURLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != apiHost {
+		return t.next.RoundTrip(req)
+	}
+
+	redirected := req.Clone(req.Context())
+	redirected.URL.Scheme = t.base.Scheme
+	redirected.URL.Host = t.base.Host
+	redirected.URL.Path = path.Join("/", t.base.Path, req.URL.Path)
+	redirected.Host = t.base.Host
+
+	return t.next.RoundTrip(redirected)
+}
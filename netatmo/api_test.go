@@ -0,0 +1,93 @@
+package netatmo
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"weather-pi/netatmo/netatmotest"
+	"weather-pi/tokenstore"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// newSharedSources creates sources with the same expired token and their own stores of
+// the same file, like runs of the command overlapping with each other
+func newSharedSources(t *testing.T, server *netatmotest.Server, count int) []*APISource {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "token.json")
+	sources := make([]*APISource, count)
+	for i := range sources {
+		token := &oauth2.Token{
+			AccessToken:  netatmotest.InitialAccessToken,
+			RefreshToken: netatmotest.InitialRefreshToken,
+			TokenType:    "Bearer",
+			Expiry:       time.Now().Add(-time.Hour),
+		}
+		source, err := NewAPISource(zap.NewNop().Sugar(), netatmotest.ClientID, netatmotest.ClientSecret, token, tokenstore.NewFileStore(path), server.URL, testRetryPolicy)
+		if err != nil {
+			t.Fatalf("NewAPISource() error = %v", err)
+		}
+		sources[i] = source
+	}
+
+	return sources
+}
+
+func TestTokenRefreshConcurrent(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+	sources := newSharedSources(t, server, 4)
+
+	// only one of them refreshes the token, the others pick up the rotated one
+	// instead of refreshing with the refresh token it has invalidated
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source *APISource) {
+			defer wg.Done()
+			if _, err := getMeasure(context.Background(), source); err != nil {
+				t.Errorf("GetMeasure() error = %v", err)
+			}
+		}(source)
+	}
+	wg.Wait()
+
+	if requests := server.Requests("/oauth2/token"); requests != 1 {
+		t.Errorf("%d token requests, want 1", requests)
+	}
+}
+
+func TestTokenRotatedElsewhere(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+	sources := newSharedSources(t, server, 2)
+	store := sources[0].store
+
+	if _, err := getMeasure(context.Background(), sources[0]); err != nil {
+		t.Fatalf("GetMeasure() error = %v", err)
+	}
+	// the stored token has expired as well, it is refreshed with the stored refresh token
+	// as the one the other source started with has been invalidated
+	stored, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	stored.Expiry = time.Now().Add(-time.Minute)
+	if err := store.Save(stored); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if _, err := getMeasure(context.Background(), sources[1]); err != nil {
+		t.Fatalf("GetMeasure() error = %v", err)
+	}
+	if requests := server.Requests("/oauth2/token"); requests != 2 {
+		t.Errorf("%d token requests, want 2", requests)
+	}
+	accessToken, refreshToken := server.Tokens()
+	if saved, err := store.Load(); err != nil || saved.AccessToken != accessToken || saved.RefreshToken != refreshToken {
+		t.Errorf("saved token = %+v, %v, want %s/%s", saved, err, accessToken, refreshToken)
+	}
+}
@@ -0,0 +1,78 @@
+package netatmo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultCachePath is where the last fetched measurements are kept when no other file is configured
+const DefaultCachePath = "/var/lib/weather-pie/measurements.json"
+
+// ErrNoCache is returned by Load when no measurements have been cached yet
+var ErrNoCache = errors.New("no cached measurements")
+
+// Cache keeps the last successfully fetched measurements so they can be shown
+// when the API is not reachable.
+type Cache struct {
+	path string
+}
+
+func NewCache(path string) *Cache {
+	return &Cache{path: path}
+}
+
+type cachedMeasurements struct {
+	FetchedAt    time.Time     `json:"fetched_at"`
+	Measurements []Measurement `json:"measurements"`
+}
+
+// Load returns the cached measurements and the time they were fetched at.
+func (c *Cache) Load() ([]Measurement, time.Time, error) {
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, ErrNoCache
+	}
+	if err != nil {
+		return nil, time.Time{}, errors.Wrap(err, "could not read cache file")
+	}
+	var cached cachedMeasurements
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, time.Time{}, errors.Wrapf(err, "could not decode cache file %s", c.path)
+	}
+
+	return cached.Measurements, cached.FetchedAt, nil
+}
+
+// Save replaces the cached measurements. The file is replaced atomically so an interrupted
+// write does not destroy the previous measurements.
+func (c *Cache) Save(measurements []Measurement) error {
+	data, err := json.Marshal(cachedMeasurements{FetchedAt: time.Now().UTC(), Measurements: measurements})
+	if err != nil {
+		return errors.Wrap(err, "could not encode measurements")
+	}
+
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "could not create cache directory")
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "could not create temporary cache file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "could not write cache file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "could not close cache file")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), c.path), "could not replace cache file")
+}
@@ -0,0 +1,181 @@
+package netatmo
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func testMeasurements() []Measurement {
+	at := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	co2, noise, wifi, battery := int64(612), int64(38), int64(45), int64(74)
+
+	return []Measurement{{
+		StationName: "Home",
+		StationReading: &Reading{
+			Name: "Living room", Type: BaseStation, Module: ModuleInfo{DeviceId: "70:ee:50:00:00:01"}, Timestamp: at,
+			Temperature: 21.4, MinTemp: 19.8, MaxTemp: 22.1, Humidity: 48, TempTrend: "up", CO2: &co2, Noise: &noise,
+			Pressure: &Pressure{Value: 1016.2, Absolute: 1003.1, Trend: "stable"},
+			Status:   Status{Reachable: true, WifiStatus: &wifi},
+		},
+		ModuleReadings: []Reading{
+			{
+				Name: "Outdoor", Type: OutdoorModule, Module: ModuleInfo{DeviceId: "70:ee:50:00:00:01", ModuleId: "02:00:00:00:00:01"},
+				Timestamp: at, Temperature: -3.5, Humidity: 80, Status: Status{Reachable: true, Battery: &battery},
+				MaxAge: time.Hour, History: []Sample{{Time: at.Add(-time.Hour), Value: -2}, {Time: at, Value: -3.5}},
+			},
+			{
+				Name: "Rain gauge", Type: RainGauge, Module: ModuleInfo{DeviceId: "70:ee:50:00:00:01", ModuleId: "05:00:00:00:00:01"},
+				Timestamp: at, Rain: &Rain{Current: 0.1, SumHour: 0.4, SumDay: 2.7},
+			},
+		},
+	}}
+}
+
+func TestCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "measurements.json")
+	cache := NewCache(path)
+	if _, _, err := cache.Load(); !errors.Is(err, ErrNoCache) {
+		t.Fatalf("Load() error = %v, want ErrNoCache", err)
+	}
+
+	before := time.Now()
+	if err := cache.Save(testMeasurements()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	measurements, fetchedAt, err := cache.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(measurements, testMeasurements()) {
+		t.Errorf("Load() = %+v, want %+v", measurements, testMeasurements())
+	}
+	if fetchedAt.Before(before.Add(-time.Second)) || fetchedAt.After(time.Now()) {
+		t.Errorf("fetched at %s, want the time of Save", fetchedAt)
+	}
+}
+
+func TestCacheFailedSave(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache(filepath.Join(dir, "measurements.json"))
+	if err := cache.Save(testMeasurements()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// the previous measurements are kept when the new ones cannot be written
+	invalid := testMeasurements()
+	invalid[0].StationReading.Temperature = math.NaN()
+	if err := cache.Save(invalid); err == nil {
+		t.Fatal("Save() succeeded with a temperature which cannot be encoded")
+	}
+	measurements, _, err := cache.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(measurements, testMeasurements()) {
+		t.Errorf("Load() = %+v, want the previous measurements", measurements)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("%d files in the cache directory, want only the cache", len(files))
+	}
+}
+
+func TestCacheAtomicReplace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "measurements.json")
+	cache := NewCache(path)
+	if err := cache.Save(testMeasurements()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// a concurrent run never loads a partially written cache
+	done := make(chan struct{})
+	loaded := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-done:
+				loaded <- nil
+				return
+			default:
+			}
+			if _, _, err := NewCache(path).Load(); err != nil {
+				loaded <- err
+				return
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := cache.Save(testMeasurements()); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	close(done)
+	if err := <-loaded; err != nil {
+		t.Errorf("Load() during Save() error = %v", err)
+	}
+
+	// the temporary file is removed when it cannot replace the cache
+	blocked := filepath.Join(dir, "blocked")
+	if err := os.MkdirAll(filepath.Join(blocked, "measurements"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewCache(blocked).Save(testMeasurements()); err == nil || !strings.Contains(err.Error(), "could not replace cache file") {
+		t.Errorf("Save() error = %v, want the failed replace", err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".tmp") {
+			t.Errorf("temporary file %s has been left behind", file.Name())
+		}
+	}
+}
+
+func TestCacheInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{name: "corrupt", data: `{"fetched_at": "2024-03-05T12:00:00Z", "measurements": [`, err: "could not decode cache file"},
+		{name: "truncated", data: ``, err: "could not decode cache file"},
+		{name: "wrong type", data: `{"measurements": {}}`, err: "could not decode cache file"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := ioutil.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, err := NewCache(path).Load()
+			if err == nil || errors.Is(err, ErrNoCache) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Load() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	// a directory in place of the file cannot be read
+	path := filepath.Join(dir, "directory")
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewCache(path).Load(); err == nil || errors.Is(err, ErrNoCache) {
+		t.Errorf("Load() error = %v, want a read error", err)
+	}
+}
@@ -0,0 +1,84 @@
+package netatmo
+
+import (
+	"context"
+	"time"
+	"weather-pi/internal"
+
+	"github.com/pkg/errors"
+)
+
+// StationInfo describes a base station found on the account.
+type StationInfo struct {
+	Home       string       `json:"home" yaml:"home"`
+	Name       string       `json:"name" yaml:"name"`
+	Id         string       `json:"id" yaml:"id"`
+	Type       ModuleType   `json:"type" yaml:"type"`
+	Reachable  bool         `json:"reachable" yaml:"reachable"`
+	WifiStatus int64        `json:"wifi_status" yaml:"wifi_status"`
+	LastSeen   time.Time    `json:"last_seen" yaml:"last_seen"`
+	Modules    []ModuleDesc `json:"modules" yaml:"modules"`
+}
+
+// ModuleDesc describes a module connected to a base station.
+type ModuleDesc struct {
+	Name      string     `json:"name" yaml:"name"`
+	Id        string     `json:"id" yaml:"id"`
+	Type      ModuleType `json:"type" yaml:"type"`
+	Reachable bool       `json:"reachable" yaml:"reachable"`
+	Battery   int64      `json:"battery" yaml:"battery"`
+	RFStatus  int64      `json:"rf_status" yaml:"rf_status"`
+	LastSeen  time.Time  `json:"last_seen" yaml:"last_seen"`
+}
+
+// Discover lists all the stations and modules the account has access to.
+func Discover(ctx context.Context, dataSource DataSource) ([]StationInfo, error) {
+	devices, err := dataSource.GetStationData(ctx)
+	if err != nil {
+		fetchErrors.WithLabelValues("getstationsdata").Inc()
+		return nil, errors.Wrap(err, "could not fetch stations data")
+	}
+
+	stations := make([]StationInfo, 0, len(devices.Devices))
+	for _, device := range devices.Devices {
+		station := StationInfo{
+			Home:       device.HomeName,
+			Name:       device.ModuleName,
+			Id:         device.ID,
+			Type:       ModuleType(device.Type),
+			Reachable:  device.Reachable,
+			WifiStatus: int64(device.WifiStatus),
+			LastSeen:   device.LastStatusStore,
+			Modules:    make([]ModuleDesc, 0, len(device.Modules)),
+		}
+		for _, module := range device.Modules {
+			station.Modules = append(station.Modules, ModuleDesc{
+				Name:      module.ModuleName,
+				Id:        module.ID,
+				Type:      ModuleType(module.Type),
+				Reachable: module.Reachable,
+				Battery:   int64(module.BatteryPercent),
+				RFStatus:  int64(module.RFStatus),
+				LastSeen:  module.LastMessage,
+			})
+		}
+		stations = append(stations, station)
+	}
+
+	return stations, nil
+}
+
+// Source returns the config selecting the station and all its modules by their IDs.
+// Names are kept so the config tells which module is which.
+func (s StationInfo) Source() internal.Source {
+	source := internal.Source{
+		StationName: s.Home,
+		DeviceId:    s.Id,
+		Modules:     []internal.Module{{Id: s.Id, Name: s.Name}},
+	}
+	for _, module := range s.Modules {
+		source.Modules = append(source.Modules, internal.Module{Id: module.Id, Name: module.Name})
+	}
+
+	return source
+}
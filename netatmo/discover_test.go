@@ -0,0 +1,87 @@
+package netatmo
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+	"weather-pi/internal"
+	"weather-pi/netatmo/netatmotest"
+)
+
+func TestDiscover(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+	source, _ := newTestSource(t, server, testRetryPolicy, time.Hour)
+
+	stations, err := Discover(context.Background(), source)
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if len(stations) != 1 {
+		t.Fatalf("Discover() = %+v, want a single station", stations)
+	}
+	station := stations[0]
+	if station.Home != "Home" || station.Name != "Living room" || station.Id != "70:ee:50:00:00:01" || station.Type != BaseStation {
+		t.Errorf("station = %+v", station)
+	}
+	if !station.Reachable || station.WifiStatus != 45 || !station.LastSeen.Equal(time.Unix(1634482790, 0)) {
+		t.Errorf("station status = %+v", station)
+	}
+
+	want := []ModuleDesc{
+		{Name: "Outdoor", Id: "02:00:00:00:00:01", Type: OutdoorModule, Reachable: true, Battery: 74, RFStatus: 62},
+		{Name: "Bedroom", Id: "03:00:00:00:00:01", Type: IndoorModule, Reachable: true, Battery: 58, RFStatus: 70},
+		{Name: "Rain gauge", Id: "05:00:00:00:00:01", Type: RainGauge, Reachable: true, Battery: 91, RFStatus: 68},
+		{Name: "Wind gauge", Id: "06:00:00:00:00:01", Type: WindGauge, Reachable: true, Battery: 83, RFStatus: 72},
+	}
+	if len(station.Modules) != len(want) {
+		t.Fatalf("modules = %+v, want %+v", station.Modules, want)
+	}
+	for i, module := range station.Modules {
+		if !module.LastSeen.Equal(time.Unix(1634482780, 0)) {
+			t.Errorf("module %s last seen at %s", module.Name, module.LastSeen)
+		}
+		module.LastSeen = time.Time{}
+		if module != want[i] {
+			t.Errorf("module %d = %+v, want %+v", i, module, want[i])
+		}
+	}
+}
+
+func TestDiscoverError(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+	server.InjectFailures("/api/getstationsdata", netatmotest.Failure{Status: http.StatusForbidden, Code: 13, Message: "Operation forbidden"})
+	source, _ := newTestSource(t, server, testRetryPolicy, time.Hour)
+
+	if stations, err := Discover(context.Background(), source); err == nil {
+		t.Errorf("Discover() = %+v, want an error", stations)
+	}
+}
+
+func TestStationInfoSource(t *testing.T) {
+	station := StationInfo{
+		Home: "Home",
+		Name: "Living room",
+		Id:   "70:ee:50:00:00:01",
+		Modules: []ModuleDesc{
+			{Name: "Outdoor", Id: "02:00:00:00:00:01"},
+			{Name: "Bedroom", Id: "03:00:00:00:00:01"},
+		},
+	}
+
+	want := internal.Source{
+		StationName: "Home",
+		DeviceId:    "70:ee:50:00:00:01",
+		Modules: []internal.Module{
+			{Id: "70:ee:50:00:00:01", Name: "Living room"},
+			{Id: "02:00:00:00:00:01", Name: "Outdoor"},
+			{Id: "03:00:00:00:00:01", Name: "Bedroom"},
+		},
+	}
+	if source := station.Source(); !reflect.DeepEqual(source, want) {
+		t.Errorf("Source() = %+v, want %+v", source, want)
+	}
+}
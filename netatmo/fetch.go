@@ -2,147 +2,179 @@ package netatmo
 
 import (
 	"context"
-	"strings"
 	"time"
 	"weather-pi/internal"
 
-	"github.com/spf13/viper"
-
-	"golang.org/x/oauth2"
-
 	"github.com/hekmon/go-netatmo/weather"
-
-	"github.com/hekmon/go-netatmo"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
+// Reading holds the latest data of the station or the module. Temperature and humidity are
+// set for module types which measure them, the other optional data is nil when the module
+// type does not provide it.
 type Reading struct {
 	Name        string
+	Type        ModuleType
+	Module      ModuleInfo
 	Timestamp   time.Time
 	Temperature float64
 	MinTemp     float64
 	MaxTemp     float64
 	Humidity    int64
+	TempTrend   Trend
+	// CO2 in ppm is measured by the base station and the indoor modules
+	CO2 *int64
+	// Noise in dB is measured by the base station
+	Noise    *int64
+	Pressure *Pressure
+	Rain     *Rain
+	Wind     *Wind
+	Status   Status
+	// MaxAge overrides the default age after which the reading is considered stale when not zero
+	MaxAge time.Duration
+	// History holds temperatures from the configured time window
+	History []Sample
+}
+
+// configure applies the alias and the max age of the configured module.
+func (r *Reading) configure(module internal.Module) {
+	if module.Alias != "" {
+		r.Name = module.Alias
+	}
+	r.MaxAge = module.MaxAge
+}
+
+// Sample is a single historical measurement.
+type Sample struct {
+	Time  time.Time
+	Value float64
 }
 type Measurement struct {
+	// StationName is the name of the home the station belongs to
+	StationName    string
 	ModuleReadings []Reading
 	StationReading *Reading
 }
 
+// Readings returns the station reading (if present) followed by all the module readings.
+func (m Measurement) Readings() []Reading {
+	readings := make([]Reading, 0, len(m.ModuleReadings)+1)
+	if m.StationReading != nil {
+		readings = append(readings, *m.StationReading)
+	}
+
+	return append(readings, m.ModuleReadings...)
+}
+
 type ModuleInfo struct {
 	DeviceId string
 	ModuleId string
 }
 
-func FetchData(logger *zap.SugaredLogger, sources []internal.Source, apiClientId, apiSecret, token, refreshToken string, tokenExpiry, since time.Time) ([]Measurement, error) {
-	if len(apiClientId) == 0 {
-		return nil, errors.New("empty API client ID")
-	}
-	if len(apiSecret) == 0 {
-		return nil, errors.New("empty API secret")
-	}
-	if len(token) == 0 {
-		return nil, errors.New("empty token")
-	}
-	if len(refreshToken) == 0 {
-		return nil, errors.New("empty refreshToken")
-	}
+func FetchData(ctx context.Context, logger *zap.SugaredLogger, dataSource DataSource, sources []internal.Source, since time.Time) ([]Measurement, error) {
 	if len(sources) == 0 {
 		return nil, errors.New("no measurements to fetch")
 	}
 
-	logger.With("clientId", apiClientId).Info("connecting to the Netatmo API")
-	oauthBaseConfig := netatmo.OAuth2BaseConfig{
-		ClientID:     apiClientId,
-		ClientSecret: apiSecret,
-		Scopes:       []string{"read_station"},
-	}
-	oauthConfig := netatmo.GenerateOAuth2Config(oauthBaseConfig)
-	prevToken := &oauth2.Token{AccessToken: token, RefreshToken: refreshToken, Expiry: tokenExpiry}
-	tokenSource := oauthConfig.TokenSource(context.TODO(), prevToken)
-	curToken, err := tokenSource.Token()
-	if err != nil {
-		return nil, errors.Wrap(err, "could not refresh the token")
-	}
-	if curToken.AccessToken != prevToken.AccessToken {
-		viper.Set("token", curToken.AccessToken)
-		viper.Set("refreshToken", curToken.RefreshToken)
-		logger.With("old_token", token, "new_token", curToken.AccessToken, "old_refresh", refreshToken, "new_refresh", curToken.RefreshToken, "new_expiry", curToken.Expiry)
-
-		viper.Set("tokenExpiry", curToken.Expiry.Format(time.RFC3339))
-		if err = viper.WriteConfig(); err != nil {
-			logger.With("error", err).Error("could not save generated OAuth tokens")
-		}
-	}
-	authedClient, err := netatmo.NewClientWithTokens(context.TODO(), oauthConfig, curToken, nil)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not connect to the Netatmo API")
-	}
-
-	logger.Info("fetching stations data")
-	client := weather.New(authedClient)
-	devices, _, _, err := client.GetStationData(context.TODO(), weather.GetStationDataParameters{})
+	devices, err := dataSource.GetStationData(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not fetch data from the Netatmo API")
+		fetchErrors.WithLabelValues("getstationsdata").Inc()
+		return nil, err
 	}
 	logger.With("num_devices", len(devices.Devices)).Debug("got response with stations data")
 
 	foundMeasurements := 0
 	now := time.Now().UTC()
 	var measurements []Measurement
-	for _, device := range devices.Devices {
-		for _, source := range sources {
-			log := logger.With("home_name", device.HomeName)
-			log.Debug("found station name")
-			if device.HomeName == source.StationName {
-				log = log.With("station_name", device.ModuleName, "device_id", device.ID)
-				log.Info("found station with a proper name")
-				data := Measurement{ModuleReadings: []Reading{}}
-				data.StationReading = &Reading{
-					Name:        device.ModuleName,
-					Temperature: device.DashboardData.Temperature,
-					MinTemp:     device.DashboardData.TempMin,
-					MaxTemp:     device.DashboardData.TempMax,
-					Humidity:    int64(device.DashboardData.Humidity),
-					Timestamp:   device.DashboardData.Time,
-				}
+	for _, source := range sources {
+		if source.DeviceId == "" && source.StationName == "" {
+			return nil, errors.New("source needs a DeviceId or a StationName")
+		}
+		log := logger.With("station_name", source.StationName, "device_id", source.DeviceId)
+		matchedStation := false
+		for _, device := range devices.Devices {
+			log.With("home_name", device.HomeName, "id", device.ID).Debug("found station")
+			if !matchStation(source, device) {
+				continue
+			}
+			matchedStation = true
+			log := log.With("home_name", device.HomeName, "station_name", device.ModuleName, "device_id", device.ID)
+			log.Info("found configured station")
+			data := Measurement{StationName: device.HomeName, ModuleReadings: []Reading{}}
+			stationReading := newStationReading(device)
+			stationReading.configure(stationModule(source, device))
+			data.StationReading = &stationReading
 
-				for _, module := range device.Modules {
-					log.With("module_name", module.ModuleName, "configured_names", source.ModuleNames).Debug("found module name")
-					for _, moduleName := range source.ModuleNames {
-						if strings.TrimSpace(moduleName) == strings.TrimSpace(module.ModuleName) {
-							log.With("since", since.Unix(), "until", now.Unix()).Info("found module with a proper name - fetching data")
-							log.With("module", module).Info("found module")
-							if module.DashboardDataIndoor != nil {
-								data.ModuleReadings = append(data.ModuleReadings, Reading{
-									Name:        module.ModuleName,
-									Temperature: module.DashboardDataIndoor.Temperature,
-									MinTemp:     module.DashboardDataIndoor.MinTemp,
-									MaxTemp:     module.DashboardDataIndoor.MaxTemp,
-									Humidity:    module.DashboardDataIndoor.Humidity,
-									Timestamp:   module.DashboardDataIndoor.Time,
-								})
-								foundMeasurements++
-							} else if module.DashboardDataOutdoor != nil {
-								data.ModuleReadings = append(data.ModuleReadings, Reading{
-									Name:        module.ModuleName,
-									Temperature: module.DashboardDataOutdoor.Temperature,
-									MinTemp:     module.DashboardDataOutdoor.MinTemp,
-									MaxTemp:     module.DashboardDataOutdoor.MaxTemp,
-									Humidity:    module.DashboardDataOutdoor.Humidity,
-									Timestamp:   module.DashboardDataOutdoor.Time,
-								})
-								foundMeasurements++
-							}
-						}
+			// a module can be selected both by its ID and by its name, the first config wins
+			selected := map[string]bool{}
+			for _, configured := range configuredModules(source) {
+				if configured.Id != "" && normalizeID(configured.Id) == normalizeID(device.ID) {
+					// alias of the base station
+					continue
+				}
+				log := log.With("module_id", configured.Id, "module_name", configured.Name)
+				modules := matchModules(configured, device.Modules)
+				switch {
+				case len(modules) == 0:
+					log.With("available", describeStations([]weather.StationDataDevice{device})).Warn("configured module not found")
+					continue
+				case len(modules) > 1:
+					log.With("num", len(modules)).Warn("several modules have the configured name, use the module ID to select one")
+				}
+				for _, module := range modules {
+					if selected[module.ID] {
+						log.With("id", module.ID).Debug("module has already been selected")
+						continue
 					}
+					selected[module.ID] = true
+					log.With("id", module.ID, "since", since.Unix(), "until", now.Unix()).Info("found configured module - fetching data")
+					reading, ok := newModuleReading(device, module)
+					if !ok {
+						log.With("id", module.ID).Warn("module has not sent any data")
+						continue
+					}
+					reading.configure(configured)
+					data.ModuleReadings = append(data.ModuleReadings, reading)
+					foundMeasurements++
 				}
-				measurements = append(measurements, data)
 			}
+			measurements = append(measurements, data)
+		}
+		if !matchedStation {
+			log.With("available", describeStations(devices.Devices)).Warn("configured station not found")
 		}
 	}
+	if len(measurements) == 0 {
+		return nil, errors.Errorf("no configured station found, %s", describeStations(devices.Devices))
+	}
 	logger.With("num", foundMeasurements).Info("finished fetching measurement data")
 
+	for i := range measurements {
+		if measurements[i].StationReading != nil {
+			fetchHistory(ctx, logger, dataSource, measurements[i].StationReading, since, now)
+		}
+		for j := range measurements[i].ModuleReadings {
+			fetchHistory(ctx, logger, dataSource, &measurements[i].ModuleReadings[j], since, now)
+		}
+	}
+
 	return measurements, nil
 }
+
+// fetchHistory fills in the temperature history of the reading. The history is optional
+// so failures are only logged.
+func fetchHistory(ctx context.Context, logger *zap.SugaredLogger, dataSource DataSource, reading *Reading, since, until time.Time) {
+	if !reading.Type.HasTemperature() {
+		return
+	}
+	log := logger.With("name", reading.Name, "device_id", reading.Module.DeviceId, "module_id", reading.Module.ModuleId)
+	samples, err := dataSource.GetMeasure(ctx, reading.Module, since, until)
+	if err != nil {
+		fetchErrors.WithLabelValues("getmeasure").Inc()
+		log.With("err", err).Warn("could not fetch temperature history")
+		return
+	}
+	log.With("num", len(samples)).Debug("fetched temperature history")
+	reading.History = samples
+}
@@ -0,0 +1,231 @@
+package netatmo
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"weather-pi/internal"
+	"weather-pi/netatmo/netatmotest"
+
+	"go.uber.org/zap"
+)
+
+var testSources = []internal.Source{{
+	StationName: "Home",
+	ModuleNames: []string{"Outdoor", "Bedroom", "Rain gauge", "Wind gauge"},
+}}
+
+// readingsByName indexes the readings of all the measurements
+func readingsByName(t *testing.T, measurements []Measurement) map[string]Reading {
+	t.Helper()
+	if len(measurements) != 1 {
+		t.Fatalf("%d measurements, want 1", len(measurements))
+	}
+	if measurements[0].StationName != "Home" {
+		t.Errorf("station name = %q, want Home", measurements[0].StationName)
+	}
+	readings := map[string]Reading{}
+	for _, reading := range measurements[0].Readings() {
+		readings[reading.Name] = reading
+	}
+
+	return readings
+}
+
+// checkReadings compares the readings with the recorded response
+func checkReadings(t *testing.T, readings map[string]Reading) {
+	t.Helper()
+	if len(readings) != 5 {
+		t.Fatalf("readings = %v, want the station and 4 modules", readings)
+	}
+
+	station := readings["Living room"]
+	if station.Type != BaseStation || station.Module != (ModuleInfo{DeviceId: "70:ee:50:00:00:01"}) {
+		t.Errorf("station = %+v", station)
+	}
+	if station.Temperature != 21.4 || station.Humidity != 48 || *station.CO2 != 612 || *station.Noise != 38 {
+		t.Errorf("station reading = %+v", station)
+	}
+	if *station.Pressure != (Pressure{Value: 1016.2, Absolute: 1003.1, Trend: "up"}) {
+		t.Errorf("station pressure = %+v", *station.Pressure)
+	}
+	if !station.Timestamp.Equal(time.Unix(1634482785, 0)) || !station.Status.Reachable || *station.Status.WifiStatus != 45 {
+		t.Errorf("station status = %+v at %s", station.Status, station.Timestamp)
+	}
+
+	outdoor := readings["Outdoor"]
+	if outdoor.Type != OutdoorModule || outdoor.Module.ModuleId != "02:00:00:00:00:01" || outdoor.Module.DeviceId != "70:ee:50:00:00:01" {
+		t.Errorf("outdoor module = %+v", outdoor.Module)
+	}
+	if outdoor.Temperature != 8.3 || outdoor.MinTemp != 6.1 || outdoor.MaxTemp != 12.4 || outdoor.TempTrend != "down" || *outdoor.Status.Battery != 74 {
+		t.Errorf("outdoor reading = %+v", outdoor)
+	}
+	if outdoor.CO2 != nil || outdoor.Pressure != nil {
+		t.Errorf("outdoor reading has indoor data: %+v", outdoor)
+	}
+
+	bedroom := readings["Bedroom"]
+	if bedroom.Type != IndoorModule || bedroom.Temperature != 19.7 || bedroom.CO2 == nil || *bedroom.CO2 != 840 {
+		t.Errorf("bedroom reading = %+v", bedroom)
+	}
+
+	rain := readings["Rain gauge"]
+	if rain.Type != RainGauge || rain.Rain == nil || *rain.Rain != (Rain{Current: 0.1, SumHour: 0.4, SumDay: 2.7}) {
+		t.Errorf("rain gauge reading = %+v", rain)
+	}
+
+	wind := readings["Wind gauge"]
+	if wind.Type != WindGauge || wind.Wind == nil || *wind.Wind != (Wind{Strength: 12, Angle: 250, GustStrength: 27, GustAngle: 245}) {
+		t.Errorf("wind gauge reading = %+v", wind)
+	}
+}
+
+func TestFetchDataFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "getstationsdata.json")
+	if err := ioutil.WriteFile(path, netatmotest.StationData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	measurements, err := FetchData(context.Background(), zap.NewNop().Sugar(), NewFileSource(path), testSources, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("FetchData() error = %v", err)
+	}
+	readings := readingsByName(t, measurements)
+	checkReadings(t, readings)
+	for name, reading := range readings {
+		if reading.History != nil {
+			t.Errorf("recorded response has history for %s", name)
+		}
+	}
+}
+
+func TestFetchDataConfiguredTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "getstationsdata.json")
+	if err := ioutil.WriteFile(path, netatmotest.StationData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the outdoor module is selected by its ID and by its name, the station gets an alias
+	sources := []internal.Source{{
+		DeviceId:    "70-EE-50-00-00-01",
+		ModuleNames: []string{"Outdoor", "Bedroom"},
+		Modules: []internal.Module{
+			{Id: "70:EE:50:00:00:01", Alias: "Kitchen"},
+			{Id: "02-00-00-00-00-01", Alias: "Garden"},
+		},
+	}}
+
+	measurements, err := FetchData(context.Background(), zap.NewNop().Sugar(), NewFileSource(path), sources, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("FetchData() error = %v", err)
+	}
+	if len(measurements) != 1 {
+		t.Fatalf("%d measurements, want 1", len(measurements))
+	}
+	var names []string
+	for _, reading := range measurements[0].Readings() {
+		names = append(names, reading.Name)
+	}
+	if want := []string{"Kitchen", "Garden", "Bedroom"}; strings.Join(names, ", ") != strings.Join(want, ", ") {
+		t.Errorf("readings = %v, want %v", names, want)
+	}
+}
+
+func TestFileSourceErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{name: "missing", err: "could not read recorded stations data"},
+		{name: "invalid", data: `{"body": [`, err: "could not decode recorded stations data"},
+		{name: "failed", data: `{"body": {"devices": []}, "status": "error"}`, err: `recorded response has status "error"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if tt.data != "" {
+				if err := ioutil.WriteFile(path, []byte(tt.data), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := NewFileSource(path).GetStationData(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("GetStationData() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFetchDataAPISource(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+	// the token has expired so it is refreshed before the station data is fetched
+	source, store := newTestSource(t, server, testRetryPolicy, -time.Hour)
+
+	measurements, err := FetchData(context.Background(), zap.NewNop().Sugar(), source, testSources, time.Now().Add(-3*time.Hour))
+	if err != nil {
+		t.Fatalf("FetchData() error = %v", err)
+	}
+	readings := readingsByName(t, measurements)
+	checkReadings(t, readings)
+
+	// the temperature history is fetched for the modules measuring it
+	for name, reading := range readings {
+		if reading.Type.HasTemperature() != (len(reading.History) > 0) {
+			t.Errorf("%s has %d history samples", name, len(reading.History))
+		}
+		for i := 1; i < len(reading.History); i++ {
+			if !reading.History[i-1].Time.Before(reading.History[i].Time) {
+				t.Errorf("history of %s is not ordered by time", name)
+			}
+		}
+	}
+	if requests := server.Requests("/api/getmeasure"); requests != 3 {
+		t.Errorf("%d getmeasure requests, want 3", requests)
+	}
+
+	// the token is refreshed once and the rotated one is saved
+	if requests := server.Requests("/oauth2/token"); requests != 1 {
+		t.Errorf("%d token requests, want 1", requests)
+	}
+	accessToken, refreshToken := server.Tokens()
+	saved, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if saved.AccessToken != accessToken || saved.RefreshToken != refreshToken {
+		t.Errorf("saved token = %s/%s, want %s/%s", saved.AccessToken, saved.RefreshToken, accessToken, refreshToken)
+	}
+
+	// the refreshed token is reused by the next fetch
+	if _, err := FetchData(context.Background(), zap.NewNop().Sugar(), source, testSources, time.Now().Add(-3*time.Hour)); err != nil {
+		t.Fatalf("FetchData() error = %v", err)
+	}
+	if requests := server.Requests("/oauth2/token"); requests != 1 {
+		t.Errorf("%d token requests after the second fetch, want 1", requests)
+	}
+}
+
+func TestFetchDataErrors(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+	source, _ := newTestSource(t, server, testRetryPolicy, time.Hour)
+
+	if _, err := FetchData(context.Background(), zap.NewNop().Sugar(), source, nil, time.Now()); err == nil {
+		t.Error("FetchData() succeeded without sources")
+	}
+	_, err := FetchData(context.Background(), zap.NewNop().Sugar(), source, []internal.Source{{StationName: "Office"}}, time.Now())
+	if err == nil || !strings.Contains(err.Error(), `home "Home" station "Living room"`) {
+		t.Errorf("FetchData() error = %v, want the available stations", err)
+	}
+
+	server.InjectFailures("/api/getstationsdata", netatmotest.Failure{Status: http.StatusForbidden, Code: 13, Message: "Operation forbidden"})
+	if _, err := FetchData(context.Background(), zap.NewNop().Sugar(), source, testSources, time.Now()); err == nil {
+		t.Error("FetchData() succeeded although the station data could not be fetched")
+	}
+}
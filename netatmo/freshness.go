@@ -0,0 +1,70 @@
+package netatmo
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Freshness tells whether a module still reports its measurements.
+type Freshness int
+
+const (
+	Fresh Freshness = iota
+	// Stale readings are older than the max age of the module
+	Stale
+	// Unreachable modules are reported as not connected by the station
+	Unreachable
+)
+
+func (f Freshness) String() string {
+	switch f {
+	case Stale:
+		return "stale"
+	case Unreachable:
+		return "unreachable"
+	default:
+		return "fresh"
+	}
+}
+
+// Age returns the time since the module measured the reading, zero when it is not known.
+func (r Reading) Age(now time.Time) time.Duration {
+	if r.Timestamp.IsZero() {
+		return 0
+	}
+
+	return now.Sub(r.Timestamp)
+}
+
+// Freshness checks the reading against its own max age or the default one. Zero max age
+// disables the age check. Readings without a type come from old caches and are never unreachable.
+func (r Reading) Freshness(now time.Time, defaultMaxAge time.Duration) Freshness {
+	if r.Type != "" && !r.Status.Reachable {
+		return Unreachable
+	}
+	maxAge := r.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultMaxAge
+	}
+	if maxAge > 0 && r.Age(now) > maxAge {
+		return Stale
+	}
+
+	return Fresh
+}
+
+// WarnStale logs the modules which stopped reporting.
+func WarnStale(logger *zap.SugaredLogger, measurements []Measurement, now time.Time, defaultMaxAge time.Duration) {
+	for _, measurement := range measurements {
+		for _, reading := range measurement.Readings() {
+			freshness := reading.Freshness(now, defaultMaxAge)
+			if freshness == Fresh {
+				continue
+			}
+			logger.With("station", measurement.StationName, "module", reading.Name, "module_id", reading.Module.ModuleId,
+				"freshness", freshness, "last_seen", reading.Timestamp, "age", reading.Age(now).Round(time.Second)).
+				Warn("module stopped reporting")
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package netatmo
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name          string
+		reading       Reading
+		defaultMaxAge time.Duration
+		want          Freshness
+	}{
+		{name: "fresh", reading: Reading{Type: OutdoorModule, Timestamp: now.Add(-10 * time.Minute), Status: Status{Reachable: true}}, defaultMaxAge: time.Hour, want: Fresh},
+		{name: "at the max age", reading: Reading{Type: OutdoorModule, Timestamp: now.Add(-time.Hour), Status: Status{Reachable: true}}, defaultMaxAge: time.Hour, want: Fresh},
+		{name: "older than the default", reading: Reading{Type: OutdoorModule, Timestamp: now.Add(-61 * time.Minute), Status: Status{Reachable: true}}, defaultMaxAge: time.Hour, want: Stale},
+		{name: "age check disabled", reading: Reading{Type: OutdoorModule, Timestamp: now.Add(-48 * time.Hour), Status: Status{Reachable: true}}, want: Fresh},
+		// the rain gauge reports less often so it has a longer max age of its own
+		{
+			name:          "within the module max age",
+			reading:       Reading{Type: RainGauge, Timestamp: now.Add(-2 * time.Hour), Status: Status{Reachable: true}, MaxAge: 3 * time.Hour},
+			defaultMaxAge: time.Hour,
+			want:          Fresh,
+		},
+		{
+			name:          "older than the module max age",
+			reading:       Reading{Type: RainGauge, Timestamp: now.Add(-4 * time.Hour), Status: Status{Reachable: true}, MaxAge: 3 * time.Hour},
+			defaultMaxAge: 6 * time.Hour,
+			want:          Stale,
+		},
+		{
+			name:    "module max age without a default",
+			reading: Reading{Type: RainGauge, Timestamp: now.Add(-4 * time.Hour), Status: Status{Reachable: true}, MaxAge: 3 * time.Hour},
+			want:    Stale,
+		},
+		{name: "unreachable", reading: Reading{Type: OutdoorModule, Timestamp: now, Status: Status{Reachable: false}}, defaultMaxAge: time.Hour, want: Unreachable},
+		{name: "unreachable and old", reading: Reading{Type: OutdoorModule, Timestamp: now.Add(-48 * time.Hour)}, defaultMaxAge: time.Hour, want: Unreachable},
+		// the age of a reading without a timestamp is not known
+		{name: "zero timestamp", reading: Reading{Type: OutdoorModule, Status: Status{Reachable: true}}, defaultMaxAge: time.Hour, want: Fresh},
+		{name: "cached without a type", reading: Reading{Timestamp: now.Add(-10 * time.Minute)}, defaultMaxAge: time.Hour, want: Fresh},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.reading.Freshness(now, tt.defaultMaxAge); got != tt.want {
+				t.Errorf("Freshness() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadingAge(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	if age := (Reading{Timestamp: now.Add(-90 * time.Second)}).Age(now); age != 90*time.Second {
+		t.Errorf("Age() = %s, want 1m30s", age)
+	}
+	if age := (Reading{}).Age(now); age != 0 {
+		t.Errorf("Age() without a timestamp = %s, want 0", age)
+	}
+}
+
+func TestWarnStale(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	core, logs := observer.New(zapcore.WarnLevel)
+	WarnStale(zap.New(core).Sugar(), []Measurement{{
+		StationName:    "Home",
+		StationReading: &Reading{Name: "Living room", Type: BaseStation, Timestamp: now, Status: Status{Reachable: true}},
+		ModuleReadings: []Reading{
+			{Name: "Outdoor", Type: OutdoorModule, Module: ModuleInfo{ModuleId: "02:00:00:00:00:01"}, Timestamp: now.Add(-2 * time.Hour), Status: Status{Reachable: true}},
+			{Name: "Bedroom", Type: IndoorModule, Module: ModuleInfo{ModuleId: "03:00:00:00:00:01"}, Timestamp: now},
+			{Name: "Rain gauge", Type: RainGauge, Timestamp: now.Add(-2 * time.Hour), Status: Status{Reachable: true}, MaxAge: 3 * time.Hour},
+		},
+	}}, now, time.Hour)
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("%d warnings, want the outdoor and the indoor module", len(entries))
+	}
+	for i, want := range []struct {
+		module    string
+		freshness string
+	}{{"Outdoor", "stale"}, {"Bedroom", "unreachable"}} {
+		fields := entries[i].ContextMap()
+		if fields["module"] != want.module || fields["freshness"] != want.freshness {
+			t.Errorf("warning %d = %v, want %s %s", i, fields, want.module, want.freshness)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package netatmo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/hekmon/go-netatmo"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// callbackPath is where the browser is redirected after the app has been authorized
+const callbackPath = "/callback"
+
+// Login obtains the first pair of tokens with the OAuth authorization code flow. It listens for
+// the redirect on listenAddr (which has to match the redirect URI registered for the app),
+// passes the URL the user has to open to showURL and waits until the user authorizes the app.
+// Callbacks which do not carry the state of the request are rejected and the wait goes on.
+// When baseURL is not empty the authorization is done against that server instead of the Netatmo API.
+func Login(ctx context.Context, logger *zap.SugaredLogger, apiClientId, apiSecret, listenAddr, baseURL string, showURL func(authURL string)) (*oauth2.Token, error) {
+	if len(apiClientId) == 0 {
+		return nil, errors.New("empty API client ID")
+	}
+	if len(apiSecret) == 0 {
+		return nil, errors.New("empty API secret")
+	}
+	// authorization codes can be used only once so the exchange is not retried
+	httpClient, err := newHTTPClient(logger, baseURL, RetryPolicy{Attempts: 1})
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not listen for the OAuth callback")
+	}
+	oauthConfig := netatmo.GenerateOAuth2Config(netatmo.OAuth2BaseConfig{
+		ClientID:     apiClientId,
+		ClientSecret: apiSecret,
+		Scopes:       []string{readStationScope},
+		RedirectURL:  redirectURL(listenAddr, listener.Addr()),
+	})
+	authURL, err := authorizeURL(oauthConfig.AuthCodeURL(state), baseURL)
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(callbackPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("state") != state {
+			// not a response to our authorization request, keep waiting for the right one
+			logger.Warn("ignoring OAuth callback with invalid state")
+			http.Error(w, "invalid state", http.StatusBadRequest)
+			return
+		}
+		var res result
+		switch {
+		case query.Get("error") != "":
+			res.err = errors.Errorf("authorization failed: %s", query.Get("error"))
+		case query.Get("code") == "":
+			res.err = errors.New("OAuth callback without authorization code")
+		default:
+			res.code = query.Get("code")
+		}
+		if res.err != nil {
+			http.Error(w, res.err.Error(), http.StatusBadRequest)
+		} else {
+			_, _ = fmt.Fprintln(w, "weather-pie has been authorized, you can close this window.")
+		}
+		select {
+		case results <- res:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.With("err", err).Error("could not serve OAuth callback")
+		}
+	}()
+	defer server.Close()
+
+	logger.With("redirect_url", oauthConfig.RedirectURL).Info("waiting for the authorization")
+	showURL(authURL)
+
+	var res result
+	select {
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "authorization has not been finished")
+	case res = <-results:
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	token, err := oauthConfig.Exchange(context.WithValue(ctx, oauth2.HTTPClient, httpClient), res.code)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not exchange authorization code for a token")
+	}
+
+	return token, nil
+}
+
+// redirectURL keeps the host the user asked for (it has to match the registered redirect URI)
+// but takes the port from the listener in case a random one has been requested
+func redirectURL(listenAddr string, addr net.Addr) string {
+	host, _, err := net.SplitHostPort(listenAddr)
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	port := 0
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		port = tcpAddr.Port
+	}
+
+	return fmt.Sprintf("http://%s%s", net.JoinHostPort(host, strconv.Itoa(port)), callbackPath)
+}
+
+// authorizeURL points the authorization URL to baseURL if it is set. The URL is opened
+// by the user's browser so it cannot be redirected by the HTTP client.
+func authorizeURL(authURL, baseURL string) (string, error) {
+	if baseURL == "" {
+		return authURL, nil
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", errors.Wrap(err, "could not parse authorization URL")
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", errors.Wrap(err, "could not parse API base URL")
+	}
+	if u.Host == apiHost {
+		u.Scheme = base.Scheme
+		u.Host = base.Host
+		u.Path = path.Join("/", base.Path, u.Path)
+	}
+
+	return u.String(), nil
+}
+
+func randomState() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "could not generate OAuth state")
+	}
+
+	return hex.EncodeToString(buf), nil
+}
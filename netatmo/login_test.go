@@ -0,0 +1,182 @@
+package netatmo
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"weather-pi/netatmo/netatmotest"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// login runs Login and calls open with the authorization URL in its own goroutine
+// like a user switching to the browser
+func login(t *testing.T, ctx context.Context, server *netatmotest.Server, clientID string, open func(authURL string)) (*oauth2.Token, error) {
+	t.Helper()
+	type result struct {
+		token *oauth2.Token
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		token, err := Login(ctx, zap.NewNop().Sugar(), clientID, netatmotest.ClientSecret, "127.0.0.1:0", server.URL, func(authURL string) {
+			go open(authURL)
+		})
+		results <- result{token: token, err: err}
+	}()
+
+	select {
+	case res := <-results:
+		return res.token, res.err
+	case <-time.After(10 * time.Second):
+		t.Fatal("Login() did not return")
+		return nil, nil
+	}
+}
+
+// callback calls the redirect URI of the authorization URL with the given query
+func callback(t *testing.T, authURL string, query url.Values) int {
+	auth, err := url.Parse(authURL)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	redirect, err := url.Parse(auth.Query().Get("redirect_uri"))
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	redirect.RawQuery = query.Encode()
+	resp, err := http.Get(redirect.String())
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	_ = resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+// authorize opens the authorization URL, the server approves it and redirects back
+func authorize(t *testing.T, authURL string) int {
+	resp, err := http.Get(authURL)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	_ = resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestLogin(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+
+	token, err := login(t, context.Background(), server, netatmotest.ClientID, func(authURL string) {
+		if status := authorize(t, authURL); status != http.StatusOK {
+			t.Errorf("callback answered %d", status)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	accessToken, refreshToken := server.Tokens()
+	if token.AccessToken != accessToken || token.RefreshToken != refreshToken || accessToken == netatmotest.InitialAccessToken {
+		t.Errorf("token = %s/%s, want the exchanged %s/%s", token.AccessToken, token.RefreshToken, accessToken, refreshToken)
+	}
+	authorizations := server.Authorizations()
+	if len(authorizations) != 1 {
+		t.Fatalf("%d authorization requests, want 1", len(authorizations))
+	}
+	query := authorizations[0]
+	if query.Get("scope") != readStationScope || query.Get("state") == "" || !strings.HasSuffix(query.Get("redirect_uri"), callbackPath) {
+		t.Errorf("authorization request %v", query)
+	}
+}
+
+func TestLoginInvalidState(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+
+	token, err := login(t, context.Background(), server, netatmotest.ClientID, func(authURL string) {
+		// callbacks of other requests are rejected without ending the login
+		if status := callback(t, authURL, url.Values{"code": {"forged"}, "state": {"other"}}); status != http.StatusBadRequest {
+			t.Errorf("callback with a wrong state answered %d, want 400", status)
+		}
+		if status := callback(t, authURL, url.Values{"code": {"forged"}}); status != http.StatusBadRequest {
+			t.Errorf("callback without a state answered %d, want 400", status)
+		}
+		if status := authorize(t, authURL); status != http.StatusOK {
+			t.Errorf("callback answered %d", status)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if accessToken, _ := server.Tokens(); token.AccessToken != accessToken {
+		t.Errorf("access token = %s, want %s", token.AccessToken, accessToken)
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		clientID string
+		open     func(t *testing.T, authURL string)
+		err      string
+	}{
+		{
+			name:     "denied",
+			clientID: "unknown-client",
+			open:     func(t *testing.T, authURL string) { authorize(t, authURL) },
+			err:      "authorization failed: invalid_client",
+		},
+		{
+			name:     "missing code",
+			clientID: netatmotest.ClientID,
+			open: func(t *testing.T, authURL string) {
+				auth, _ := url.Parse(authURL)
+				if status := callback(t, authURL, url.Values{"state": {auth.Query().Get("state")}}); status != http.StatusBadRequest {
+					t.Errorf("callback without a code answered %d, want 400", status)
+				}
+			},
+			err: "OAuth callback without authorization code",
+		},
+		{
+			name:     "unknown code",
+			clientID: netatmotest.ClientID,
+			open: func(t *testing.T, authURL string) {
+				auth, _ := url.Parse(authURL)
+				callback(t, authURL, url.Values{"state": {auth.Query().Get("state")}, "code": {"test-code-0"}})
+			},
+			err: "could not exchange authorization code for a token",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := netatmotest.NewServer(nil)
+			defer server.Close()
+
+			_, err := login(t, context.Background(), server, tt.clientID, func(authURL string) { tt.open(t, authURL) })
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Login() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoginCancelled(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := login(t, ctx, server, netatmotest.ClientID, func(string) { cancel() })
+	if err == nil || !strings.Contains(err.Error(), "authorization has not been finished") {
+		t.Errorf("Login() error = %v, want the cancellation", err)
+	}
+}
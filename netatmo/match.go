@@ -0,0 +1,84 @@
+package netatmo
+
+import (
+	"fmt"
+	"strings"
+	"weather-pi/internal"
+
+	"github.com/hekmon/go-netatmo/weather"
+)
+
+// normalizeID makes MAC addresses written in upper case or with dashes comparable.
+func normalizeID(id string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(id), "-", ":"))
+}
+
+// matchStation tells if the source selects the station. Name of the home is only
+// compared when the source has no device ID.
+func matchStation(source internal.Source, device weather.StationDataDevice) bool {
+	if source.DeviceId != "" {
+		return normalizeID(source.DeviceId) == normalizeID(device.ID)
+	}
+
+	return source.StationName != "" && device.HomeName == source.StationName
+}
+
+// configuredModules returns the modules of the source followed by the ones listed by name only.
+func configuredModules(source internal.Source) []internal.Module {
+	modules := make([]internal.Module, 0, len(source.Modules)+len(source.ModuleNames))
+	modules = append(modules, source.Modules...)
+	for _, name := range source.ModuleNames {
+		modules = append(modules, internal.Module{Name: name})
+	}
+
+	return modules
+}
+
+// matchModules returns the modules of the station selected by the configured module.
+// Names are not unique so matching by name can select more than one module.
+func matchModules(configured internal.Module, modules []weather.StationDataModule) []weather.StationDataModule {
+	var matched []weather.StationDataModule
+	for _, module := range modules {
+		if configured.Id != "" {
+			if normalizeID(configured.Id) == normalizeID(module.ID) {
+				return []weather.StationDataModule{module}
+			}
+			continue
+		}
+		if strings.TrimSpace(configured.Name) == strings.TrimSpace(module.ModuleName) {
+			matched = append(matched, module)
+		}
+	}
+
+	return matched
+}
+
+// stationModule returns the config of the base station itself, listed among the modules.
+func stationModule(source internal.Source, device weather.StationDataDevice) internal.Module {
+	for _, module := range source.Modules {
+		if module.Id != "" && normalizeID(module.Id) == normalizeID(device.ID) {
+			return module
+		}
+	}
+
+	return internal.Module{}
+}
+
+// describeStations lists the stations and the modules found in the response so a config
+// matching nothing can be fixed.
+func describeStations(devices []weather.StationDataDevice) string {
+	if len(devices) == 0 {
+		return "the account has no stations"
+	}
+	descriptions := make([]string, 0, len(devices))
+	for _, device := range devices {
+		modules := make([]string, 0, len(device.Modules))
+		for _, module := range device.Modules {
+			modules = append(modules, fmt.Sprintf("%q (%s)", module.ModuleName, module.ID))
+		}
+		descriptions = append(descriptions, fmt.Sprintf("home %q station %q (%s) with modules [%s]",
+			device.HomeName, device.ModuleName, device.ID, strings.Join(modules, ", ")))
+	}
+
+	return "found " + strings.Join(descriptions, "; ")
+}
@@ -0,0 +1,120 @@
+package netatmo
+
+import (
+	"testing"
+	"weather-pi/internal"
+
+	"github.com/hekmon/go-netatmo/weather"
+)
+
+var testDevice = weather.StationDataDevice{
+	ID:         "70:ee:50:00:00:01",
+	HomeName:   "Home",
+	ModuleName: "Living room",
+	Modules: []weather.StationDataModule{
+		{ID: "02:00:00:00:00:01", ModuleName: "Outdoor"},
+		{ID: "03:00:00:00:00:01", ModuleName: "Bedroom"},
+		{ID: "03:00:00:00:00:0b", ModuleName: "Bedroom"},
+	},
+}
+
+func TestNormalizeID(t *testing.T) {
+	for id, want := range map[string]string{
+		"70:ee:50:00:00:01":   "70:ee:50:00:00:01",
+		"70:EE:50:00:00:01":   "70:ee:50:00:00:01",
+		"70-ee-50-00-00-01":   "70:ee:50:00:00:01",
+		" 70-EE-50-00-00-01 ": "70:ee:50:00:00:01",
+	} {
+		if got := normalizeID(id); got != want {
+			t.Errorf("normalizeID(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestMatchStation(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		source internal.Source
+		want   bool
+	}{
+		{name: "station name", source: internal.Source{StationName: "Home"}, want: true},
+		{name: "other station name", source: internal.Source{StationName: "Office"}},
+		{name: "no selector", source: internal.Source{}},
+		{name: "device ID", source: internal.Source{DeviceId: "70:ee:50:00:00:01"}, want: true},
+		{name: "upper case device ID", source: internal.Source{DeviceId: "70:EE:50:00:00:01"}, want: true},
+		{name: "dash separated device ID", source: internal.Source{DeviceId: "70-ee-50-00-00-01"}, want: true},
+		// the device ID takes priority over the name of the home
+		{name: "device ID of another station", source: internal.Source{DeviceId: "70:ee:50:00:00:02", StationName: "Home"}},
+		{name: "device ID with another name", source: internal.Source{DeviceId: "70:ee:50:00:00:01", StationName: "Office"}, want: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchStation(tt.source, testDevice); got != tt.want {
+				t.Errorf("matchStation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchModules(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		configured internal.Module
+		want       []string
+	}{
+		{name: "name", configured: internal.Module{Name: "Outdoor"}, want: []string{"02:00:00:00:00:01"}},
+		{name: "name with spaces", configured: internal.Module{Name: " Outdoor "}, want: []string{"02:00:00:00:00:01"}},
+		{name: "shared name", configured: internal.Module{Name: "Bedroom"}, want: []string{"03:00:00:00:00:01", "03:00:00:00:00:0b"}},
+		{name: "ID", configured: internal.Module{Id: "03:00:00:00:00:0b"}, want: []string{"03:00:00:00:00:0b"}},
+		{name: "upper case ID", configured: internal.Module{Id: "03:00:00:00:00:0B"}, want: []string{"03:00:00:00:00:0b"}},
+		{name: "dash separated ID", configured: internal.Module{Id: "03-00-00-00-00-0B"}, want: []string{"03:00:00:00:00:0b"}},
+		// the ID selects a single module even when the name would select several
+		{name: "ID and shared name", configured: internal.Module{Id: "03:00:00:00:00:01", Name: "Bedroom"}, want: []string{"03:00:00:00:00:01"}},
+		{name: "ID and another name", configured: internal.Module{Id: "03:00:00:00:00:01", Name: "Outdoor"}, want: []string{"03:00:00:00:00:01"}},
+		{name: "unknown ID", configured: internal.Module{Id: "03:00:00:00:00:03", Name: "Bedroom"}},
+		{name: "unknown name", configured: internal.Module{Name: "Garage"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			modules := matchModules(tt.configured, testDevice.Modules)
+			ids := make([]string, 0, len(modules))
+			for _, module := range modules {
+				ids = append(ids, module.ID)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("matchModules() = %v, want %v", ids, tt.want)
+			}
+			for i := range tt.want {
+				if ids[i] != tt.want[i] {
+					t.Errorf("matchModules() = %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStationModule(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		source internal.Source
+		want   internal.Module
+	}{
+		{name: "no modules", source: internal.Source{StationName: "Home"}},
+		{
+			name:   "alias",
+			source: internal.Source{Modules: []internal.Module{{Id: "02:00:00:00:00:01", Alias: "Garden"}, {Id: "70:ee:50:00:00:01", Alias: "Kitchen"}}},
+			want:   internal.Module{Id: "70:ee:50:00:00:01", Alias: "Kitchen"},
+		},
+		{
+			name:   "upper case alias",
+			source: internal.Source{Modules: []internal.Module{{Id: "70-EE-50-00-00-01", Alias: "Kitchen"}}},
+			want:   internal.Module{Id: "70-EE-50-00-00-01", Alias: "Kitchen"},
+		},
+		// a module named like the station is not the station
+		{name: "name only", source: internal.Source{Modules: []internal.Module{{Name: "Living room", Alias: "Kitchen"}}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stationModule(tt.source, testDevice); got != tt.want {
+				t.Errorf("stationModule() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
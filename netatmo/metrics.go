@@ -0,0 +1,39 @@
+package netatmo
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	fetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "weatherpie",
+		Subsystem: "netatmo",
+		Name:      "fetch_errors_total",
+		Help:      "Number of failed requests for the Netatmo data.",
+	}, []string{"request"})
+
+	requestRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "weatherpie",
+		Subsystem: "netatmo",
+		Name:      "request_retries_total",
+		Help:      "Number of retried Netatmo requests by the reason of the failure.",
+	}, []string{"reason"})
+
+	tokenRefreshes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "weatherpie",
+		Subsystem: "netatmo",
+		Name:      "token_refreshes_total",
+		Help:      "Number of times the OAuth token has been rotated.",
+	})
+)
+
+func init() {
+	// export zeros before the first error happens
+	for _, request := range []string{"getstationsdata", "getmeasure"} {
+		fetchErrors.WithLabelValues(request)
+	}
+	for _, reason := range []string{"network", "rate_limit", "server_error"} {
+		requestRetries.WithLabelValues(reason)
+	}
+}
@@ -0,0 +1,361 @@
+// Package netatmotest provides a local stand-in for the Netatmo API so the app can be
+// developed and exercised without credentials and network access.
+package netatmotest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StationData is a recorded getstationsdata response with a single station and
+// an outdoor, indoor, rain and wind module.
+//
+//go:embed testdata/getstationsdata.json
+var StationData []byte
+
+const (
+	InitialAccessToken  = "test-access-token"
+	InitialRefreshToken = "test-refresh-token"
+	ClientID            = "test-client-id"
+	ClientSecret        = "test-client-secret"
+)
+
+// Failure is an injected error response.
+type Failure struct {
+	// Status is the HTTP status of the response
+	Status int
+	// Code and Message are sent as the Netatmo error when Code is not zero
+	Code    int
+	Message string
+	// RetryAfter is sent in the Retry-After header when not zero
+	RetryAfter time.Duration
+	// Delay holds the response back, e.g. to make the request time out
+	Delay time.Duration
+	// Drop closes the connection without sending any response
+	Drop bool
+}
+
+var (
+	// RateLimited is the response Netatmo sends when the user reached the request limit
+	RateLimited = Failure{Status: http.StatusForbidden, Code: 26, Message: "User usage reached"}
+	// TooManyRequests is the generic rate limiting response
+	TooManyRequests = Failure{Status: http.StatusTooManyRequests, RetryAfter: time.Second}
+	// ServiceUnavailable is a transient server error
+	ServiceUnavailable = Failure{Status: http.StatusServiceUnavailable}
+	// Dropped connection makes the client fail with a network error
+	Dropped = Failure{Drop: true}
+)
+
+// Server mimics the Netatmo OAuth endpoints and the weather station API.
+// Every token refresh rotates both the access and the refresh token like the real API.
+// Authorization requests are approved right away by redirecting back with a code.
+// Failures can be injected to exercise the retries of the client.
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	stationData  []byte
+	accessToken  string
+	refreshToken string
+	rotations    int
+	requests     map[string]int
+	// codes maps issued authorization codes onto the redirect URI they have been issued for
+	codes          map[string]string
+	authorizations []url.Values
+	// failures are returned instead of the real responses, in order, per path
+	failures map[string][]Failure
+}
+
+// NewServer starts a stand-in server replaying the given getstationsdata response.
+// If stationData is nil the embedded StationData is used.
+func NewServer(stationData []byte) *Server {
+	if stationData == nil {
+		stationData = StationData
+	}
+	s := &Server{
+		stationData:  stationData,
+		accessToken:  InitialAccessToken,
+		refreshToken: InitialRefreshToken,
+		requests:     map[string]int{},
+		codes:        map[string]string{},
+		failures:     map[string][]Failure{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/authorize", s.handleAuthorize)
+	mux.HandleFunc("/oauth2/token", s.handleToken)
+	mux.HandleFunc("/api/getstationsdata", s.handleStationData)
+	mux.HandleFunc("/api/getmeasure", s.handleMeasure)
+	s.Server = httptest.NewServer(s.count(mux))
+
+	return s
+}
+
+// SetStationData replaces the replayed getstationsdata response.
+func (s *Server) SetStationData(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stationData = data
+}
+
+// Tokens returns the currently valid access and refresh tokens.
+func (s *Server) Tokens() (accessToken, refreshToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accessToken, s.refreshToken
+}
+
+// Authorizations returns query parameters of all the authorization requests.
+func (s *Server) Authorizations() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]url.Values(nil), s.authorizations...)
+}
+
+// InjectFailures makes the next requests for the given path (e.g. /api/getstationsdata
+// or /oauth2/token) fail one by one. The requests after them are served normally.
+func (s *Server) InjectFailures(path string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[path] = append(s.failures[path], failures...)
+}
+
+// Requests returns how many requests have been received for the given path.
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+func (s *Server) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		var failure *Failure
+		if failures := s.failures[r.URL.Path]; len(failures) > 0 {
+			failure = &failures[0]
+			s.failures[r.URL.Path] = failures[1:]
+		}
+		s.mu.Unlock()
+
+		if failure != nil {
+			fail(w, r, *failure)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.mu.Lock()
+	s.authorizations = append(s.authorizations, query)
+	s.mu.Unlock()
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	params := redirectURI.Query()
+	params.Set("state", query.Get("state"))
+	switch {
+	case query.Get("client_id") != ClientID:
+		params.Set("error", "invalid_client")
+	case query.Get("response_type") != "code":
+		params.Set("error", "unsupported_response_type")
+	default:
+		s.mu.Lock()
+		code := fmt.Sprintf("test-code-%d", len(s.authorizations))
+		s.codes[code] = query.Get("redirect_uri")
+		s.mu.Unlock()
+		params.Set("code", code)
+	}
+	redirectURI.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != ClientID || clientSecret != ClientSecret {
+		writeOAuthError(w, "invalid_client")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.PostForm.Get("grant_type") {
+	case "refresh_token":
+		if r.PostForm.Get("refresh_token") != s.refreshToken {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		redirectURI, ok := s.codes[code]
+		if !ok || redirectURI != r.PostForm.Get("redirect_uri") {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		delete(s.codes, code)
+	default:
+		writeOAuthError(w, "unsupported_grant_type")
+		return
+	}
+
+	s.rotations++
+	s.accessToken = fmt.Sprintf("%s-%d", InitialAccessToken, s.rotations)
+	s.refreshToken = fmt.Sprintf("%s-%d", InitialRefreshToken, s.rotations)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  s.accessToken,
+		"refresh_token": s.refreshToken,
+		"expires_in":    10800,
+		"expire_in":     10800,
+		"scope":         []string{"read_station"},
+	})
+}
+
+func (s *Server) handleStationData(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeAPIError(w, http.StatusForbidden, 2, "Invalid access token")
+		return
+	}
+
+	s.mu.Lock()
+	data := s.stationData
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// handleMeasure returns a synthetic daily temperature curve, different for every module.
+func (s *Server) handleMeasure(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeAPIError(w, http.StatusForbidden, 2, "Invalid access token")
+		return
+	}
+
+	query := r.URL.Query()
+	begin, errBegin := strconv.ParseInt(query.Get("date_begin"), 10, 64)
+	end, errEnd := strconv.ParseInt(query.Get("date_end"), 10, 64)
+	step, ok := measureScales[query.Get("scale")]
+	if errBegin != nil || errEnd != nil || !ok || query.Get("device_id") == "" {
+		writeAPIError(w, http.StatusBadRequest, 21, "Invalid parameters")
+		return
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(query.Get("device_id") + query.Get("module_id")))
+	offset := float64(hash.Sum32()%200) / 10
+	body := map[string][]float64{}
+	for ts := begin - begin%step + step; ts <= end; ts += step {
+		value := offset + 5*math.Sin(float64(ts%86400)/86400*2*math.Pi)
+		body[strconv.FormatInt(ts, 10)] = []float64{math.Round(value*10) / 10}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"body":   body,
+		"status": "ok",
+	})
+}
+
+// measureScales maps getmeasure scales to their step in seconds
+var measureScales = map[string]int64{
+	"30min":  30 * 60,
+	"1hour":  60 * 60,
+	"3hours": 3 * 60 * 60,
+	"1day":   24 * 60 * 60,
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		_ = r.ParseForm()
+		token = r.Form.Get("access_token")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return token == s.accessToken
+}
+
+func fail(w http.ResponseWriter, r *http.Request, failure Failure) {
+	if failure.Delay > 0 {
+		select {
+		case <-time.After(failure.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if failure.Drop {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				_ = conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+	if failure.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(failure.RetryAfter/time.Second)))
+	}
+	status := failure.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	if failure.Code != 0 {
+		writeAPIError(w, status, failure.Code, failure.Message)
+		return
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+func writeOAuthError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
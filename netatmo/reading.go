@@ -0,0 +1,134 @@
+package netatmo
+
+import "github.com/hekmon/go-netatmo/weather"
+
+// ModuleType is the Netatmo type of the station or the module.
+type ModuleType string
+
+const (
+	BaseStation   ModuleType = "NAMain"
+	OutdoorModule ModuleType = "NAModule1"
+	WindGauge     ModuleType = "NAModule2"
+	RainGauge     ModuleType = "NAModule3"
+	IndoorModule  ModuleType = "NAModule4"
+)
+
+// HasTemperature tells if readings of the module type carry temperature and humidity.
+func (t ModuleType) HasTemperature() bool {
+	switch t {
+	case WindGauge, RainGauge:
+		return false
+	default:
+		return true
+	}
+}
+
+// Trend of the temperature or the pressure: "up", "down", "stable" or empty when unknown.
+type Trend string
+
+// Pressure is measured by the base station only.
+type Pressure struct {
+	// Value is the pressure at sea level in mbar
+	Value float64
+	// Absolute is the pressure at the station altitude in mbar
+	Absolute float64
+	Trend    Trend
+}
+
+// Rain is measured by the rain gauge, all the values are in mm.
+type Rain struct {
+	Current float64
+	SumHour float64
+	SumDay  float64
+}
+
+// Wind is measured by the wind gauge, strengths are in km/h and angles in degrees.
+type Wind struct {
+	Strength     int64
+	Angle        int64
+	GustStrength int64
+	GustAngle    int64
+}
+
+// Status describes the health of the station or the module. Fields which do not apply
+// to the module type are nil.
+type Status struct {
+	Reachable bool
+	// Battery is the battery level in percent (modules only)
+	Battery *int64
+	// RFStatus is the radio signal quality between the module and the station (modules only)
+	RFStatus *int64
+	// WifiStatus is the Wi-Fi signal quality of the base station
+	WifiStatus *int64
+}
+
+// newStationReading converts the base station data.
+func newStationReading(device weather.StationDataDevice) Reading {
+	data := device.DashboardData
+	co2, noise, wifi := int64(data.CO2), int64(data.Noise), int64(device.WifiStatus)
+
+	return Reading{
+		Name:        device.ModuleName,
+		Type:        BaseStation,
+		Module:      ModuleInfo{DeviceId: device.ID},
+		Timestamp:   data.Time,
+		Temperature: data.Temperature,
+		MinTemp:     data.TempMin,
+		MaxTemp:     data.TempMax,
+		Humidity:    int64(data.Humidity),
+		TempTrend:   Trend(data.TempTrend),
+		CO2:         &co2,
+		Noise:       &noise,
+		Pressure:    &Pressure{Value: data.Pressure, Absolute: data.AbsolutePressure, Trend: Trend(data.PressureTrend)},
+		Status:      Status{Reachable: device.Reachable, WifiStatus: &wifi},
+	}
+}
+
+// newModuleReading converts the module data. It returns false if the module has not sent any data.
+func newModuleReading(device weather.StationDataDevice, module weather.StationDataModule) (Reading, bool) {
+	battery, rf := int64(module.BatteryPercent), int64(module.RFStatus)
+	reading := Reading{
+		Name:   module.ModuleName,
+		Type:   ModuleType(module.Type),
+		Module: ModuleInfo{DeviceId: device.ID, ModuleId: module.ID},
+		Status: Status{Reachable: module.Reachable, Battery: &battery, RFStatus: &rf},
+	}
+
+	switch {
+	case module.DashboardDataIndoor != nil:
+		data := module.DashboardDataIndoor
+		co2 := int64(data.CO2)
+		reading.Timestamp = data.Time
+		reading.Temperature = data.Temperature
+		reading.MinTemp = data.MinTemp
+		reading.MaxTemp = data.MaxTemp
+		reading.Humidity = data.Humidity
+		reading.TempTrend = Trend(data.TempTrend)
+		reading.CO2 = &co2
+	case module.DashboardDataOutdoor != nil:
+		data := module.DashboardDataOutdoor
+		reading.Timestamp = data.Time
+		reading.Temperature = data.Temperature
+		reading.MinTemp = data.MinTemp
+		reading.MaxTemp = data.MaxTemp
+		reading.Humidity = data.Humidity
+		reading.TempTrend = Trend(data.TempTrend)
+	case module.DashboardDataRain != nil:
+		data := module.DashboardDataRain
+		reading.Timestamp = data.Time
+		reading.Rain = &Rain{Current: data.Rain, SumHour: data.SumRain1, SumDay: data.SumRain24}
+	case module.DashboardDataWind != nil:
+		data := module.DashboardDataWind
+		reading.Timestamp = data.Time
+		reading.Wind = &Wind{
+			Strength:     int64(data.WindStrength),
+			Angle:        int64(data.WindAngle),
+			GustStrength: int64(data.GustStrength),
+			GustAngle:    int64(data.GustAngle),
+		}
+	default:
+		return Reading{}, false
+	}
+
+	return reading, true
+}
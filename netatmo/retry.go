@@ -0,0 +1,215 @@
+package netatmo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetryPolicy controls how failed requests to the Netatmo API are retried. Zero fields are
+// replaced with the values of DefaultRetryPolicy.
+type RetryPolicy struct {
+	// Attempts is the maximum number of tries of a request, 1 disables retries
+	Attempts int
+	// InitialBackoff is the delay before the first retry, it doubles with every retry up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// RequestTimeout limits a single try of a request
+	RequestTimeout time.Duration
+}
+
+// DefaultRetryPolicy gives up after about a minute which is well below the refresh interval.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:       4,
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     30 * time.Second,
+	RequestTimeout: 20 * time.Second,
+}
+
+// rateLimitCodes are the Netatmo error codes returned when too many requests have been sent
+var rateLimitCodes = map[int]bool{
+	26: true, // user usage reached
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.Attempts <= 0 {
+		p.Attempts = DefaultRetryPolicy.Attempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.RequestTimeout <= 0 {
+		p.RequestTimeout = DefaultRetryPolicy.RequestTimeout
+	}
+
+	return p
+}
+
+// backoff returns the delay before the given retry (starting with 1). The delay is picked
+// randomly from its upper half so clients failing at the same time do not retry in sync.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < retry && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryTransport retries requests failing because of network errors, rate limiting
+// and server errors. Every try is limited by the request timeout of the policy.
+type retryTransport struct {
+	log    *zap.SugaredLogger
+	policy RetryPolicy
+	next   http.RoundTripper
+}
+
+func newRetryTransport(logger *zap.SugaredLogger, policy RetryPolicy, next http.RoundTripper) *retryTransport {
+	return &retryTransport{log: logger, policy: policy.withDefaults(), next: next}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for retry := 1; ; retry++ {
+		resp, err := t.try(req)
+		reason := retryReason(resp, err)
+		if reason == "" || retry >= t.policy.Attempts || ctx.Err() != nil || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		delay := t.policy.backoff(retry)
+		if wait := retryAfter(resp); wait > delay {
+			if wait > t.policy.MaxBackoff {
+				// waiting longer than a refresh interval would not help
+				return resp, err
+			}
+			delay = wait
+		}
+		requestRetries.WithLabelValues(reason).Inc()
+		log := t.log.With("url", req.URL.Path, "reason", reason, "retry", retry, "delay", delay)
+		if err != nil {
+			log = log.With("err", err)
+		} else {
+			log = log.With("status", resp.StatusCode)
+		}
+		log.Warn("Netatmo request failed, retrying")
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// try sends the request once. The timeout is cancelled when the response body is closed
+// so the body can still be read after the function returns.
+func (t *retryTransport) try(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.policy.RequestTimeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+// retryReason tells why the request should be retried, empty means it should not
+func retryReason(resp *http.Response, err error) string {
+	switch {
+	case err != nil:
+		return "network"
+	case resp.StatusCode == http.StatusTooManyRequests || isRateLimitError(resp):
+		return "rate_limit"
+	case resp.StatusCode >= 500:
+		return "server_error"
+	default:
+		return ""
+	}
+}
+
+// isRateLimitError checks the error code of the forbidden responses as Netatmo reports
+// reached limits that way. The body is buffered so it can be read again.
+func isRateLimitError(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var apiErr struct {
+		Error apiError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &apiErr); err != nil {
+		return false
+	}
+
+	return rateLimitCodes[apiErr.Error.Code]
+}
+
+// retryAfter returns the delay requested by the server or 0
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+
+	return 0
+}
+
+// cancelBody releases the context of the request when the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
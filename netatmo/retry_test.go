@@ -0,0 +1,235 @@
+package netatmo
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+	"weather-pi/netatmo/netatmotest"
+	"weather-pi/tokenstore"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// testRetryPolicy keeps the tests fast while still retrying
+var testRetryPolicy = RetryPolicy{
+	Attempts:       3,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     50 * time.Millisecond,
+	RequestTimeout: 5 * time.Second,
+}
+
+var testModule = ModuleInfo{DeviceId: "70:ee:50:00:00:01", ModuleId: "02:00:00:00:00:01"}
+
+// newTestSource creates a source talking to the server, the token expires after the given duration
+func newTestSource(t *testing.T, server *netatmotest.Server, policy RetryPolicy, expiresIn time.Duration) (*APISource, *tokenstore.FileStore) {
+	t.Helper()
+	token := &oauth2.Token{
+		AccessToken:  netatmotest.InitialAccessToken,
+		RefreshToken: netatmotest.InitialRefreshToken,
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(expiresIn),
+	}
+	store := tokenstore.NewFileStore(filepath.Join(t.TempDir(), "token.json"))
+	source, err := NewAPISource(zap.NewNop().Sugar(), netatmotest.ClientID, netatmotest.ClientSecret, token, store, server.URL, policy)
+	if err != nil {
+		t.Fatalf("NewAPISource() error = %v", err)
+	}
+
+	return source, store
+}
+
+func getMeasure(ctx context.Context, source *APISource) ([]Sample, error) {
+	until := time.Now()
+	return source.GetMeasure(ctx, testModule, until.Add(-2*time.Hour), until)
+}
+
+func TestRetryStatuses(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		failures []netatmotest.Failure
+		reason   string
+		wantErr  bool
+		requests int
+	}{
+		{name: "service unavailable", failures: []netatmotest.Failure{netatmotest.ServiceUnavailable}, reason: "server_error", requests: 2},
+		{name: "server errors", failures: []netatmotest.Failure{{Status: http.StatusInternalServerError}, {Status: http.StatusBadGateway}}, reason: "server_error", requests: 3},
+		{name: "user usage reached", failures: []netatmotest.Failure{netatmotest.RateLimited}, reason: "rate_limit", requests: 2},
+		{name: "too many requests", failures: []netatmotest.Failure{{Status: http.StatusTooManyRequests}}, reason: "rate_limit", requests: 2},
+		{name: "dropped connection", failures: []netatmotest.Failure{netatmotest.Dropped}, reason: "network", requests: 2},
+		{
+			name:     "forbidden",
+			failures: []netatmotest.Failure{{Status: http.StatusForbidden, Code: 13, Message: "Operation forbidden"}},
+			wantErr:  true,
+			requests: 1,
+		},
+		{
+			name:     "bad request",
+			failures: []netatmotest.Failure{{Status: http.StatusBadRequest, Code: 21, Message: "Invalid parameters"}},
+			wantErr:  true,
+			requests: 1,
+		},
+		{
+			name:     "attempts exhausted",
+			failures: []netatmotest.Failure{netatmotest.ServiceUnavailable, netatmotest.ServiceUnavailable, netatmotest.ServiceUnavailable},
+			reason:   "server_error",
+			wantErr:  true,
+			requests: 3,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := netatmotest.NewServer(nil)
+			defer server.Close()
+			server.InjectFailures("/api/getmeasure", tt.failures...)
+			source, _ := newTestSource(t, server, testRetryPolicy, time.Hour)
+
+			var retries float64
+			if tt.reason != "" {
+				retries = testutil.ToFloat64(requestRetries.WithLabelValues(tt.reason))
+			}
+			samples, err := getMeasure(context.Background(), source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetMeasure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(samples) == 0 {
+				t.Error("GetMeasure() returned no samples")
+			}
+			if requests := server.Requests("/api/getmeasure"); requests != tt.requests {
+				t.Errorf("%d requests, want %d", requests, tt.requests)
+			}
+			if tt.reason != "" {
+				if retried := testutil.ToFloat64(requestRetries.WithLabelValues(tt.reason)) - retries; int(retried) != tt.requests-1 {
+					t.Errorf("%v retries counted for %s, want %d", retried, tt.reason, tt.requests-1)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+	// the server asks for a second which is longer than the backoff
+	server.InjectFailures("/api/getmeasure", netatmotest.TooManyRequests)
+	policy := testRetryPolicy
+	policy.MaxBackoff = 2 * time.Second
+	source, _ := newTestSource(t, server, policy, time.Hour)
+
+	start := time.Now()
+	if _, err := getMeasure(context.Background(), source); err != nil {
+		t.Fatalf("GetMeasure() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want the requested second", elapsed)
+	}
+	if requests := server.Requests("/api/getmeasure"); requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+}
+
+func TestRetryAfterAboveMaxBackoff(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+	server.InjectFailures("/api/getmeasure", netatmotest.TooManyRequests)
+	source, _ := newTestSource(t, server, testRetryPolicy, time.Hour)
+
+	start := time.Now()
+	if _, err := getMeasure(context.Background(), source); err == nil {
+		t.Fatal("GetMeasure() succeeded, want the rate limiting error")
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("gave up after %s, want right away", elapsed)
+	}
+	if requests := server.Requests("/api/getmeasure"); requests != 1 {
+		t.Errorf("%d requests, want 1", requests)
+	}
+}
+
+func TestRetryRequestTimeout(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+	// the first try hangs, the timeout has to cut it off and leave time for the retry
+	server.InjectFailures("/api/getmeasure", netatmotest.Failure{Delay: 10 * time.Second})
+	policy := testRetryPolicy
+	policy.RequestTimeout = 200 * time.Millisecond
+	source, _ := newTestSource(t, server, policy, time.Hour)
+
+	start := time.Now()
+	if _, err := getMeasure(context.Background(), source); err != nil {
+		t.Fatalf("GetMeasure() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("GetMeasure() took %s, want the first try to time out after 200ms", elapsed)
+	}
+	if requests := server.Requests("/api/getmeasure"); requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+	server.InjectFailures("/api/getmeasure", netatmotest.ServiceUnavailable)
+	policy := testRetryPolicy
+	policy.InitialBackoff, policy.MaxBackoff = 10*time.Second, 10*time.Second
+	source, _ := newTestSource(t, server, policy, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := getMeasure(ctx, source); err == nil {
+		t.Fatal("GetMeasure() succeeded after the context has been cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the backoff went on for %s after the context has been cancelled", elapsed)
+	}
+}
+
+func TestRetryTokenRefresh(t *testing.T) {
+	server := netatmotest.NewServer(nil)
+	defer server.Close()
+	// the refresh is a POST, its form has to be sent again with the retry
+	server.InjectFailures("/oauth2/token", netatmotest.ServiceUnavailable, netatmotest.Dropped)
+	source, store := newTestSource(t, server, testRetryPolicy, -time.Hour)
+
+	if _, err := getMeasure(context.Background(), source); err != nil {
+		t.Fatalf("GetMeasure() error = %v", err)
+	}
+	if requests := server.Requests("/oauth2/token"); requests != 3 {
+		t.Errorf("%d token requests, want 3", requests)
+	}
+	accessToken, refreshToken := server.Tokens()
+	saved, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if saved.AccessToken != accessToken || saved.RefreshToken != refreshToken {
+		t.Errorf("saved token = %s/%s, want %s/%s", saved.AccessToken, saved.RefreshToken, accessToken, refreshToken)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for retry, upper := range []time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		6: time.Second,
+		// the doubling must not overflow for long outages
+		64: time.Second,
+	} {
+		if upper == 0 {
+			continue
+		}
+		for i := 0; i < 100; i++ {
+			if delay := policy.backoff(retry); delay < upper/2 || delay > upper {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", retry, delay, upper/2, upper)
+			}
+		}
+	}
+}
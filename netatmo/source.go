@@ -0,0 +1,56 @@
+package netatmo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/hekmon/go-netatmo/weather"
+	"github.com/pkg/errors"
+)
+
+// DataSource provides the raw stations data used to build the measurements.
+type DataSource interface {
+	GetStationData(ctx context.Context) (weather.StationDataBody, error)
+	// GetMeasure returns temperatures measured by the module (or the base station when
+	// ModuleId is empty) within the given time window ordered by time.
+	GetMeasure(ctx context.Context, module ModuleInfo, since, until time.Time) ([]Sample, error)
+}
+
+// StationDataResponse is the envelope of the getstationsdata API response.
+type StationDataResponse struct {
+	Body   weather.StationDataBody `json:"body"`
+	Status string                  `json:"status"`
+}
+
+// FileSource replays a getstationsdata API response saved in a file.
+type FileSource struct {
+	Path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{Path: path}
+}
+
+func (s *FileSource) GetStationData(ctx context.Context) (weather.StationDataBody, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return weather.StationDataBody{}, errors.Wrap(err, "could not read recorded stations data")
+	}
+
+	var response StationDataResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return weather.StationDataBody{}, errors.Wrap(err, "could not decode recorded stations data")
+	}
+	if response.Status != "ok" {
+		return weather.StationDataBody{}, errors.Errorf("recorded response has status %q", response.Status)
+	}
+
+	return response.Body, nil
+}
+
+// GetMeasure returns no samples as the recorded response does not contain any history.
+func (s *FileSource) GetMeasure(ctx context.Context, module ModuleInfo, since, until time.Time) ([]Sample, error) {
+	return nil, nil
+}
@@ -0,0 +1,9 @@
+// Package resources embeds the static assets shipped with the app.
+package resources
+
+import "embed"
+
+// WeatherIcons holds the SVG weather icons stored as weather_icons/<condition>.svg
+//
+//go:embed weather_icons/*.svg
+var WeatherIcons embed.FS
@@ -0,0 +1,169 @@
+// Package tokenstore keeps the OAuth tokens apart from the rest of the configuration.
+package tokenstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// DefaultPath is where the tokens are kept when no other file is configured
+const DefaultPath = "/var/lib/weather-pie/token.json"
+
+// ErrNotFound is returned by Load when no token has been stored yet
+var ErrNotFound = errors.New("no stored token")
+
+// Store persists OAuth tokens rotated by the API client.
+type Store interface {
+	// Load returns the stored token or ErrNotFound
+	Load() (*oauth2.Token, error)
+	Save(token *oauth2.Token) error
+	// Update passes the stored token (nil when there is none yet) to update and saves the
+	// token it returns unless it is the same one. Nobody else can rotate the token meanwhile.
+	Update(update func(stored *oauth2.Token) (*oauth2.Token, error)) (*oauth2.Token, error)
+}
+
+// FileStore keeps the token in a JSON file readable only by its owner. The file is replaced
+// atomically and concurrent access (e.g. a cron run overlapping with the login command) is
+// serialized with a lock file next to it.
+type FileStore struct {
+	path string
+	lock *flock.Flock
+	// mu serializes the goroutines sharing the store, the file lock does not
+	// exclude them as they hold it through the same file descriptor
+	mu sync.Mutex
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path, lock: flock.New(path + ".lock")}
+}
+
+func (s *FileStore) Path() string {
+	return s.path
+}
+
+func (s *FileStore) Load() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.lock.RLock(); err != nil {
+		// the lock file cannot be created before the directory is
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "could not lock %s", s.path)
+	}
+	defer s.lock.Unlock()
+
+	return s.load()
+}
+
+func (s *FileStore) Save(token *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.lockExclusive(); err != nil {
+		return err
+	}
+	defer s.lock.Unlock()
+
+	return s.save(token)
+}
+
+func (s *FileStore) Update(update func(stored *oauth2.Token) (*oauth2.Token, error)) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.lockExclusive(); err != nil {
+		return nil, err
+	}
+	defer s.lock.Unlock()
+
+	stored, err := s.load()
+	if errors.Is(err, ErrNotFound) {
+		stored, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	token, err := update(stored)
+	if err != nil {
+		return nil, err
+	}
+	if token == stored {
+		return token, nil
+	}
+
+	return token, s.save(token)
+}
+
+// lockExclusive creates the directory of the token file so the lock file can be created in it
+func (s *FileStore) lockExclusive() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return errors.Wrap(err, "could not create token directory")
+	}
+	if err := s.lock.Lock(); err != nil {
+		return errors.Wrapf(err, "could not lock %s", s.path)
+	}
+
+	return nil
+}
+
+func (s *FileStore) load() (*oauth2.Token, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read token file")
+	}
+	var token oauth2.Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, errors.Wrapf(err, "could not decode token file %s", s.path)
+	}
+
+	return &token, nil
+}
+
+// save replaces the token file, the caller holds the lock
+func (s *FileStore) save(token *oauth2.Token) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not encode token")
+	}
+
+	dir := filepath.Dir(s.path)
+	// the temporary file is created with 0600 permissions in the same directory
+	// so it can be renamed over the old one
+	tmp, err := ioutil.TempFile(dir, filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "could not create temporary token file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "could not write token file")
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "could not sync token file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "could not close token file")
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return errors.Wrap(err, "could not replace token file")
+	}
+
+	// make the rename durable, failure only means it might be lost on power loss
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+
+	return nil
+}
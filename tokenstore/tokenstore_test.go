@@ -0,0 +1,210 @@
+package tokenstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+func testToken(n int) *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  fmt.Sprintf("access-%d", n),
+		RefreshToken: fmt.Sprintf("refresh-%d", n),
+		TokenType:    "Bearer",
+		Expiry:       time.Date(2024, time.March, 5, 12, n, 0, 0, time.UTC),
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "token.json")
+	s := NewFileStore(path)
+
+	if _, err := s.Load(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Load() error = %v, want ErrNotFound", err)
+	}
+	if err := s.Save(testToken(1)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	token, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if token.AccessToken != "access-1" || token.RefreshToken != "refresh-1" || !token.Expiry.Equal(testToken(1).Expiry) {
+		t.Errorf("Load() = %+v, want %+v", token, testToken(1))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("token file permissions = %o, want 600", perm)
+	}
+	info, err = os.Stat(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("token directory permissions = %o, want 700", perm)
+	}
+}
+
+func TestFileStoreInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	if err := ioutil.WriteFile(path, []byte(`{"access_token": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileStore(path).Load(); err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "could not decode token file") {
+		t.Errorf("Load() error = %v, want a decoding error", err)
+	}
+}
+
+func TestFileStoreAtomicReplace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token.json")
+	s := NewFileStore(path)
+	if err := s.Save(testToken(0)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// readers not taking the lock never see a partially written file
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Errorf("could not read token file: %v", err)
+				return
+			}
+			var token oauth2.Token
+			if err := json.Unmarshal(data, &token); err != nil {
+				t.Errorf("partial token file %q: %v", data, err)
+				return
+			}
+		}
+	}()
+	for i := 1; i <= 200; i++ {
+		if err := s.Save(testToken(i % 60)); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	checkNoTemporaryFiles(t, dir)
+}
+
+func TestFileStoreConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token.json")
+
+	// the stores lock the file separately like different processes would
+	var wg sync.WaitGroup
+	for i := 1; i <= 2; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			s := NewFileStore(path)
+			for j := 0; j < 50; j++ {
+				if err := s.Save(testToken(n)); err != nil {
+					t.Errorf("Save() error = %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	token, err := NewFileStore(path).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if token.AccessToken != "access-1" && token.AccessToken != "access-2" {
+		t.Errorf("Load() = %+v, want one of the saved tokens", token)
+	}
+	checkNoTemporaryFiles(t, dir)
+}
+
+func TestFileStoreUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	s := NewFileStore(path)
+
+	// the first update starts without a stored token
+	token, err := s.Update(func(stored *oauth2.Token) (*oauth2.Token, error) {
+		if stored != nil {
+			t.Errorf("stored token = %+v, want none", stored)
+		}
+		return testToken(0), nil
+	})
+	if err != nil || token.AccessToken != "access-0" {
+		t.Fatalf("Update() = %+v, %v", token, err)
+	}
+
+	// concurrent updates see each other's tokens so none of them is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := NewFileStore(path)
+			for j := 0; j < 10; j++ {
+				_, err := s.Update(func(stored *oauth2.Token) (*oauth2.Token, error) {
+					var n int
+					if _, err := fmt.Sscanf(stored.AccessToken, "access-%d", &n); err != nil {
+						return nil, err
+					}
+					return testToken(n + 1), nil
+				})
+				if err != nil {
+					t.Errorf("Update() error = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	token, err = s.Load()
+	if err != nil || token.AccessToken != "access-40" {
+		t.Errorf("Load() = %+v, %v, want access-40", token, err)
+	}
+
+	// a failed update keeps the stored token
+	if _, err := s.Update(func(*oauth2.Token) (*oauth2.Token, error) { return nil, errors.New("refresh failed") }); err == nil {
+		t.Error("Update() succeeded although the update failed")
+	}
+	if token, err := s.Load(); err != nil || token.AccessToken != "access-40" {
+		t.Errorf("Load() after the failed update = %+v, %v", token, err)
+	}
+}
+
+func checkNoTemporaryFiles(t *testing.T, dir string) {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".tmp") {
+			t.Errorf("temporary file %s has been left behind", file.Name())
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package ui
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"weather-pi/netatmo"
+)
+
+// element is a widget bound to a reading. Elements measure themselves so the containers
+// can place them one after another.
+type element interface {
+	// size is the space the element needs, zero width or height fills the space it is given
+	size() image.Point
+	draw(box image.Rectangle) error
+}
+
+// textElement is a single line of text aligned within its box, shrunk down to minSize
+// and ellipsized when it is wider than the box.
+type textElement struct {
+	canvas
+	plane    Plane
+	role     TextRole
+	text     string
+	fontSize float64
+	minSize  float64
+	align    Align
+}
+
+func (e *textElement) size() image.Point {
+	height := e.fonts.height(e.role, e.fontSize)
+	if e.align == AlignCenter || e.align == AlignRight {
+		return image.Pt(0, height)
+	}
+
+	return image.Pt(e.fonts.width(e.role, e.fontSize, e.text), height)
+}
+
+func (e *textElement) draw(box image.Rectangle) error {
+	drawText(e.pens[e.plane], e.role, box, e.fontSize, e.minSize, e.align, e.text)
+	return nil
+}
+
+// splitUnit splits a formatted value like "-12.3°C" into the number and the unit.
+func splitUnit(value string) (number, unit string) {
+	i := strings.LastIndexAny(value, "0123456789")
+	if i < 0 {
+		return value, ""
+	}
+
+	return value[:i+1], value[i+1:]
+}
+
+// bigNumberElement draws the number with the unit at half the size next to its top. Both
+// are shrunk down to minSize when they are wider than the box.
+type bigNumberElement struct {
+	canvas
+	plane    Plane
+	role     TextRole
+	number   string
+	unit     string
+	fontSize float64
+	minSize  float64
+}
+
+func (e *bigNumberElement) width(size float64) int {
+	width := e.fonts.width(e.role, size, e.number)
+	if e.unit != "" {
+		width += 1 + e.fonts.width(e.role, size/2, e.unit)
+	}
+
+	return width
+}
+
+func (e *bigNumberElement) size() image.Point {
+	return image.Pt(e.width(e.fontSize), e.fonts.height(e.role, e.fontSize))
+}
+
+func (e *bigNumberElement) draw(box image.Rectangle) error {
+	p := e.pens[e.plane]
+	size := fitSize(e.fontSize, e.minSize, box.Dx(), e.width)
+	// the shrunk number keeps the baseline of the full size
+	top := box.Min.Y + p.baseline(e.role, e.fontSize) - p.baseline(e.role, size)
+	p.drawString(e.role, size, box.Min.X, top, e.number)
+	if e.unit == "" {
+		return nil
+	}
+	// the top of the unit is aligned with the top of the digits
+	x := box.Min.X + p.width(e.role, size, e.number) + 1
+	y := top + int((size-size/2)*p.dpi/72*0.3)
+	p.drawString(e.role, size/2, x, y, e.unit)
+
+	return nil
+}
+
+// labelledElement draws the label followed by the value sharing the baseline.
+type labelledElement struct {
+	canvas
+	plane     Plane
+	role      TextRole
+	label     string
+	value     string
+	fontSize  float64
+	minSize   float64
+	labelSize float64
+}
+
+func (e *labelledElement) size() image.Point {
+	width := e.fonts.width(LabelText, e.labelSize, e.label) + 2 + e.fonts.width(e.role, e.fontSize, e.value)
+
+	return image.Pt(width, e.fonts.height(e.role, e.fontSize))
+}
+
+func (e *labelledElement) draw(box image.Rectangle) error {
+	baseline := e.fonts.baseline(e.role, e.fontSize)
+	e.pens[BlackPlane].drawString(LabelText, e.labelSize, box.Min.X, box.Min.Y+baseline-e.fonts.baseline(LabelText, e.labelSize), e.label)
+	value := box
+	value.Min.X += e.fonts.width(LabelText, e.labelSize, e.label) + 2
+	drawText(e.pens[e.plane], e.role, value, e.fontSize, e.minSize, AlignLeft, e.value)
+
+	return nil
+}
+
+// minMaxElement draws the range of the reading in two columns with the labels above the values.
+type minMaxElement struct {
+	canvas
+	plane     Plane
+	role      TextRole
+	values    paneValues
+	fontSize  float64
+	minSize   float64
+	labelSize float64
+}
+
+const minMaxGap = 4
+
+func (e *minMaxElement) columnWidth(label, value string) int {
+	width := e.fonts.width(LabelText, e.labelSize, label)
+	if valueWidth := e.fonts.width(e.role, e.fontSize, value); valueWidth > width {
+		width = valueWidth
+	}
+
+	return width
+}
+
+func (e *minMaxElement) size() image.Point {
+	width := e.columnWidth(e.values.leftLabel, e.values.left) + minMaxGap + e.columnWidth(e.values.rightLabel, e.values.right)
+
+	return image.Pt(width, e.fonts.height(LabelText, e.labelSize)+e.fonts.height(e.role, e.fontSize))
+}
+
+func (e *minMaxElement) draw(box image.Rectangle) error {
+	// the columns are spread over the box when it is wider than needed and share it
+	// equally when it is too narrow
+	right := box.Min.X + box.Dx()/2
+	if min := box.Min.X + e.columnWidth(e.values.leftLabel, e.values.left) + minMaxGap; right < min && e.size().X <= box.Dx() {
+		right = min
+	}
+	valueY := box.Min.Y + e.fonts.height(LabelText, e.labelSize)
+	for _, column := range []struct {
+		box          image.Rectangle
+		label, value string
+	}{
+		{image.Rect(box.Min.X, box.Min.Y, right-minMaxGap, box.Max.Y), e.values.leftLabel, e.values.left},
+		{image.Rect(right, box.Min.Y, box.Max.X, box.Max.Y), e.values.rightLabel, e.values.right},
+	} {
+		drawText(e.pens[BlackPlane], LabelText, column.box, e.labelSize, e.labelSize, AlignLeft, column.label)
+		column.box.Min.Y = valueY
+		drawText(e.pens[e.plane], e.role, column.box, e.fontSize, e.minSize, AlignLeft, column.value)
+	}
+
+	return nil
+}
+
+// gaugeElement draws an outline filled according to the percentage, with a nub on the right
+// side it is a battery.
+type gaugeElement struct {
+	dst     draw.Image
+	percent int64
+	fixed   image.Point
+	nub     bool
+}
+
+func (e *gaugeElement) size() image.Point {
+	return e.fixed
+}
+
+func (e *gaugeElement) draw(box image.Rectangle) error {
+	body := box
+	if e.nub {
+		body.Max.X -= 2
+		nub := image.Rect(body.Max.X, body.Min.Y+body.Dy()/4, box.Max.X, body.Max.Y-body.Dy()/4)
+		draw.Draw(e.dst, nub, image.Black, image.Point{}, draw.Src)
+	}
+	drawOutline(e.dst, body)
+
+	percent := e.percent
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	inner := body.Inset(2)
+	inner.Max.X = inner.Min.X + int(int64(inner.Dx())*percent/100)
+	draw.Draw(e.dst, inner, image.Black, image.Point{}, draw.Src)
+
+	return nil
+}
+
+// drawOutline draws a 1px border along the inner edge of the rectangle.
+func drawOutline(dst draw.Image, rect image.Rectangle) {
+	if rect.Empty() {
+		return
+	}
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		dst.Set(x, rect.Min.Y, color.Black)
+		dst.Set(x, rect.Max.Y-1, color.Black)
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		dst.Set(rect.Min.X, y, color.Black)
+		dst.Set(rect.Max.X-1, y, color.Black)
+	}
+}
+
+// trendElement draws a filled triangle pointing up, down or to the right for a stable trend.
+type trendElement struct {
+	dst   draw.Image
+	trend netatmo.Trend
+	fixed image.Point
+}
+
+func (e *trendElement) size() image.Point {
+	return e.fixed
+}
+
+func (e *trendElement) draw(box image.Rectangle) error {
+	w, h := box.Dx(), box.Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var inside bool
+			switch e.trend {
+			case "up":
+				// the triangle widens towards the bottom
+				inside = abs(2*x-(w-1))*(h-1) <= (w-1)*y
+			case "down":
+				inside = abs(2*x-(w-1))*(h-1) <= (w-1)*(h-1-y)
+			default:
+				inside = abs(2*y-(h-1))*(w-1) <= (h-1)*(w-1-x)
+			}
+			if inside {
+				e.dst.Set(box.Min.X+x, box.Min.Y+y, color.Black)
+			}
+		}
+	}
+
+	return nil
+}
+
+type iconElement struct {
+	dst  draw.Image
+	icon *image.Paletted
+}
+
+func (e *iconElement) size() image.Point {
+	return e.icon.Bounds().Size()
+}
+
+func (e *iconElement) draw(box image.Rectangle) error {
+	drawIcon(e.dst, e.icon, box.Min)
+	return nil
+}
+
+type sparklineElement struct {
+	dst     draw.Image
+	samples []netatmo.Sample
+}
+
+func (e *sparklineElement) size() image.Point {
+	return image.Point{}
+}
+
+func (e *sparklineElement) draw(box image.Rectangle) error {
+	drawSparkline(e.dst, box, e.samples)
+	return nil
+}
+
+// dividerElement is a line across the box, a vertical one in rows.
+type dividerElement struct {
+	dst      draw.Image
+	vertical bool
+}
+
+func (e *dividerElement) size() image.Point {
+	if e.vertical {
+		return image.Pt(1, 0)
+	}
+
+	return image.Pt(0, 1)
+}
+
+func (e *dividerElement) draw(box image.Rectangle) error {
+	draw.Draw(e.dst, box, image.Black, image.Point{}, draw.Src)
+	return nil
+}
+
+// stackElement places its children next to each other in a row or below each other in a column.
+// Children which fill the space share what is left after the measured ones.
+type stackElement struct {
+	dst        draw.Image
+	children   []element
+	horizontal bool
+	gap        int
+	// border draws the outline of the box around the children
+	border  bool
+	padding int
+}
+
+// along returns the coordinate in the direction of the stack and across it
+func (e *stackElement) along(p image.Point) (int, int) {
+	if e.horizontal {
+		return p.X, p.Y
+	}
+
+	return p.Y, p.X
+}
+
+func (e *stackElement) point(along, across int) image.Point {
+	if e.horizontal {
+		return image.Pt(along, across)
+	}
+
+	return image.Pt(across, along)
+}
+
+func (e *stackElement) size() image.Point {
+	total, largest := 0, 0
+	for i, child := range e.children {
+		along, across := e.along(child.size())
+		total += along
+		if i > 0 {
+			total += e.gap
+		}
+		if across > largest {
+			largest = across
+		}
+	}
+
+	return e.point(total, largest).Add(image.Pt(2*e.padding, 2*e.padding))
+}
+
+func (e *stackElement) draw(box image.Rectangle) error {
+	if e.border {
+		drawOutline(e.dst, box)
+	}
+	inner := box.Inset(e.padding)
+	space, across := e.along(inner.Size())
+
+	fills := 0
+	for i, child := range e.children {
+		along, _ := e.along(child.size())
+		if along == 0 {
+			fills++
+		}
+		space -= along
+		if i > 0 {
+			space -= e.gap
+		}
+	}
+
+	position, _ := e.along(inner.Min)
+	_, start := e.along(inner.Min)
+	for _, child := range e.children {
+		along, childAcross := e.along(child.size())
+		if along == 0 && fills > 0 {
+			along = space / fills
+		}
+		if childAcross == 0 {
+			childAcross = across
+		}
+		min := e.point(position, start)
+		// children which do not fit are cut to the box of the container
+		if box := (image.Rectangle{Min: min, Max: min.Add(e.point(along, childAcross))}).Intersect(inner); !box.Empty() {
+			if err := child.draw(box); err != nil {
+				return err
+			}
+		}
+		position += along + e.gap
+	}
+
+	return nil
+}
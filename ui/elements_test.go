@@ -0,0 +1,149 @@
+package ui
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+	"weather-pi/forecast"
+	"weather-pi/netatmo"
+)
+
+var update = flag.Bool("update", false, "update the golden images in testdata")
+
+// testTime is the time of the test reading and the clock
+var testTime = time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+
+func testReading() netatmo.Reading {
+	battery := int64(73)
+	history := make([]netatmo.Sample, 12)
+	for i := range history {
+		history[i] = netatmo.Sample{Time: testTime.Add(time.Duration(i-len(history)) * time.Hour), Value: float64(12 + i%5)}
+	}
+
+	return netatmo.Reading{
+		Name:        "Garden",
+		Type:        netatmo.OutdoorModule,
+		Timestamp:   testTime.Add(-3 * time.Minute),
+		Temperature: 21.4,
+		MinTemp:     12.3,
+		MaxTemp:     24.8,
+		Humidity:    56,
+		TempTrend:   "up",
+		Status:      netatmo.Status{Reachable: true, Battery: &battery},
+		History:     history,
+	}
+}
+
+func TestElements(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		widget Widget
+		size   image.Point
+	}{
+		{"bignumber", Widget{Type: BigNumberWidget, Size: mainFontSize}, image.Pt(80, 30)},
+		{"bignumber-shrunk", Widget{Type: BigNumberWidget, Size: mainFontSize}, image.Pt(40, 30)},
+		{"labelled", Widget{Type: LabelledWidget, Field: HumidityField, Size: secondaryFontSize}, image.Pt(60, 20)},
+		{"minmax", Widget{Type: MinMaxWidget}, image.Pt(80, 24)},
+		{"humiditybar", Widget{Type: HumidityBarWidget, Y: Pixels(2)}, image.Pt(50, 10)},
+		{"battery", Widget{Type: BatteryWidget, X: Pixels(2), Y: Pixels(2), Width: Pixels(20), Height: Pixels(10)}, image.Pt(30, 14)},
+		{"trend", Widget{Type: TrendWidget, X: Pixels(1), Y: Pixels(2)}, image.Pt(10, 10)},
+		{"clock", Widget{Type: ClockWidget, Size: secondaryFontSize, Format: "Mon 15:04"}, image.Pt(60, 20)},
+		{"clock-reading", Widget{Type: ClockWidget, Field: TimeField, Size: secondaryFontSize}, image.Pt(60, 20)},
+		{"icon", Widget{Type: IconWidget, Icon: string(forecast.Rain), Width: Pixels(24)}, image.Pt(26, 26)},
+		{"icon-forecast", Widget{Type: IconWidget, Field: ForecastField}, image.Pt(16, 16)},
+		{"box", Widget{Type: BoxWidget, Children: []Widget{
+			{Type: ValueWidget, Field: NameField, Size: statusFontSize},
+			{Type: BigNumberWidget, Size: secondaryFontSize},
+		}}, image.Pt(60, 40)},
+		{"row", Widget{Type: RowWidget, Gap: 2, Children: []Widget{
+			{Type: BigNumberWidget, Size: secondaryFontSize},
+			{Type: TrendWidget},
+			{Type: DividerWidget},
+			{Type: BatteryWidget},
+		}}, image.Pt(80, 20)},
+		{"column", Widget{Type: ColumnWidget, Width: Pixels(50), Height: Pixels(48), Children: []Widget{
+			{Type: LabelledWidget, Field: HumidityField},
+			{Type: HumidityBarWidget},
+			{Type: DividerWidget},
+			{Type: SparklineWidget},
+		}}, image.Pt(60, 50)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			img := renderWidget(t, tt.widget, tt.size)
+			compareGolden(t, img, filepath.Join("testdata", tt.name+".png"))
+		})
+	}
+}
+
+// renderWidget draws the widget bound to the test reading in an image of the given size,
+// both planes are drawn onto the same image.
+func renderWidget(t *testing.T, widget Widget, size image.Point) *image.Paletted {
+	t.Helper()
+	fonts, err := newFontSet(Fonts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewPaletted(image.Rectangle{Max: size}, color.Palette{color.White, color.Black})
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	p := newPen(fonts, img)
+	c := canvas{
+		fonts:  fonts,
+		pens:   map[Plane]*pen{BlackPlane: p, RedPlane: p},
+		images: map[Plane]draw.Image{BlackPlane: img, RedPlane: img},
+		days:   []forecast.Day{{Date: testTime, Condition: forecast.Sunny}},
+		now:    testTime,
+	}
+	if err := drawWidgets(c, img.Bounds(), testReading(), []Widget{widget}); err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+// compareGolden compares the image with the golden one pixel for pixel, -update writes
+// the image as the golden one instead.
+func compareGolden(t *testing.T, img *image.Paletted, path string) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run the tests with -update to create it)", err)
+	}
+	golden, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if golden.Bounds() != img.Bounds() {
+		t.Fatalf("image size %v, golden %v", img.Bounds().Size(), golden.Bounds().Size())
+	}
+	diff := 0
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			r1, g1, b1, _ := img.At(x, y).RGBA()
+			r2, g2, b2, _ := golden.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 {
+				diff++
+			}
+		}
+	}
+	if diff > 0 {
+		t.Errorf("%d pixels differ from %s (run the tests with -update if the change is intended)", diff, path)
+	}
+}
@@ -0,0 +1,260 @@
+package ui
+
+import (
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"weather-pi/bitmapfont"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/pkg/errors"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// TextRole is the kind of text a font is selected for.
+type TextRole string
+
+const (
+	// ValueText is used for the measured values
+	ValueText TextRole = "value"
+	// LabelText is used for the labels and the names of the modules
+	LabelText TextRole = "label"
+	// StatusText is used for the status line, the header and the tags
+	StatusText TextRole = "status"
+)
+
+// DefaultFont is used for the text roles without a font
+const DefaultFont = "goregular"
+
+// embeddedFonts are the Go fonts which can be selected by name
+var embeddedFonts = map[string][]byte{
+	"goregular":  goregular.TTF,
+	"gomedium":   gomedium.TTF,
+	"gobold":     gobold.TTF,
+	"goitalic":   goitalic.TTF,
+	"gomono":     gomono.TTF,
+	"gomonobold": gomonobold.TTF,
+}
+
+// EmbeddedFonts returns the names of the fonts built into the binary.
+func EmbeddedFonts() []string {
+	names := make([]string, 0, len(embeddedFonts))
+	for name := range embeddedFonts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Fonts selects the font of every text role, either the name of an embedded font or the path
+// of a TTF, OTF, BDF or PCF file. Roles without a font use DefaultFont.
+type Fonts struct {
+	Value  string
+	Label  string
+	Status string
+	// DPI converts the font sizes in points to pixels, the resolution of the 2.13" display when zero
+	DPI float64
+}
+
+// typeface is a parsed font which the faces of every size are created from.
+type typeface interface {
+	face(size, dpi float64) font.Face
+	// baseline is the distance from the top of a line to its baseline in pixels
+	baseline(size, dpi float64) int
+}
+
+type trueTypeFont struct {
+	*truetype.Font
+}
+
+func (f trueTypeFont) face(size, dpi float64) font.Face {
+	return truetype.NewFace(f.Font, &truetype.Options{Size: size, DPI: dpi, Hinting: font.HintingFull})
+}
+
+func (f trueTypeFont) baseline(size, dpi float64) int {
+	return int(size * dpi / 72)
+}
+
+type openTypeFont struct {
+	*opentype.Font
+}
+
+func (f openTypeFont) face(size, dpi float64) font.Face {
+	// NewFace only keeps the options, it does not fail
+	face, _ := opentype.NewFace(f.Font, &opentype.FaceOptions{Size: size, DPI: dpi, Hinting: font.HintingFull})
+	return face
+}
+
+func (f openTypeFont) baseline(size, dpi float64) int {
+	return int(size * dpi / 72)
+}
+
+// bitmapFont has a single size, the font sizes of the layout are ignored so the glyphs are
+// drawn pixel for pixel
+type bitmapFont struct {
+	*bitmapfont.Face
+}
+
+func (f bitmapFont) face(size, dpi float64) font.Face {
+	return f.Face
+}
+
+func (f bitmapFont) baseline(size, dpi float64) int {
+	return f.Ascent()
+}
+
+// fontCache keeps the parsed fonts so the daemon parses them once rather than on every refresh
+var fontCache = struct {
+	sync.Mutex
+	fonts map[string]typeface
+}{fonts: map[string]typeface{}}
+
+// loadFont returns the embedded font of the given name or the font read from the file.
+// Parsed fonts are cached.
+func loadFont(name string) (typeface, error) {
+	if name == "" {
+		name = DefaultFont
+	}
+	fontCache.Lock()
+	defer fontCache.Unlock()
+	if f, ok := fontCache.fonts[name]; ok {
+		return f, nil
+	}
+
+	data, ok := embeddedFonts[name]
+	if !ok {
+		var err error
+		if data, err = ioutil.ReadFile(name); err != nil {
+			return nil, errors.Wrap(err, "could not read font file")
+		}
+	}
+	f, err := parseFont(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse font %s", name)
+	}
+	fontCache.fonts[name] = f
+
+	return f, nil
+}
+
+// parseFont reads the bitmap fonts and parses TrueType fonts with freetype, which hints them
+// best at the small sizes of the display, falling back to OpenType for the CFF outlines.
+func parseFont(data []byte) (typeface, error) {
+	f, err := bitmapfont.Parse(data)
+	if err == nil {
+		return bitmapFont{f}, nil
+	}
+	if err != bitmapfont.ErrUnknownFormat {
+		return nil, err
+	}
+	if f, err := truetype.Parse(data); err == nil {
+		return trueTypeFont{f}, nil
+	}
+	otf, err := opentype.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return openTypeFont{otf}, nil
+}
+
+// fontSet holds the fonts of the text roles for a render and caches their faces by size.
+type fontSet struct {
+	fonts map[TextRole]typeface
+	dpi   float64
+	faces map[faceKey]font.Face
+}
+
+type faceKey struct {
+	role TextRole
+	size float64
+}
+
+func newFontSet(opts Fonts) (*fontSet, error) {
+	set := &fontSet{fonts: map[TextRole]typeface{}, dpi: opts.DPI, faces: map[faceKey]font.Face{}}
+	if set.dpi <= 0 {
+		set.dpi = deviceDPI
+	}
+	for role, name := range map[TextRole]string{ValueText: opts.Value, LabelText: opts.Label, StatusText: opts.Status} {
+		f, err := loadFont(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not load %s font", role)
+		}
+		set.fonts[role] = f
+	}
+
+	return set, nil
+}
+
+func (s *fontSet) face(role TextRole, size float64) font.Face {
+	key := faceKey{role: role, size: size}
+	if face, ok := s.faces[key]; ok {
+		return face
+	}
+	face := s.fonts[role].face(size, s.dpi)
+	s.faces[key] = face
+
+	return face
+}
+
+// width returns the width of the text in pixels.
+func (s *fontSet) width(role TextRole, size float64, text string) int {
+	return font.MeasureString(s.face(role, size), text).Ceil()
+}
+
+// baseline returns the distance from the top of the text to its baseline.
+func (s *fontSet) baseline(role TextRole, size float64) int {
+	return s.fonts[role].baseline(size, s.dpi)
+}
+
+// height returns the height of a line of text, descenders included.
+func (s *fontSet) height(role TextRole, size float64) int {
+	return s.baseline(role, size) + s.face(role, size).Metrics().Descent.Ceil()
+}
+
+// pen draws the text onto a plane, clipped to a rectangle of it.
+type pen struct {
+	*fontSet
+	dst  draw.Image
+	clip image.Rectangle
+}
+
+func newPen(fonts *fontSet, dst draw.Image) *pen {
+	return &pen{fontSet: fonts, dst: dst, clip: dst.Bounds()}
+}
+
+func (p *pen) setClip(clip image.Rectangle) {
+	p.clip = clip
+}
+
+// drawString draws the text with its top at the given y coordinate.
+func (p *pen) drawString(role TextRole, size float64, x, y int, text string) {
+	d := font.Drawer{
+		Dst:  clippedImage{Image: p.dst, clip: p.clip},
+		Src:  image.Black,
+		Face: p.face(role, size),
+		Dot:  fixed.P(x, y+p.baseline(role, size)),
+	}
+	d.DrawString(text)
+}
+
+// clippedImage limits the drawing to the clip rectangle of the image.
+type clippedImage struct {
+	draw.Image
+	clip image.Rectangle
+}
+
+func (c clippedImage) Bounds() image.Rectangle {
+	return c.Image.Bounds().Intersect(c.clip)
+}
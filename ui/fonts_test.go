@@ -0,0 +1,114 @@
+package ui
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gomono"
+)
+
+func TestLoadFont(t *testing.T) {
+	dir := t.TempDir()
+	ttf := filepath.Join(dir, "gomono.ttf")
+	if err := ioutil.WriteFile(ttf, gomono.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.ttf")
+	if err := ioutil.WriteFile(invalid, []byte("not a font"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		want string
+		err  string
+	}{
+		{name: "", want: "ui.trueTypeFont"},
+		{name: "gobold", want: "ui.trueTypeFont"},
+		{name: ttf, want: "ui.trueTypeFont"},
+		// CFFTest.otf from golang.org/x/image has CFF outlines which only the OpenType parser reads
+		{name: filepath.Join("testdata", "CFFTest.otf"), want: "ui.openTypeFont"},
+		{name: filepath.Join("..", "bitmapfont", "testdata", "7x13.bdf"), want: "ui.bitmapFont"},
+		{name: filepath.Join(dir, "missing.ttf"), err: "could not read font file"},
+		{name: "gothic", err: "could not read font file"},
+		{name: invalid, err: "could not parse font"},
+	} {
+		t.Run(filepath.Base(tt.name), func(t *testing.T) {
+			f, err := loadFont(tt.name)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("loadFont() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadFont() error = %v", err)
+			}
+			if got := fmt.Sprintf("%T", f); got != tt.want {
+				t.Errorf("loadFont() = %s, want %s", got, tt.want)
+			}
+			if face := f.face(12, deviceDPI); face == nil {
+				t.Error("no face of the font")
+			} else if _, ok := face.GlyphAdvance('1'); !ok {
+				t.Error("the font has no glyph for 1")
+			}
+		})
+	}
+}
+
+func TestLoadFontCached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gomono.ttf")
+	if err := ioutil.WriteFile(path, gomono.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	first, err := loadFont(path)
+	if err != nil {
+		t.Fatalf("loadFont() error = %v", err)
+	}
+
+	// the font is parsed once, the file is not read again
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	second, err := loadFont(path)
+	if err != nil {
+		t.Fatalf("loadFont() of the cached font error = %v", err)
+	}
+	if first.(trueTypeFont).Font != second.(trueTypeFont).Font {
+		t.Error("the font has been parsed again")
+	}
+}
+
+func TestFontSetDPI(t *testing.T) {
+	for _, tt := range []struct {
+		dpi  float64
+		want float64
+	}{
+		{dpi: 0, want: deviceDPI},
+		{dpi: -1, want: deviceDPI},
+		{dpi: 220, want: 220},
+	} {
+		fonts, err := newFontSet(Fonts{DPI: tt.dpi})
+		if err != nil {
+			t.Fatalf("newFontSet() error = %v", err)
+		}
+		if fonts.dpi != tt.want {
+			t.Errorf("DPI %v is used as %v, want %v", tt.dpi, fonts.dpi, tt.want)
+		}
+		// the size in points is converted to pixels with the resolution
+		if baseline, want := fonts.baseline(ValueText, 18), int(18*tt.want/72); baseline != want {
+			t.Errorf("baseline at %v DPI = %d, want %d", tt.want, baseline, want)
+		}
+	}
+}
+
+func TestNewFontSetErrors(t *testing.T) {
+	_, err := newFontSet(Fonts{Label: filepath.Join(t.TempDir(), "missing.otf")})
+	if err == nil || !strings.Contains(err.Error(), "could not load label font") {
+		t.Errorf("newFontSet() error = %v, want the label font", err)
+	}
+}
@@ -0,0 +1,74 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+	"weather-pi/forecast"
+	"weather-pi/resources"
+
+	"github.com/pkg/errors"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// forecastIconSize is the size of the forecast icons drawn in the status line
+const forecastIconSize = 14
+
+var iconCache = struct {
+	sync.Mutex
+	icons map[string]*image.Paletted
+}{icons: map[string]*image.Paletted{}}
+
+// WeatherIcon returns the icon of the given condition rasterized to a 1-bit image of the given size.
+// Rasterized icons are cached.
+func WeatherIcon(condition forecast.Condition, size int) (*image.Paletted, error) {
+	key := fmt.Sprintf("%s@%d", condition, size)
+	iconCache.Lock()
+	defer iconCache.Unlock()
+	if icon, ok := iconCache.icons[key]; ok {
+		return icon, nil
+	}
+
+	file, err := resources.WeatherIcons.Open("weather_icons/" + string(condition) + ".svg")
+	if err != nil {
+		return nil, errors.Wrapf(err, "no icon for %q condition", condition)
+	}
+	defer file.Close()
+
+	svg, err := oksvg.ReadIconStream(file, oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse %q icon", condition)
+	}
+	svg.SetTarget(0, 0, float64(size), float64(size))
+	rgba := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+	svg.Draw(rasterx.NewDasher(size, size, rasterx.NewScannerGV(size, size, rgba, rgba.Bounds())), 1)
+
+	icon := image.NewPaletted(rgba.Bounds(), color.Palette{color.White, color.Black})
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			// the icons contain a light helper grid which disappears with the threshold
+			if color.GrayModel.Convert(rgba.At(x, y)).(color.Gray).Y < 128 {
+				icon.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	iconCache.icons[key] = icon
+
+	return icon, nil
+}
+
+// drawIcon copies black pixels of the icon onto the destination image.
+func drawIcon(dst draw.Image, icon *image.Paletted, at image.Point) {
+	bounds := icon.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if icon.ColorIndexAt(x, y) == 1 {
+				dst.Set(at.X+x-bounds.Min.X, at.Y+y-bounds.Min.Y, color.Black)
+			}
+		}
+	}
+}
@@ -6,14 +6,12 @@ import (
 	"image/color"
 	"image/draw"
 	"time"
+	"weather-pi/forecast"
 	"weather-pi/netatmo"
 
 	"github.com/pkg/errors"
 
-	"github.com/golang/freetype"
 	"go.uber.org/zap"
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/gofont/goregular"
 )
 
 const deviceDPI = 110
@@ -22,153 +20,359 @@ const secondaryFontSize = 12
 const tertiaryFontSize = 8
 const statusFontSize = 7
 
-func BuildGUI(logger *zap.SugaredLogger, bounds image.Rectangle, measurement []netatmo.Measurement) (blackImg draw.Image, redImg draw.Image, err error) {
-	if len(measurement) != 1 || len(measurement[0].ModuleReadings) == 0 {
+// DefaultPanesPerPage is the number of readings which fit side by side on the 2.13" display
+const DefaultPanesPerPage = 2
+
+// Options controls how the readings are laid out on the screen.
+type Options struct {
+	// PanesPerPage is the maximum number of readings of a station shown at once (the grid layout
+	// has a fixed number of columns)
+	PanesPerPage int
+	// Page selects which readings are shown when they do not fit on a single page
+	Page int
+	// Forecast for today and tomorrow shown as icons in the status line
+	Forecast []forecast.Day
+	// StationLayout selects how several stations are shown, RotateStations by default
+	StationLayout StationLayout
+	// StaleAfter is the age of the newest reading after which the status line is inverted
+	// and tells since when the data is stale, zero disables it
+	StaleAfter time.Duration
+	// ModuleMaxAge is the age of a reading after which its pane is flagged as not reporting
+	// unless the module has its own max age, zero disables it
+	ModuleMaxAge time.Duration
+	// Layout describes the panes of the readings, DefaultLayout when it has no widgets
+	Layout Layout
+	// Fonts selects the fonts of the text roles
+	Fonts Fonts
+}
+
+// timestampFormat is short enough to leave room for the forecast icons in the status line
+const timestampFormat = "Mon, 02 Jan 15:04 MST"
+
+// headerTimestampFormat leaves room for the name of the home in the header
+const headerTimestampFormat = "15:04"
+
+// staleTimestampFormat is used for stale readings from the same day, older ones get the date too
+const staleTimestampFormat = "15:04"
+const staleDateFormat = "02 Jan 15:04"
+
+func BuildGUI(logger *zap.SugaredLogger, bounds image.Rectangle, measurement []netatmo.Measurement, opts Options) (blackImg draw.Image, redImg draw.Image, err error) {
+	perPage := opts.PanesPerPage
+	if perPage <= 0 {
+		perPage = DefaultPanesPerPage
+	}
+	layout := opts.StationLayout
+	if layout == "" {
+		layout = RotateStations
+	}
+	var screens []screen
+	switch layout {
+	case RotateStations:
+		screens = rotateScreens(measurement, perPage)
+	case GridStations:
+		screens = gridScreens(measurement, gridColumns)
+	default:
+		err = errors.Errorf("unknown station layout %q", layout)
+		return
+	}
+	if len(screens) == 0 {
 		err = errors.New("measurements incomplete")
 		return
 	}
-	fontData, err := freetype.ParseFont(goregular.TTF)
+	fonts, err := newFontSet(opts.Fonts)
 	if err != nil {
-		err = errors.Wrap(err, "could not parse font file")
 		return
 	}
+	paneLayout := opts.Layout
+	if len(paneLayout.Pane) == 0 {
+		paneLayout = DefaultLayout
+	}
 
-	leftPane := image.Rect(1, 1, bounds.Dx()/2-1, bounds.Dy()-1)
-	rightPane := image.Rect((bounds.Dx()/2)+1, 1, bounds.Dx()-1, bounds.Dy()-1)
+	pages := len(screens)
+	page := opts.Page % pages
+	if page < 0 {
+		page += pages
+	}
+	rows := screens[page]
+	logger.With("page", page+1, "pages", pages, "stations", len(rows), "layout", layout).Debug("laying out readings")
 
-	blackImg = image.NewPaletted(bounds, color.Palette{color.White, color.Black})
-	draw.Draw(blackImg, blackImg.Bounds(), image.White, image.Point{}, draw.Src)
-	fontCtx := freetype.NewContext()
-	fontCtx.SetFont(fontData)
-	fontCtx.SetDPI(deviceDPI)
-	fontCtx.SetClip(blackImg.Bounds())
-	fontCtx.SetDst(blackImg)
-	fontCtx.SetSrc(image.Black)
-	fontCtx.SetHinting(font.HintingFull)
+	black := image.NewPaletted(bounds, color.Palette{color.White, color.Black})
+	draw.Draw(black, black.Bounds(), image.White, image.Point{}, draw.Src)
+	red := image.NewPaletted(bounds, color.Palette{color.White, color.Black})
+	draw.Draw(red, red.Bounds(), image.White, image.Point{}, draw.Src)
+	blackImg, redImg = black, red
 
-	// Names
-	fontCtx.SetFontSize(tertiaryFontSize)
-	pt := freetype.Pt(leftPane.Min.X, 1+int(fontCtx.PointToFixed(tertiaryFontSize)>>6))
-	_, err = fontCtx.DrawString(measurement[0].StationReading.Name, pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw station name string")
+	blackPen := newPen(fonts, blackImg)
+	redPen := newPen(fonts, redImg)
+	panes := paneCanvas{
+		canvas: canvas{
+			fonts:  fonts,
+			pens:   map[Plane]*pen{BlackPlane: blackPen, RedPlane: redPen},
+			images: map[Plane]draw.Image{BlackPlane: black, RedPlane: red},
+			days:   opts.Forecast,
+		},
+		black:   black,
+		widgets: paneLayout.Pane,
 	}
 
-	pt = freetype.Pt(rightPane.Min.X, 1+int(fontCtx.PointToFixed(tertiaryFontSize)>>6))
-	_, err = fontCtx.DrawString(measurement[0].ModuleReadings[0].Name, pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw module name string")
+	var timeStamp time.Time
+	for _, row := range rows {
+		for _, reading := range row.readings {
+			if reading.Timestamp.After(timeStamp) {
+				timeStamp = reading.Timestamp
+			}
+		}
 	}
-
-	// Humidity label
-	fontCtx.SetFontSize(tertiaryFontSize)
-	pt = freetype.Pt(leftPane.Min.X, 72+int(fontCtx.PointToFixed(tertiaryFontSize)>>6))
-	_, err = fontCtx.DrawString("H:", pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 1st humidity label")
+	status := statusLine{days: opts.Forecast}
+	if pages > 1 {
+		status.pageLabel = fmt.Sprintf("%d/%d", page+1, pages)
+	}
+	now := time.Now()
+	panes.now = now
+	for i := range rows {
+		rows[i].tags = freshnessTags(rows[i].readings, now, opts.ModuleMaxAge)
+	}
+	stale := opts.StaleAfter > 0 && !timeStamp.IsZero() && now.Sub(timeStamp) > opts.StaleAfter
+	if stale {
+		logger.With("timestamp", timeStamp, "stale_after", opts.StaleAfter).Warn("readings are stale")
+		status.inverted = true
 	}
 
-	pt = freetype.Pt(rightPane.Min.X, 72+int(fontCtx.PointToFixed(tertiaryFontSize)>>6))
-	_, err = fontCtx.DrawString("H:", pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 2nd humidity label")
+	// a single station keeps the whole screen, otherwise the rotated pages get a header
+	// with the name of the home instead of the status line
+	if layout == RotateStations && countStations(measurement) > 1 {
+		status.label = fmt.Sprintf("%s %s", rows[0].home, timeStamp.Format(headerTimestampFormat))
+		if stale {
+			status.label = fmt.Sprintf("%s stale since %s", rows[0].home, staleSince(timeStamp, now))
+		}
+		status.iconSize = headerIconSize
+		drawStatusLine(logger, blackPen, black, bounds, bounds.Min.Y, status)
+		drawHeader(black, bounds)
+		err = drawPanes(panes, image.Rect(bounds.Min.X, bounds.Min.Y+headerHeight, bounds.Max.X, bounds.Max.Y), rows[0])
+		return
 	}
 
-	// Temperatures range label
-	fontCtx.SetFontSize(statusFontSize)
-	pt = freetype.Pt(leftPane.Min.X, 45+int(fontCtx.PointToFixed(statusFontSize)>>6))
-	_, err = fontCtx.DrawString("Min:", pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 1st min temperature label")
+	// the status line is at the bottom with a pixel to spare below the descenders
+	statusY := bounds.Max.Y - fonts.height(StatusText, statusFontSize) - 1
+	if layout == GridStations {
+		area := image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Max.X, statusY-1)
+		for i, row := range rows {
+			band := image.Rect(area.Min.X, area.Min.Y+area.Dy()*i/gridRows, area.Max.X, area.Min.Y+area.Dy()*(i+1)/gridRows)
+			drawGridRow(blackPen, redPen, black, band, row)
+		}
+	} else if err = drawPanes(panes, bounds, rows[0]); err != nil {
+		return
 	}
-	pt = freetype.Pt(leftPane.Min.X+(leftPane.Dx()/2), 45+int(fontCtx.PointToFixed(statusFontSize)>>6))
-	_, err = fontCtx.DrawString("Max:", pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 1st max temperature label")
+	blackPen.setClip(bounds)
+	redPen.setClip(bounds)
+
+	status.label = fmt.Sprintf("Ts: %s", timeStamp.Format(timestampFormat))
+	if stale {
+		status.label = fmt.Sprintf("Stale since %s", staleSince(timeStamp, now))
 	}
+	status.iconSize = forecastIconSize
+	drawStatusLine(logger, blackPen, black, bounds, statusY, status)
+	return
+}
 
-	pt = freetype.Pt(rightPane.Min.X, 45+int(fontCtx.PointToFixed(statusFontSize)>>6))
-	_, err = fontCtx.DrawString("Min:", pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 2nd min temperature label")
+// staleSince formats the time of the newest reading, the date is left out for the readings from today
+func staleSince(timeStamp, now time.Time) string {
+	timeStamp = timeStamp.In(now.Location())
+	if timeStamp.YearDay() == now.YearDay() && timeStamp.Year() == now.Year() {
+		return timeStamp.Format(staleTimestampFormat)
 	}
-	pt = freetype.Pt(rightPane.Min.X+(rightPane.Dx()/2), 45+int(fontCtx.PointToFixed(statusFontSize)>>6))
-	_, err = fontCtx.DrawString("Max:", pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 2nd max temperature label")
+
+	return timeStamp.Format(staleDateFormat)
+}
+
+// countStations returns the number of stations with at least one reading.
+func countStations(measurements []netatmo.Measurement) int {
+	count := 0
+	for _, measurement := range measurements {
+		if len(measurement.Readings()) > 0 {
+			count++
+		}
 	}
 
-	pt = freetype.Pt(leftPane.Min.X, 90+int(fontCtx.PointToFixed(statusFontSize)>>6))
-	var timeStamp time.Time
-	if measurement[0].StationReading.Timestamp.After(measurement[0].ModuleReadings[0].Timestamp) {
-		timeStamp = measurement[0].StationReading.Timestamp
-	} else {
-		timeStamp = measurement[0].ModuleReadings[0].Timestamp
+	return count
+}
+
+// paneCanvas draws the panes of the readings with the widgets of the layout
+type paneCanvas struct {
+	canvas
+	black   *image.Paletted
+	widgets []Widget
+}
+
+// drawPanes draws the readings of the station side by side.
+func drawPanes(c paneCanvas, bounds image.Rectangle, row stationRow) error {
+	panes := SplitPanes(bounds, row.slots)
+	for i, reading := range row.readings {
+		paneCanvas := c.canvas
+		if row.tags[i] != "" {
+			// values of modules which stopped reporting are not current so they are not drawn in red
+			paneCanvas.pens = map[Plane]*pen{BlackPlane: c.pens[BlackPlane], RedPlane: c.pens[BlackPlane]}
+			paneCanvas.images = map[Plane]draw.Image{BlackPlane: c.images[BlackPlane], RedPlane: c.images[BlackPlane]}
+		}
+		if err := drawWidgets(paneCanvas, panes[i], reading, c.widgets); err != nil {
+			return errors.Wrapf(err, "could not draw %s pane", reading.Name)
+		}
+		drawTag(c.pens[BlackPlane], c.black, panes[i], row.tags[i])
 	}
-	_, err = fontCtx.DrawString(fmt.Sprintf("Ts: %s", timeStamp.Format(time.RFC1123)), pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw timestamp")
+
+	return nil
+}
+
+// freshnessTags returns the tag of every reading, empty for the modules which still report.
+func freshnessTags(readings []netatmo.Reading, now time.Time, maxAge time.Duration) []string {
+	tags := make([]string, len(readings))
+	for i, reading := range readings {
+		switch reading.Freshness(now, maxAge) {
+		case netatmo.Unreachable:
+			tags[i] = "offline"
+		case netatmo.Stale:
+			tags[i] = formatAge(reading.Age(now)) + " old"
+		}
 	}
 
-	// Red layer
-	redImg = image.NewPaletted(bounds, color.Palette{color.White, color.Black})
-	draw.Draw(redImg, redImg.Bounds(), image.White, image.Point{}, draw.Src)
+	return tags
+}
 
-	// Humidity
-	fontCtx.SetFontSize(secondaryFontSize)
-	pt = freetype.Pt(rightPane.Min.X+15, 70+int(fontCtx.PointToFixed(secondaryFontSize)>>6))
-	_, err = fontCtx.DrawString(fmt.Sprintf("%d%%", measurement[0].ModuleReadings[0].Humidity), pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 1st humidity string")
+// formatAge rounds the age to the largest whole unit to keep the tag short.
+func formatAge(age time.Duration) string {
+	switch {
+	case age >= 48*time.Hour:
+		return fmt.Sprintf("%dd", int(age/(24*time.Hour)))
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh", int(age/time.Hour))
+	default:
+		return fmt.Sprintf("%dm", int(age/time.Minute))
 	}
+}
 
-	pt = freetype.Pt(leftPane.Min.X+15, 70+int(fontCtx.PointToFixed(secondaryFontSize)>>6))
-	_, err = fontCtx.DrawString(fmt.Sprintf("%d%%", measurement[0].StationReading.Humidity), pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 2nd humidity string")
+// drawTag draws the tag white on black in the top right corner of the area, over the name
+// of the module if they do not fit side by side.
+func drawTag(p *pen, dst *image.Paletted, area image.Rectangle, tag string) {
+	if tag == "" {
+		return
 	}
+	width := p.width(StatusText, statusFontSize, tag)
+	rect := image.Rect(area.Max.X-width-3, area.Min.Y, area.Max.X, area.Min.Y+10).Intersect(area)
+	draw.Draw(dst, rect, image.White, image.Point{}, draw.Src)
+	p.setClip(rect)
+	p.drawString(StatusText, statusFontSize, rect.Min.X+2, rect.Min.Y-1, tag)
+	invertRect(dst, rect)
+}
 
-	// Temperatures
-	fontCtx.SetFontSize(mainFontSize)
-	fontCtx.SetDst(redImg)
-	fontCtx.SetClip(redImg.Bounds())
-	pt = freetype.Pt(rightPane.Min.X, 15+int(fontCtx.PointToFixed(mainFontSize)>>6))
-	_, err = fontCtx.DrawString(fmt.Sprintf("%.1f°C", measurement[0].ModuleReadings[0].Temperature), pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 1st temperature string")
+// statusLine is the line with the time of the readings, the page number and the forecast
+type statusLine struct {
+	label string
+	// inverted draws the label white on black to make it stand out
+	inverted  bool
+	pageLabel string
+	days      []forecast.Day
+	iconSize  int
+}
+
+// drawStatusLine fills the line at y from the right with the page number and the forecast
+// icons and draws the label in the space left of them.
+func drawStatusLine(logger *zap.SugaredLogger, p *pen, dst *image.Paletted, bounds image.Rectangle, y int, line statusLine) {
+	p.setClip(bounds)
+	x := bounds.Max.X - 1
+	if line.pageLabel != "" {
+		x -= p.width(StatusText, statusFontSize, line.pageLabel)
+		p.drawString(StatusText, statusFontSize, x, y, line.pageLabel)
+		x -= 3
 	}
 
-	pt = freetype.Pt(leftPane.Min.X, 15+int(fontCtx.PointToFixed(mainFontSize)>>6))
-	_, err = fontCtx.DrawString(fmt.Sprintf("%.1f°C", measurement[0].StationReading.Temperature), pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 2nd temperature string")
+	days := line.days
+	iconSize := line.iconSize
+	if len(days) > 2 {
+		days = days[:2]
+	}
+	iconY := y - 1
+	if iconY < bounds.Min.Y {
+		iconY = bounds.Min.Y
+	}
+	for i := len(days) - 1; i >= 0; i-- {
+		icon, err := WeatherIcon(days[i].Condition, iconSize)
+		if err != nil {
+			logger.With("err", err, "condition", days[i].Condition).Warn("could not draw forecast icon")
+			continue
+		}
+		x -= iconSize
+		drawIcon(dst, icon, image.Pt(x, iconY))
+		x -= 2
 	}
 
-	// Temperature ranges
-	fontCtx.SetFontSize(tertiaryFontSize)
-	pt = freetype.Pt(rightPane.Min.X, 55+int(fontCtx.PointToFixed(tertiaryFontSize)>>6))
-	_, err = fontCtx.DrawString(fmt.Sprintf("%.1f°C", measurement[0].ModuleReadings[0].MinTemp), pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 1st min temperature string")
+	// a long name of the home is ellipsized rather than drawn over the icons
+	label := ellipsize(p.fontSet, StatusText, statusFontSize, x-bounds.Min.X-3, line.label)
+	p.drawString(StatusText, statusFontSize, bounds.Min.X+1, y, label)
+	if line.inverted {
+		width := p.width(StatusText, statusFontSize, label)
+		invertRect(dst, image.Rect(bounds.Min.X, y-1, bounds.Min.X+width+3, y+p.height(StatusText, statusFontSize)-1).Intersect(bounds))
 	}
+}
 
-	pt = freetype.Pt(rightPane.Min.X+(rightPane.Dx()/2), 55+int(fontCtx.PointToFixed(tertiaryFontSize)>>6))
-	_, err = fontCtx.DrawString(fmt.Sprintf("%.1f°C", measurement[0].ModuleReadings[0].MaxTemp), pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 1st max temperature string")
+// SplitPanes divides the screen into n panes of equal width with a 1px margin.
+func SplitPanes(bounds image.Rectangle, n int) []image.Rectangle {
+	panes := make([]image.Rectangle, 0, n)
+	for i := 0; i < n; i++ {
+		minX := bounds.Min.X + bounds.Dx()*i/n + 1
+		maxX := bounds.Min.X + bounds.Dx()*(i+1)/n - 1
+		panes = append(panes, image.Rect(minX, bounds.Min.Y+1, maxX, bounds.Max.Y-1))
 	}
 
-	pt = freetype.Pt(leftPane.Min.X, 55+int(fontCtx.PointToFixed(tertiaryFontSize)>>6))
-	_, err = fontCtx.DrawString(fmt.Sprintf("%.1f°C", measurement[0].StationReading.MinTemp), pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 2nd min temperature string")
+	return panes
+}
+
+// paneValues are the strings shown in a pane, they depend on what the module measures
+type paneValues struct {
+	main       string
+	leftLabel  string
+	left       string
+	rightLabel string
+	right      string
+	// humidity is empty for modules which do not measure it
+	humidity string
+}
+
+func newPaneValues(reading netatmo.Reading) paneValues {
+	switch {
+	case reading.Rain != nil:
+		return paneValues{
+			main:       fmt.Sprintf("%.1fmm", reading.Rain.Current),
+			leftLabel:  "1h:",
+			left:       fmt.Sprintf("%.1fmm", reading.Rain.SumHour),
+			rightLabel: "24h:",
+			right:      fmt.Sprintf("%.1fmm", reading.Rain.SumDay),
+		}
+	case reading.Wind != nil:
+		return paneValues{
+			main:       fmt.Sprintf("%dkm/h", reading.Wind.Strength),
+			leftLabel:  "Gust:",
+			left:       fmt.Sprintf("%dkm/h", reading.Wind.GustStrength),
+			rightLabel: "Dir:",
+			right:      compassDirection(reading.Wind.Angle),
+		}
+	default:
+		return paneValues{
+			main:       fmt.Sprintf("%.1f°C", reading.Temperature),
+			leftLabel:  "Min:",
+			left:       fmt.Sprintf("%.1f°C", reading.MinTemp),
+			rightLabel: "Max:",
+			right:      fmt.Sprintf("%.1f°C", reading.MaxTemp),
+			humidity:   fmt.Sprintf("%d%%", reading.Humidity),
+		}
 	}
+}
 
-	pt = freetype.Pt(leftPane.Min.X+(leftPane.Dx()/2), 55+int(fontCtx.PointToFixed(tertiaryFontSize)>>6))
-	_, err = fontCtx.DrawString(fmt.Sprintf("%.1f°C", measurement[0].StationReading.MaxTemp), pt)
-	if err != nil {
-		logger.With("err", err).Fatal("could not draw 2nd max temperature string")
+// compassDirection converts the wind angle in degrees to one of the 8 compass directions.
+func compassDirection(angle int64) string {
+	directions := []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+	if angle < 0 {
+		return "-"
 	}
 
-	return
+	return directions[((angle*2+45)/90)%8]
 }
@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"weather-pi/netatmo"
+)
+
+func TestFormatAge(t *testing.T) {
+	for _, tt := range []struct {
+		age  time.Duration
+		want string
+	}{
+		{0, "0m"},
+		{59 * time.Second, "0m"},
+		{time.Minute, "1m"},
+		{59*time.Minute + 59*time.Second, "59m"},
+		{time.Hour, "1h"},
+		{90 * time.Minute, "1h"},
+		{47*time.Hour + 59*time.Minute, "47h"},
+		// days are only used from the second day on so the hours are not rounded away
+		{48 * time.Hour, "2d"},
+		{71 * time.Hour, "2d"},
+		{72 * time.Hour, "3d"},
+	} {
+		if got := formatAge(tt.age); got != tt.want {
+			t.Errorf("formatAge(%s) = %q, want %q", tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestStaleSince(t *testing.T) {
+	loc := time.FixedZone("CET", 3600)
+	now := time.Date(2024, time.March, 5, 12, 0, 0, 0, loc)
+	for _, tt := range []struct {
+		name      string
+		timeStamp time.Time
+		want      string
+	}{
+		{name: "today", timeStamp: time.Date(2024, time.March, 5, 8, 30, 0, 0, loc), want: "08:30"},
+		// the time is shown in the time zone of the display
+		{name: "today in UTC", timeStamp: time.Date(2024, time.March, 5, 7, 30, 0, 0, time.UTC), want: "08:30"},
+		{name: "yesterday", timeStamp: time.Date(2024, time.March, 4, 23, 45, 0, 0, loc), want: "04 Mar 23:45"},
+		{name: "same day a year ago", timeStamp: time.Date(2023, time.March, 6, 8, 30, 0, 0, loc), want: "06 Mar 08:30"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := staleSince(tt.timeStamp, now); got != tt.want {
+				t.Errorf("staleSince() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreshnessTags(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	readings := []netatmo.Reading{
+		{Name: "Outdoor", Type: netatmo.OutdoorModule, Timestamp: now.Add(-5 * time.Minute), Status: netatmo.Status{Reachable: true}},
+		{Name: "Bedroom", Type: netatmo.IndoorModule, Timestamp: now.Add(-90 * time.Minute), Status: netatmo.Status{Reachable: true}},
+		{Name: "Rain gauge", Type: netatmo.RainGauge, Timestamp: now.Add(-90 * time.Minute), Status: netatmo.Status{Reachable: true}, MaxAge: 3 * time.Hour},
+		{Name: "Wind gauge", Type: netatmo.WindGauge, Timestamp: now.Add(-50 * time.Hour), Status: netatmo.Status{Reachable: true}},
+		{Name: "Garage", Type: netatmo.IndoorModule, Timestamp: now},
+	}
+
+	if got, want := freshnessTags(readings, now, time.Hour), []string{"", "1h old", "", "2d old", "offline"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("freshnessTags() = %q, want %q", got, want)
+	}
+	if got, want := freshnessTags(readings, now, 0), []string{"", "", "", "", "offline"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("freshnessTags() without the default max age = %q, want %q", got, want)
+	}
+}
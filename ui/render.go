@@ -0,0 +1,304 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"time"
+	"weather-pi/forecast"
+	"weather-pi/netatmo"
+
+	"github.com/pkg/errors"
+)
+
+// canvas is what the widgets of a pane are drawn onto.
+type canvas struct {
+	fonts  *fontSet
+	pens   map[Plane]*pen
+	images map[Plane]draw.Image
+	// days are shown by the icons bound to the forecast field
+	days []forecast.Day
+	// now is shown by the clocks which are not bound to the time of the reading
+	now time.Time
+}
+
+// drawWidgets draws the widgets of the layout in the pane. The widgets are cut to the pane
+// so text wider than the rest of the pane is shrunk or ellipsized instead of overflowing
+// into the neighbouring one.
+func drawWidgets(c canvas, pane image.Rectangle, reading netatmo.Reading, widgets []Widget) error {
+	// the pane starts right below the header if there is one
+	area := image.Rect(pane.Min.X, pane.Min.Y-1, pane.Max.X, pane.Max.Y)
+	for _, p := range c.pens {
+		p.setClip(pane)
+	}
+
+	for i, widget := range widgets {
+		el, err := c.element(widget, reading, false)
+		if err != nil {
+			return errors.Wrapf(err, "could not create %s widget %d", widget.Type, i+1)
+		}
+		if el == nil {
+			continue
+		}
+		box := widget.box(area, el.size()).Intersect(area)
+		if box.Empty() {
+			continue
+		}
+		if err := el.draw(box); err != nil {
+			return errors.Wrapf(err, "could not draw %s widget %d", widget.Type, i+1)
+		}
+	}
+
+	return nil
+}
+
+// box returns the rectangle of the widget within the area of the pane. Unset width and height
+// default to the measured size of the widget or to the rest of the pane when it fills the space.
+func (w Widget) box(area image.Rectangle, size image.Point) image.Rectangle {
+	min := image.Pt(area.Min.X+w.X.resolve(area.Dx()), area.Min.Y+w.Y.resolve(area.Dy()))
+	max := area.Max
+	switch {
+	case !w.Width.IsZero():
+		max.X = min.X + w.Width.resolve(area.Dx())
+	case size.X > 0:
+		max.X = min.X + size.X
+	}
+	switch {
+	case !w.Height.IsZero():
+		max.Y = min.Y + w.Height.resolve(area.Dy())
+	case size.Y > 0:
+		max.Y = min.Y + size.Y
+	}
+
+	return image.Rectangle{Min: min, Max: max}
+}
+
+// element returns the widget bound to the reading or nil when the reading does not have
+// what the widget shows. inRow turns dividers vertical.
+func (c canvas) element(widget Widget, reading netatmo.Reading, inRow bool) (element, error) {
+	if widget.If != "" && !hasField(reading, widget.If, c.days) {
+		return nil, nil
+	}
+	if widget.Unless != "" && hasField(reading, widget.Unless, c.days) {
+		return nil, nil
+	}
+	plane := widget.Plane
+	if plane == "" {
+		plane = BlackPlane
+	}
+	fontSize := widget.Size
+	if fontSize <= 0 {
+		fontSize = tertiaryFontSize
+	}
+	minSize := widget.MinSize
+	if minSize <= 0 || minSize > fontSize {
+		minSize = math.Min(fontSize, statusFontSize)
+	}
+	role := widget.role()
+	text := func(value string) element {
+		if value == "" {
+			return nil
+		}
+		return &textElement{canvas: c, plane: plane, role: role, text: value, fontSize: fontSize, minSize: minSize, align: widget.Align}
+	}
+	fixed := func(width, height int) image.Point {
+		if !widget.Width.IsZero() {
+			width = widget.Width.Pixels
+		}
+		if !widget.Height.IsZero() {
+			height = widget.Height.Pixels
+		}
+		return image.Pt(width, height)
+	}
+
+	switch widget.Type {
+	case TextWidget:
+		return text(widget.Text), nil
+	case ValueWidget:
+		value, _ := fieldValue(reading, widget.Field, c.days)
+		return text(value), nil
+	case LabelWidget:
+		value, label := fieldValue(reading, widget.Field, c.days)
+		if value == "" {
+			return nil, nil
+		}
+		return text(label), nil
+	case IconWidget:
+		condition := forecast.Condition(widget.Icon)
+		if widget.Field == ForecastField {
+			if len(c.days) == 0 {
+				return nil, nil
+			}
+			condition = c.days[0].Condition
+		}
+		iconSize := forecastIconSize
+		if !widget.Width.IsZero() {
+			iconSize = widget.Width.Pixels
+		}
+		icon, err := WeatherIcon(condition, iconSize)
+		if err != nil {
+			return nil, err
+		}
+		return &iconElement{dst: c.images[plane], icon: icon}, nil
+	case SparklineWidget:
+		return &sparklineElement{dst: c.images[plane], samples: reading.History}, nil
+	case DividerWidget:
+		return &dividerElement{dst: c.images[plane], vertical: inRow || !widget.Height.IsZero() && widget.Width.IsZero()}, nil
+	case BigNumberWidget:
+		field := widget.Field
+		if field == "" {
+			field = MainField
+		}
+		value, _ := fieldValue(reading, field, c.days)
+		if value == "" {
+			return nil, nil
+		}
+		number, unit := splitUnit(value)
+		return &bigNumberElement{canvas: c, plane: plane, role: role, number: number, unit: unit, fontSize: fontSize, minSize: minSize}, nil
+	case LabelledWidget:
+		value, label := fieldValue(reading, widget.Field, c.days)
+		if value == "" {
+			return nil, nil
+		}
+		return &labelledElement{canvas: c, plane: plane, role: role, label: label, value: value, fontSize: fontSize, minSize: minSize, labelSize: widget.labelSize()}, nil
+	case MinMaxWidget:
+		values := newPaneValues(reading)
+		return &minMaxElement{canvas: c, plane: plane, role: role, values: values, fontSize: fontSize, minSize: minSize, labelSize: widget.labelSize()}, nil
+	case HumidityBarWidget:
+		if !reading.Type.HasTemperature() {
+			return nil, nil
+		}
+		return &gaugeElement{dst: c.images[plane], percent: reading.Humidity, fixed: fixed(40, 6)}, nil
+	case BatteryWidget:
+		if reading.Status.Battery == nil {
+			return nil, nil
+		}
+		return &gaugeElement{dst: c.images[plane], percent: *reading.Status.Battery, fixed: fixed(16, 8), nub: true}, nil
+	case TrendWidget:
+		trend := reading.TempTrend
+		if widget.Field == PressureField && reading.Pressure != nil {
+			trend = reading.Pressure.Trend
+		}
+		if trend == "" {
+			return nil, nil
+		}
+		return &trendElement{dst: c.images[plane], trend: trend, fixed: fixed(7, 7)}, nil
+	case ClockWidget:
+		at := c.now
+		if widget.Field == TimeField {
+			at = reading.Timestamp
+		}
+		format := widget.Format
+		if format == "" {
+			format = headerTimestampFormat
+		}
+		if at.IsZero() {
+			return nil, nil
+		}
+		return text(at.Format(format)), nil
+	case RowWidget, ColumnWidget, BoxWidget:
+		stack := &stackElement{dst: c.images[plane], horizontal: widget.Type == RowWidget, gap: widget.Gap}
+		if widget.Type == BoxWidget {
+			stack.border = true
+			stack.padding = 2
+		}
+		for i, child := range widget.Children {
+			el, err := c.element(child, reading, stack.horizontal)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not create %s child %d", child.Type, i+1)
+			}
+			if el != nil {
+				stack.children = append(stack.children, el)
+			}
+		}
+		if len(stack.children) == 0 {
+			return nil, nil
+		}
+		return stack, nil
+	default:
+		return nil, errors.Errorf("unknown widget type %q", widget.Type)
+	}
+}
+
+// role is the text role of the font the widget is drawn with, the labels of the labelled
+// and min/max widgets always use the label font
+func (w Widget) role() TextRole {
+	switch {
+	case w.Font != "":
+		return w.Font
+	case w.Type == TextWidget || w.Type == LabelWidget:
+		return LabelText
+	default:
+		return ValueText
+	}
+}
+
+// labelSize is the font size of the labels of the labelled and min/max widgets
+func (w Widget) labelSize() float64 {
+	if w.LabelSize > 0 {
+		return w.LabelSize
+	}
+
+	return statusFontSize
+}
+
+// fieldValue returns the value of the field formatted for the display and its label,
+// the value is empty when the reading does not have the field.
+func fieldValue(reading netatmo.Reading, field Field, days []forecast.Day) (value, label string) {
+	values := newPaneValues(reading)
+	switch field {
+	case NameField:
+		return reading.Name, ""
+	case MainField:
+		return values.main, ""
+	case LeftField:
+		return values.left, values.leftLabel
+	case RightField:
+		return values.right, values.rightLabel
+	case HumidityField:
+		return values.humidity, "H:"
+	case CO2Field:
+		if reading.CO2 != nil {
+			value = fmt.Sprintf("%dppm", *reading.CO2)
+		}
+		return value, "CO2:"
+	case PressureField:
+		if reading.Pressure != nil {
+			value = fmt.Sprintf("%.0fhPa", reading.Pressure.Value)
+		}
+		return value, "P:"
+	case NoiseField:
+		if reading.Noise != nil {
+			value = fmt.Sprintf("%ddB", *reading.Noise)
+		}
+		return value, "Noise:"
+	case BatteryField:
+		if reading.Status.Battery != nil {
+			value = fmt.Sprintf("%d%%", *reading.Status.Battery)
+		}
+		return value, "Bat:"
+	case TimeField:
+		if !reading.Timestamp.IsZero() {
+			value = reading.Timestamp.Format(headerTimestampFormat)
+		}
+		return value, "Ts:"
+	case ForecastField:
+		if len(days) > 0 {
+			value = string(days[0].Condition)
+		}
+		return value, "Today:"
+	default:
+		return "", ""
+	}
+}
+
+// hasField tells if the reading has the field, the history needs at least two samples to be drawn.
+func hasField(reading netatmo.Reading, field Field, days []forecast.Day) bool {
+	if field == HistoryField {
+		return len(reading.History) > 1
+	}
+	value, _ := fieldValue(reading, field, days)
+
+	return value != ""
+}
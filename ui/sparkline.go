@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"weather-pi/netatmo"
+)
+
+// drawSparkline draws the samples as a line scaled to fill the given rectangle.
+func drawSparkline(dst draw.Image, rect image.Rectangle, samples []netatmo.Sample) {
+	if len(samples) < 2 || rect.Dx() < 2 || rect.Dy() < 2 {
+		return
+	}
+
+	minValue, maxValue := samples[0].Value, samples[0].Value
+	for _, sample := range samples {
+		if sample.Value < minValue {
+			minValue = sample.Value
+		}
+		if sample.Value > maxValue {
+			maxValue = sample.Value
+		}
+	}
+	start, end := samples[0].Time, samples[len(samples)-1].Time
+	span := end.Sub(start)
+	if span <= 0 {
+		return
+	}
+
+	point := func(sample netatmo.Sample) image.Point {
+		x := rect.Min.X + int(float64(rect.Dx()-1)*float64(sample.Time.Sub(start))/float64(span))
+		y := rect.Max.Y - 1
+		if maxValue > minValue {
+			y -= int(float64(rect.Dy()-1) * (sample.Value - minValue) / (maxValue - minValue))
+		} else {
+			y -= (rect.Dy() - 1) / 2
+		}
+		return image.Pt(x, y)
+	}
+
+	prev := point(samples[0])
+	for _, sample := range samples[1:] {
+		cur := point(sample)
+		drawLine(dst, prev, cur, color.Black)
+		prev = cur
+	}
+}
+
+// drawLine draws a line between two points using Bresenham's algorithm.
+func drawLine(dst draw.Image, from, to image.Point, c color.Color) {
+	dx := abs(to.X - from.X)
+	dy := -abs(to.Y - from.Y)
+	sx, sy := 1, 1
+	if from.X > to.X {
+		sx = -1
+	}
+	if from.Y > to.Y {
+		sy = -1
+	}
+
+	err := dx + dy
+	x, y := from.X, from.Y
+	for {
+		dst.Set(x, y, c)
+		if x == to.X && y == to.Y {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
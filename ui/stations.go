@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"image"
+	"weather-pi/netatmo"
+)
+
+// StationLayout selects how the readings of several stations share the screen.
+type StationLayout string
+
+const (
+	// RotateStations shows the stations one after another, every page has the name of the home in the header
+	RotateStations StationLayout = "rotate"
+	// GridStations shows the stations in rows of compact cells below the names of the homes
+	GridStations StationLayout = "grid"
+)
+
+// gridRows is the number of stations which fit on the screen in the grid layout
+const gridRows = 2
+
+// gridColumns is the number of readings of a station which fit in a row of the grid
+const gridColumns = 3
+
+// headerHeight is the space taken by the header of the rotated stations
+const headerHeight = 13
+
+// headerIconSize keeps the forecast icons within the header
+const headerIconSize = 11
+
+// stationRow is the part of a station shown on a single page
+type stationRow struct {
+	home     string
+	readings []netatmo.Reading
+	// slots keeps the panes equally wide when the readings of the station span several pages
+	slots int
+	// tags flag the readings of the modules which stopped reporting
+	tags []string
+}
+
+// screen lists the stations shown at once
+type screen []stationRow
+
+// stationPages splits the readings of every station into rows of at most perRow readings.
+// Stations without readings are left out.
+func stationPages(measurements []netatmo.Measurement, perRow int) [][]stationRow {
+	var stations [][]stationRow
+	for _, measurement := range measurements {
+		readings := measurement.Readings()
+		if len(readings) == 0 {
+			continue
+		}
+		slots := len(readings)
+		if slots > perRow {
+			slots = perRow
+		}
+		var rows []stationRow
+		for first := 0; first < len(readings); first += perRow {
+			last := first + perRow
+			if last > len(readings) {
+				last = len(readings)
+			}
+			rows = append(rows, stationRow{home: measurement.StationName, readings: readings[first:last], slots: slots})
+		}
+		stations = append(stations, rows)
+	}
+
+	return stations
+}
+
+// rotateScreens shows every page of every station on its own.
+func rotateScreens(measurements []netatmo.Measurement, perPage int) []screen {
+	var screens []screen
+	for _, rows := range stationPages(measurements, perPage) {
+		for _, row := range rows {
+			screens = append(screens, screen{row})
+		}
+	}
+
+	return screens
+}
+
+// gridScreens puts up to gridRows stations on a page. Stations with more readings than fit
+// in a row are paged through while the other stations of the page stay in place.
+func gridScreens(measurements []netatmo.Measurement, perRow int) []screen {
+	stations := stationPages(measurements, perRow)
+	var screens []screen
+	for first := 0; first < len(stations); first += gridRows {
+		last := first + gridRows
+		if last > len(stations) {
+			last = len(stations)
+		}
+		group := stations[first:last]
+		count := 0
+		for _, rows := range group {
+			if len(rows) > count {
+				count = len(rows)
+			}
+		}
+		for i := 0; i < count; i++ {
+			var s screen
+			for _, rows := range group {
+				s = append(s, rows[i%len(rows)])
+			}
+			screens = append(screens, s)
+		}
+	}
+
+	return screens
+}
+
+// drawHeader draws a line below the header of the rotated stations.
+func drawHeader(dst *image.Paletted, bounds image.Rectangle) {
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		dst.SetColorIndex(x, bounds.Min.Y+headerHeight-1, 1)
+	}
+}
+
+// drawGridRow draws the name of the home followed by a compact cell for every reading.
+func drawGridRow(blackPen, redPen *pen, blackImg *image.Paletted, area image.Rectangle, row stationRow) {
+	blackPen.setClip(area)
+	drawText(blackPen, StatusText, image.Rect(area.Min.X+1, area.Min.Y, area.Max.X-1, area.Max.Y), statusFontSize, statusFontSize, AlignLeft, row.home)
+	for x := area.Min.X; x < area.Max.X; x++ {
+		blackImg.SetColorIndex(x, area.Min.Y+11, 1)
+	}
+
+	cells := SplitPanes(image.Rect(area.Min.X, area.Min.Y+12, area.Max.X, area.Max.Y), row.slots)
+	for i, reading := range row.readings {
+		blackPen.setClip(cells[i])
+		redPen.setClip(cells[i])
+		drawText(blackPen, LabelText, cells[i], statusFontSize, statusFontSize, AlignLeft, reading.Name)
+		valuePen := redPen
+		if row.tags[i] != "" {
+			valuePen = blackPen
+		}
+		value := image.Rect(cells[i].Min.X, cells[i].Min.Y+10, cells[i].Max.X, cells[i].Max.Y)
+		drawText(valuePen, ValueText, value, secondaryFontSize, statusFontSize, AlignLeft, newPaneValues(reading).main)
+		drawTag(blackPen, blackImg, cells[i], row.tags[i])
+	}
+}
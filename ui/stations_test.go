@@ -0,0 +1,126 @@
+package ui
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"weather-pi/netatmo"
+)
+
+// testStation returns a measurement of the home with the station and modules-1 modules
+func testStation(home string, readings int) netatmo.Measurement {
+	measurement := netatmo.Measurement{StationName: home}
+	if readings == 0 {
+		return measurement
+	}
+	measurement.StationReading = &netatmo.Reading{Name: home + " 1"}
+	for i := 2; i <= readings; i++ {
+		measurement.ModuleReadings = append(measurement.ModuleReadings, netatmo.Reading{Name: fmt.Sprintf("%s %d", home, i)})
+	}
+
+	return measurement
+}
+
+// describeScreens lists the readings of every row of every screen, e.g. "A 1,A 2|B 1"
+func describeScreens(screens []screen) []string {
+	descriptions := make([]string, 0, len(screens))
+	for _, s := range screens {
+		rows := make([]string, 0, len(s))
+		for _, row := range s {
+			names := make([]string, 0, len(row.readings))
+			for _, reading := range row.readings {
+				names = append(names, reading.Name)
+			}
+			rows = append(rows, strings.Join(names, ","))
+		}
+		descriptions = append(descriptions, strings.Join(rows, "|"))
+	}
+
+	return descriptions
+}
+
+func TestRotateScreens(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		measurements []netatmo.Measurement
+		perPage      int
+		want         []string
+	}{
+		{name: "no stations", want: []string{}},
+		{name: "single page", measurements: []netatmo.Measurement{testStation("A", 2)}, perPage: 2, want: []string{"A 1,A 2"}},
+		{name: "paged station", measurements: []netatmo.Measurement{testStation("A", 5)}, perPage: 2, want: []string{"A 1,A 2", "A 3,A 4", "A 5"}},
+		{
+			name:         "stations on their own pages",
+			measurements: []netatmo.Measurement{testStation("A", 3), testStation("B", 1)},
+			perPage:      2,
+			want:         []string{"A 1,A 2", "A 3", "B 1"},
+		},
+		{
+			name:         "station without readings",
+			measurements: []netatmo.Measurement{testStation("A", 1), testStation("B", 0), testStation("C", 2)},
+			perPage:      2,
+			want:         []string{"A 1", "C 1,C 2"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeScreens(rotateScreens(tt.measurements, tt.perPage)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rotateScreens() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGridScreens(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		measurements []netatmo.Measurement
+		want         []string
+	}{
+		{name: "single station", measurements: []netatmo.Measurement{testStation("A", 3)}, want: []string{"A 1,A 2,A 3"}},
+		{
+			name:         "stations sharing a page",
+			measurements: []netatmo.Measurement{testStation("A", 2), testStation("B", 3)},
+			want:         []string{"A 1,A 2|B 1,B 2,B 3"},
+		},
+		{
+			// the station fitting in a row stays in place while the other one is paged through
+			name:         "paged station",
+			measurements: []netatmo.Measurement{testStation("A", 2), testStation("B", 7)},
+			want:         []string{"A 1,A 2|B 1,B 2,B 3", "A 1,A 2|B 4,B 5,B 6", "A 1,A 2|B 7"},
+		},
+		{
+			// the shorter station wraps around to its first row
+			name:         "both stations paged",
+			measurements: []netatmo.Measurement{testStation("A", 4), testStation("B", 9)},
+			want:         []string{"A 1,A 2,A 3|B 1,B 2,B 3", "A 4|B 4,B 5,B 6", "A 1,A 2,A 3|B 7,B 8,B 9"},
+		},
+		{
+			name:         "stations on the next page",
+			measurements: []netatmo.Measurement{testStation("A", 1), testStation("B", 1), testStation("C", 4)},
+			want:         []string{"A 1|B 1", "C 1,C 2,C 3", "C 4"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeScreens(gridScreens(tt.measurements, gridColumns)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gridScreens() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStationPagesSlots(t *testing.T) {
+	// the last page of a station keeps the width of the panes of its other pages
+	stations := stationPages([]netatmo.Measurement{testStation("A", 5), testStation("B", 1)}, 3)
+	if len(stations) != 2 || len(stations[0]) != 2 || len(stations[1]) != 1 {
+		t.Fatalf("stationPages() = %+v, want 2 pages of A and 1 of B", stations)
+	}
+	for _, row := range stations[0] {
+		if row.slots != 3 || row.home != "A" {
+			t.Errorf("row of %s has %d slots, want 3", row.home, row.slots)
+		}
+	}
+	if row := stations[1][0]; row.slots != 1 || row.home != "B" {
+		t.Errorf("row of %s has %d slots, want 1", row.home, row.slots)
+	}
+}
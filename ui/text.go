@@ -0,0 +1,78 @@
+package ui
+
+import "image"
+
+// ellipsis ends the text which does not fit even at the smallest font size, fonts without
+// the glyph (such as many bitmap fonts) get the dots instead
+const ellipsis = '…'
+const ellipsisDots = "..."
+
+// fitStep is how much the font size is reduced at a time until the text fits
+const fitStep = 0.5
+
+// fitSize returns the largest font size from size down to minSize at which the measured
+// width fits, or minSize when nothing does.
+func fitSize(size, minSize float64, width int, measure func(size float64) int) float64 {
+	if minSize > size {
+		minSize = size
+	}
+	for ; size > minSize; size -= fitStep {
+		if measure(size) <= width {
+			return size
+		}
+	}
+
+	return minSize
+}
+
+// fitText shrinks the font down to minSize so the text fits in the width and cuts the
+// end of the text off with an ellipsis when that is not enough.
+func fitText(fonts *fontSet, role TextRole, size, minSize float64, width int, text string) (float64, string) {
+	size = fitSize(size, minSize, width, func(size float64) int {
+		return fonts.width(role, size, text)
+	})
+
+	return size, ellipsize(fonts, role, size, width, text)
+}
+
+// ellipsize returns the longest start of the text which fits in the width followed by
+// an ellipsis, the text itself when it fits and an empty string when not even the ellipsis does.
+func ellipsize(fonts *fontSet, role TextRole, size float64, width int, text string) string {
+	if fonts.width(role, size, text) <= width {
+		return text
+	}
+	mark := string(ellipsis)
+	if _, ok := fonts.face(role, size).GlyphAdvance(ellipsis); !ok {
+		mark = ellipsisDots
+	}
+	runes := []rune(text)
+	for n := len(runes) - 1; n >= 0; n-- {
+		shortened := string(runes[:n]) + mark
+		if fonts.width(role, size, shortened) <= width {
+			return shortened
+		}
+	}
+
+	return ""
+}
+
+// drawText draws the text aligned horizontally within the box with its top at the top of
+// the box. The text is fitted to the width of the box, shrunk text keeps the baseline of
+// the original size so it stays in line with its neighbours.
+func drawText(p *pen, role TextRole, box image.Rectangle, size, minSize float64, align Align, text string) {
+	fitted, text := fitText(p.fontSet, role, size, minSize, box.Dx(), text)
+	if text == "" {
+		return
+	}
+
+	x := box.Min.X
+	switch align {
+	case AlignCenter:
+		x += (box.Dx() - p.width(role, fitted, text)) / 2
+	case AlignRight:
+		x = box.Max.X - p.width(role, fitted, text)
+	}
+	y := box.Min.Y + p.baseline(role, size) - p.baseline(role, fitted)
+
+	p.drawString(role, fitted, x, y, text)
+}
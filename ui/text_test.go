@@ -0,0 +1,145 @@
+package ui
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func newTestFontSet(t *testing.T) *fontSet {
+	t.Helper()
+	fonts, err := newFontSet(Fonts{})
+	if err != nil {
+		t.Fatalf("newFontSet() error = %v", err)
+	}
+
+	return fonts
+}
+
+func TestFitSize(t *testing.T) {
+	// the text is 10 pixels wide per point
+	measure := func(size float64) int { return int(size * 10) }
+	for _, tt := range []struct {
+		name          string
+		size, minSize float64
+		width         int
+		want          float64
+	}{
+		{name: "fits", size: 12, minSize: 6, width: 200, want: 12},
+		{name: "fits exactly", size: 12, minSize: 6, width: 120, want: 12},
+		{name: "shrunk", size: 12, minSize: 6, width: 100, want: 10},
+		{name: "shrunk by half a point", size: 12, minSize: 6, width: 115, want: 11.5},
+		{name: "shrunk to the minimum", size: 12, minSize: 6, width: 60, want: 6},
+		{name: "too wide at the minimum", size: 12, minSize: 6, width: 10, want: 6},
+		{name: "minimum above the size", size: 8, minSize: 10, width: 10, want: 8},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fitSize(tt.size, tt.minSize, tt.width, measure); got != tt.want {
+				t.Errorf("fitSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFitText(t *testing.T) {
+	fonts := newTestFontSet(t)
+	text := "-12.3°C"
+	width := fonts.width(ValueText, 16, text)
+
+	// the text fits as it is
+	if size, fitted := fitText(fonts, ValueText, 16, 8, width, text); size != 16 || fitted != text {
+		t.Errorf("fitText() = %v, %q, want 16, %q", size, fitted, text)
+	}
+
+	// a narrower box shrinks the font but keeps the whole text
+	size, fitted := fitText(fonts, ValueText, 16, 8, width*3/4, text)
+	if size >= 16 || size < 8 || fitted != text {
+		t.Errorf("fitText() = %v, %q, want a smaller size and the whole text", size, fitted)
+	}
+	if w := fonts.width(ValueText, size, fitted); w > width*3/4 {
+		t.Errorf("shrunk text is %d pixels wide, want at most %d", w, width*3/4)
+	}
+
+	// the text does not fit even at the minimum size so it is ellipsized
+	narrow := fonts.width(ValueText, 8, text) - 1
+	size, fitted = fitText(fonts, ValueText, 16, 8, narrow, text)
+	if size != 8 || !strings.HasSuffix(fitted, string(ellipsis)) || !strings.HasPrefix(text, strings.TrimSuffix(fitted, string(ellipsis))) {
+		t.Errorf("fitText() = %v, %q, want the ellipsized text at the minimum size", size, fitted)
+	}
+	if w := fonts.width(ValueText, size, fitted); w > narrow {
+		t.Errorf("ellipsized text is %d pixels wide, want at most %d", w, narrow)
+	}
+}
+
+func TestEllipsize(t *testing.T) {
+	fonts := newTestFontSet(t)
+	ellipsisWidth := fonts.width(LabelText, 10, string(ellipsis))
+	for _, tt := range []struct {
+		name  string
+		text  string
+		width int
+		want  string
+	}{
+		{name: "fits", text: "Outdoor", width: 200, want: "Outdoor"},
+		{name: "empty", text: "", width: 0, want: ""},
+		{name: "cut", text: "Living room upstairs", width: fonts.width(LabelText, 10, "Living room…"), want: "Living room…"},
+		{name: "only the ellipsis", text: "Outdoor", width: ellipsisWidth, want: "…"},
+		{name: "narrower than the ellipsis", text: "Outdoor", width: ellipsisWidth - 1, want: ""},
+		// the runes are kept whole
+		{name: "multi-byte", text: "Łazienka na piętrze", width: fonts.width(LabelText, 10, "Łazienka na pię…"), want: "Łazienka na pię…"},
+		{name: "multi-byte start", text: "Żółć", width: fonts.width(LabelText, 10, "Ż…"), want: "Ż…"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ellipsize(fonts, LabelText, 10, tt.width, tt.text)
+			if got != tt.want {
+				t.Errorf("ellipsize() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("ellipsize() = %q has cut a rune in half", got)
+			}
+		})
+	}
+}
+
+func TestDrawTextAlign(t *testing.T) {
+	fonts := newTestFontSet(t)
+	box := image.Rect(10, 2, 110, 22)
+	for _, tt := range []struct {
+		align Align
+		check func(minX, maxX int) bool
+	}{
+		{AlignLeft, func(minX, maxX int) bool { return minX >= box.Min.X && minX <= box.Min.X+2 }},
+		{AlignRight, func(minX, maxX int) bool { return maxX < box.Max.X && maxX >= box.Max.X-3 }},
+		{AlignCenter, func(minX, maxX int) bool {
+			left, right := minX-box.Min.X, box.Max.X-1-maxX
+			return left-right <= 2 && right-left <= 2
+		}},
+	} {
+		t.Run(string(tt.align), func(t *testing.T) {
+			img := image.NewPaletted(image.Rect(0, 0, 120, 30), color.Palette{color.White, color.Black})
+			draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+			drawText(newPen(fonts, img), ValueText, box, 12, 8, tt.align, "-12.3°C")
+
+			drawn := image.Rectangle{}
+			for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+				for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+					if img.ColorIndexAt(x, y) == 1 {
+						drawn = drawn.Union(image.Rect(x, y, x+1, y+1))
+					}
+				}
+			}
+			if drawn.Empty() {
+				t.Fatal("nothing has been drawn")
+			}
+			if !drawn.In(box) {
+				t.Errorf("text drawn at %v, outside of the box %v", drawn, box)
+			}
+			if !tt.check(drawn.Min.X, drawn.Max.X-1) {
+				t.Errorf("%s aligned text drawn at %v in the box %v", tt.align, drawn, box)
+			}
+		})
+	}
+}
@@ -20,3 +20,49 @@ func RotateImage(src draw.Image) (draw.Image, error) {
 
 	return rotImage, nil
 }
+
+// MergeImages returns an image with pixels set in any of the given two color images.
+func MergeImages(a, b image.Image) draw.Image {
+	merged := image.NewPaletted(a.Bounds(), color.Palette{color.White, color.Black})
+	draw.Draw(merged, merged.Bounds(), image.White, image.Point{}, draw.Src)
+	for _, img := range []image.Image{a, b} {
+		bounds := img.Bounds().Intersect(merged.Bounds())
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < 128 {
+					merged.Set(x, y, color.Black)
+				}
+			}
+		}
+	}
+
+	return merged
+}
+
+// CompositeImages returns a color image showing the black and red images the way the display does.
+func CompositeImages(black, red image.Image) draw.Image {
+	composite := image.NewPaletted(black.Bounds(), color.Palette{color.White, color.Black, color.RGBA{R: 0xcc, A: 0xff}})
+	draw.Draw(composite, composite.Bounds(), image.White, image.Point{}, draw.Src)
+	for i, img := range []image.Image{black, red} {
+		bounds := img.Bounds().Intersect(composite.Bounds())
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < 128 {
+					// red is drawn over black like on the display
+					composite.SetColorIndex(x, y, uint8(i+1))
+				}
+			}
+		}
+	}
+
+	return composite
+}
+
+// invertRect swaps white and black pixels of the two color image within the rectangle.
+func invertRect(dst *image.Paletted, rect image.Rectangle) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			dst.SetColorIndex(x, y, 1-dst.ColorIndexAt(x, y))
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package ui
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"weather-pi/forecast"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Layout describes what is drawn in the pane of every reading. The positions of the widgets
+// are relative to the top left corner of the pane.
+type Layout struct {
+	Pane []Widget `yaml:"Pane"`
+}
+
+// WidgetType selects what the widget draws.
+type WidgetType string
+
+const (
+	// TextWidget draws the Text of the widget
+	TextWidget WidgetType = "text"
+	// ValueWidget draws the value of the Field
+	ValueWidget WidgetType = "value"
+	// LabelWidget draws the label of the Field (e.g. "Min:" or "Gust:"), it is left out
+	// together with the value when the reading does not have it
+	LabelWidget WidgetType = "label"
+	// IconWidget draws the weather Icon or the forecast for today when bound to the forecast field
+	IconWidget WidgetType = "icon"
+	// SparklineWidget draws the temperature history in its box
+	SparklineWidget WidgetType = "sparkline"
+	// DividerWidget is a line across its box, a vertical one in rows or when only Height is set
+	DividerWidget WidgetType = "divider"
+	// BigNumberWidget draws the value of the Field (main by default) with the unit at half the size
+	BigNumberWidget WidgetType = "bignumber"
+	// LabelledWidget draws the label of the Field followed by its value
+	LabelledWidget WidgetType = "labelled"
+	// MinMaxWidget draws the range of the reading in two columns with the labels above the values
+	MinMaxWidget WidgetType = "minmax"
+	// HumidityBarWidget draws a bar filled according to the humidity
+	HumidityBarWidget WidgetType = "humiditybar"
+	// BatteryWidget draws a battery filled according to the battery level of the module
+	BatteryWidget WidgetType = "battery"
+	// TrendWidget draws an arrow of the temperature trend, or the pressure trend with the pressure field
+	TrendWidget WidgetType = "trend"
+	// ClockWidget draws the current time in the Format, or the time of the reading with the time field
+	ClockWidget WidgetType = "clock"
+	// RowWidget and ColumnWidget place their Children next to or below each other by their measured size
+	RowWidget    WidgetType = "row"
+	ColumnWidget WidgetType = "column"
+	// BoxWidget is a column with a border
+	BoxWidget WidgetType = "box"
+)
+
+// Field is a value of the reading a widget is bound to.
+type Field string
+
+const (
+	NameField     Field = "name"
+	MainField     Field = "main"
+	LeftField     Field = "left"
+	RightField    Field = "right"
+	HumidityField Field = "humidity"
+	CO2Field      Field = "co2"
+	PressureField Field = "pressure"
+	NoiseField    Field = "noise"
+	BatteryField  Field = "battery"
+	TimeField     Field = "time"
+	HistoryField  Field = "history"
+	ForecastField Field = "forecast"
+)
+
+// Align places the text horizontally within the box of the widget.
+type Align string
+
+const (
+	AlignLeft   Align = "left"
+	AlignCenter Align = "center"
+	AlignRight  Align = "right"
+)
+
+// Plane selects which color of the display the widget is drawn with.
+type Plane string
+
+const (
+	BlackPlane Plane = "black"
+	// RedPlane is drawn in black when the module stopped reporting
+	RedPlane Plane = "red"
+)
+
+// Widget is a single element of the pane. Width and Height default to the measured size
+// of the widget or to the rest of the pane for the widgets which fill the space.
+type Widget struct {
+	Type  WidgetType `yaml:"Type"`
+	Field Field      `yaml:"Field,omitempty"`
+	Text  string     `yaml:"Text,omitempty"`
+	// Icon is the name of the weather condition drawn by the icon widget
+	Icon   string `yaml:"Icon,omitempty"`
+	X      Length `yaml:"X,omitempty"`
+	Y      Length `yaml:"Y,omitempty"`
+	Width  Length `yaml:"Width,omitempty"`
+	Height Length `yaml:"Height,omitempty"`
+	// Size is the font size in points
+	Size float64 `yaml:"Size,omitempty"`
+	// Font is the text role whose font the text is drawn with, label for the text and label
+	// widgets and value for the others by default
+	Font TextRole `yaml:"Font,omitempty"`
+	// MinSize is the smallest font size text is shrunk to when it is wider than its box
+	// before it is ellipsized, it defaults to the status font size
+	MinSize float64 `yaml:"MinSize,omitempty"`
+	// LabelSize is the font size of the labels of the labelled and min/max widgets
+	LabelSize float64 `yaml:"LabelSize,omitempty"`
+	// Format is the Go time layout of the clock
+	Format string `yaml:"Format,omitempty"`
+	Align  Align  `yaml:"Align,omitempty"`
+	Plane  Plane  `yaml:"Plane,omitempty"`
+	// If and Unless draw the widget only when the reading has (or does not have) the field
+	If     Field `yaml:"If,omitempty"`
+	Unless Field `yaml:"Unless,omitempty"`
+	// Children are placed by the row, column and box widgets, their X and Y are ignored
+	Children []Widget `yaml:"Children,omitempty"`
+	// Gap is the space between the children in pixels
+	Gap int `yaml:"Gap,omitempty"`
+}
+
+// Length is a distance in pixels, optionally relative to the size of the pane, written
+// as 12, "50%" or "50%+4".
+type Length struct {
+	Percent int
+	Pixels  int
+}
+
+// lengthPattern matches "50%", "50%+4", "50%-5" and "12"
+var lengthPattern = regexp.MustCompile(`^\s*(?:(-?\d+)%\s*(?:([+-])\s*(\d+))?|(-?\d+))\s*$`)
+
+func (l *Length) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var pixels int
+	if err := unmarshal(&pixels); err == nil {
+		*l = Length{Pixels: pixels}
+		return nil
+	}
+	var text string
+	if err := unmarshal(&text); err != nil {
+		return err
+	}
+	match := lengthPattern.FindStringSubmatch(text)
+	if match == nil {
+		return errors.Errorf("invalid length %q", text)
+	}
+	if match[4] != "" {
+		l.Percent, l.Pixels = 0, atoi(match[4])
+		return nil
+	}
+	l.Percent, l.Pixels = atoi(match[1]), atoi(match[3])
+	if match[2] == "-" {
+		l.Pixels = -l.Pixels
+	}
+
+	return nil
+}
+
+// atoi converts the numbers matched by lengthPattern, empty is 0
+func atoi(text string) int {
+	value, _ := strconv.Atoi(text)
+	return value
+}
+
+func (l Length) MarshalYAML() (interface{}, error) {
+	switch {
+	case l.Percent == 0:
+		return l.Pixels, nil
+	case l.Pixels == 0:
+		return fmt.Sprintf("%d%%", l.Percent), nil
+	case l.Pixels < 0:
+		return fmt.Sprintf("%d%%%d", l.Percent, l.Pixels), nil
+	default:
+		return fmt.Sprintf("%d%%+%d", l.Percent, l.Pixels), nil
+	}
+}
+
+// IsZero tells yaml to leave out the lengths which were not set
+func (l Length) IsZero() bool {
+	return l == Length{}
+}
+
+// resolve converts the length to pixels within the given size of the pane.
+func (l Length) resolve(size int) int {
+	return size*l.Percent/100 + l.Pixels
+}
+
+// Pixels returns a length in pixels.
+func Pixels(pixels int) Length {
+	return Length{Pixels: pixels}
+}
+
+// Percent returns a length relative to the size of the pane shifted by the given pixels.
+func Percent(percent, pixels int) Length {
+	return Length{Percent: percent, Pixels: pixels}
+}
+
+// DefaultLayout shows the main value, the range and the humidity of the reading with
+// the temperature history (or the air quality of the base station) in the bottom right corner.
+var DefaultLayout = Layout{Pane: []Widget{
+	{Type: ValueWidget, Field: NameField, Y: Pixels(1), Size: tertiaryFontSize, Font: LabelText},
+	{Type: LabelWidget, Field: HumidityField, Y: Pixels(72), Size: tertiaryFontSize},
+	{Type: ValueWidget, Field: HumidityField, X: Pixels(15), Y: Pixels(70), Size: secondaryFontSize},
+	{Type: LabelWidget, Field: LeftField, Y: Pixels(45), Width: Percent(50, -2), Size: statusFontSize},
+	{Type: LabelWidget, Field: RightField, X: Percent(50, 0), Y: Pixels(45), Size: statusFontSize},
+	{Type: ValueWidget, Field: MainField, Y: Pixels(15), Size: mainFontSize, Plane: RedPlane},
+	{Type: ValueWidget, Field: LeftField, Y: Pixels(55), Width: Percent(50, -2), Size: tertiaryFontSize, Plane: RedPlane},
+	{Type: ValueWidget, Field: RightField, X: Percent(50, 0), Y: Pixels(55), Size: tertiaryFontSize, Plane: RedPlane},
+	{Type: SparklineWidget, X: Percent(50, 4), Y: Pixels(73), Width: Percent(50, -5), Height: Pixels(14), Unless: PressureField},
+	{Type: ValueWidget, Field: CO2Field, X: Percent(50, 4), Y: Pixels(67), Size: statusFontSize, If: PressureField},
+	{Type: ValueWidget, Field: PressureField, X: Percent(50, 4), Y: Pixels(77), Size: statusFontSize},
+}}
+
+// LoadLayout reads the layout from a YAML file.
+func LoadLayout(path string) (Layout, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Layout{}, errors.Wrap(err, "could not read layout file")
+	}
+	var layout Layout
+	if err := yaml.UnmarshalStrict(data, &layout); err != nil {
+		return Layout{}, errors.Wrapf(err, "could not decode layout file %s", path)
+	}
+	if err := layout.Validate(); err != nil {
+		return Layout{}, errors.Wrapf(err, "invalid layout file %s", path)
+	}
+
+	return layout, nil
+}
+
+// Validate checks the types, fields, alignments, planes, fonts and sizes of the widgets.
+func (l Layout) Validate() error {
+	if len(l.Pane) == 0 {
+		return errors.New("the pane has no widgets")
+	}
+	for i, widget := range l.Pane {
+		if err := widget.validate(); err != nil {
+			return errors.Wrapf(err, "widget %d", i+1)
+		}
+	}
+
+	return nil
+}
+
+func (w Widget) validate() error {
+	switch w.Type {
+	case TextWidget, SparklineWidget, DividerWidget, BigNumberWidget, MinMaxWidget, HumidityBarWidget,
+		BatteryWidget, TrendWidget, ClockWidget:
+	case RowWidget, ColumnWidget, BoxWidget:
+		for i, child := range w.Children {
+			if err := child.validate(); err != nil {
+				return errors.Wrapf(err, "child %d", i+1)
+			}
+		}
+	case ValueWidget, LabelWidget, LabelledWidget:
+		if w.Field == "" {
+			return errors.Errorf("%s widget needs a field", w.Type)
+		}
+	case IconWidget:
+		if w.Icon == "" && w.Field != ForecastField {
+			return errors.Errorf("icon widget needs an icon or the %s field", ForecastField)
+		}
+		if w.Icon != "" {
+			if _, err := WeatherIcon(forecast.Condition(w.Icon), forecastIconSize); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.Errorf("unknown widget type %q", w.Type)
+	}
+	switch w.Type {
+	case IconWidget, HumidityBarWidget, BatteryWidget, TrendWidget:
+		// their size does not depend on the pane, percentages would resolve to nothing
+		if w.Width.Percent != 0 || w.Height.Percent != 0 {
+			return errors.Errorf("the size of the %s widget must be in pixels", w.Type)
+		}
+	}
+	for _, field := range []Field{w.Field, w.If, w.Unless} {
+		if field != "" && !knownFields[field] {
+			return errors.Errorf("unknown field %q", field)
+		}
+	}
+	switch w.Align {
+	case "", AlignLeft, AlignCenter, AlignRight:
+	default:
+		return errors.Errorf("unknown alignment %q", w.Align)
+	}
+	switch w.Plane {
+	case "", BlackPlane, RedPlane:
+	default:
+		return errors.Errorf("unknown plane %q", w.Plane)
+	}
+	switch w.Font {
+	case "", ValueText, LabelText, StatusText:
+	default:
+		return errors.Errorf("unknown font %q", w.Font)
+	}
+
+	return nil
+}
+
+var knownFields = map[Field]bool{
+	NameField: true, MainField: true, LeftField: true, RightField: true, HumidityField: true, CO2Field: true,
+	PressureField: true, NoiseField: true, BatteryField: true, TimeField: true, HistoryField: true, ForecastField: true,
+}
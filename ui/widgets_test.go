@@ -0,0 +1,36 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+	"weather-pi/forecast"
+)
+
+func TestLayoutValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		widget Widget
+		err    string
+	}{
+		{"value", Widget{Type: ValueWidget, Field: MainField, Width: Percent(50, -2)}, ""},
+		{"sparkline in percent", Widget{Type: SparklineWidget, Width: Percent(50, 0), Height: Pixels(14)}, ""},
+		{"icon in pixels", Widget{Type: IconWidget, Icon: string(forecast.Sunny), Width: Pixels(24)}, ""},
+		{"icon in percent", Widget{Type: IconWidget, Icon: string(forecast.Sunny), Width: Percent(50, 0)}, "the size of the icon widget must be in pixels"},
+		{"humidity bar in percent", Widget{Type: HumidityBarWidget, Width: Percent(50, 0)}, "the size of the humiditybar widget must be in pixels"},
+		{"battery in percent", Widget{Type: BatteryWidget, Height: Percent(10, 2)}, "the size of the battery widget must be in pixels"},
+		{"trend in percent", Widget{Type: TrendWidget, Width: Percent(5, 0)}, "the size of the trend widget must be in pixels"},
+		{"child in percent", Widget{Type: RowWidget, Children: []Widget{{Type: BatteryWidget, Width: Percent(20, 0)}}}, "child 1: the size of the battery widget"},
+		{"missing field", Widget{Type: ValueWidget}, "value widget needs a field"},
+		{"unknown type", Widget{Type: "gauge"}, `unknown widget type "gauge"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Layout{Pane: []Widget{tt.widget}}.Validate()
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("Validate() error = %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("Validate() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}